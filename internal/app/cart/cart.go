@@ -3,6 +3,7 @@ package cart
 import (
 	"time"
 
+	"github.com/ayo-ajayi/ecommerce/internal/app/item"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
@@ -14,9 +15,13 @@ type Cart struct {
 	UpdatedAt  time.Time          `json:"updated_at" bson:"updated_at"`
 }
 
+// CartItem is a line of a cart. Reserved is the stock the whole line holds, recorded as it is
+// reserved: the item itself, a bundle's components as they were when it was added, or nothing
+// for downloads. It is nil for lines added before reservations were recorded.
 type CartItem struct {
-	ItemID     primitive.ObjectID `json:"item_id" bson:"item_id,omitempty"`
-	Quantity   int                `json:"quantity" bson:"quantity"`
-	Price      float64            `json:"price" bson:"price"`
-	TotalPrice float64            `json:"total_price" bson:"total_price"`
+	ItemID     primitive.ObjectID     `json:"item_id" bson:"item_id,omitempty"`
+	Quantity   int                    `json:"quantity" bson:"quantity"`
+	Price      float64                `json:"price" bson:"price"`
+	TotalPrice float64                `json:"total_price" bson:"total_price"`
+	Reserved   []item.BundleComponent `json:"-" bson:"reserved"`
 }
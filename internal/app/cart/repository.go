@@ -1,6 +1,8 @@
 package cart
 
 import (
+	"context"
+
 	"github.com/ayo-ajayi/ecommerce/internal/database"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
@@ -57,3 +59,20 @@ func (cr *CartRepo) DeleteCart(filter interface{}, opts ...*options.DeleteOption
 	_, err := cr.Collection.DeleteOne(ctx, filter, opts...)
 	return err
 }
+
+// The methods below are part of the transaction ctx belongs to
+
+func (cr *CartRepo) CreateCartTx(ctx context.Context, cart *Cart) error {
+	_, err := cr.Collection.InsertOne(ctx, cart)
+	return err
+}
+
+func (cr *CartRepo) UpdateCartTx(ctx context.Context, filter interface{}, update interface{}) error {
+	_, err := cr.Collection.UpdateOne(ctx, filter, update)
+	return err
+}
+
+func (cr *CartRepo) DeleteCartTx(ctx context.Context, filter interface{}) error {
+	_, err := cr.Collection.DeleteOne(ctx, filter)
+	return err
+}
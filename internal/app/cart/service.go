@@ -1,7 +1,7 @@
 package cart
 
 import (
-	"sync"
+	"context"
 	"time"
 
 	"github.com/ayo-ajayi/ecommerce/internal/app/item"
@@ -14,14 +14,10 @@ import (
 )
 
 type CartService struct {
-	cartRepo   CartRepository
-	itemRepo   ItemRepository
-	updateChan chan itemUpdateRequest
-}
-type itemUpdateRequest struct {
-	itemID         primitive.ObjectID
-	quantityChange int
-	responseChan   chan error
+	cartRepo      CartRepository
+	itemRepo      ItemRepository
+	priceResolver PriceResolver
+	transactor    Transactor
 }
 
 type CartRepository interface {
@@ -29,27 +25,31 @@ type CartRepository interface {
 	UpdateCart(filter interface{}, update interface{}, opts ...*options.UpdateOptions) error
 	GetCart(filter interface{}, opts ...*options.FindOneOptions) (*Cart, error)
 	GetCarts(filter interface{}, opts ...*options.FindOptions) ([]*Cart, error)
+	CreateCartTx(ctx context.Context, cart *Cart) error
+	UpdateCartTx(ctx context.Context, filter interface{}, update interface{}) error
 }
 
 type ItemRepository interface {
 	GetItem(filter interface{}, opts ...*options.FindOneOptions) (*item.Item, error)
-	UpdateItem(filter interface{}, update interface{}, opts ...*options.UpdateOptions) error
+	GetItems(filter interface{}, opts ...*options.FindOptions) ([]*item.Item, error)
+	UpdateItemTx(ctx context.Context, filter interface{}, update interface{}) error
 }
 
-func NewCartService(cartRepository CartRepository, itemRepository ItemRepository) *CartService {
-	cs := &CartService{
-		cartRepo:   cartRepository,
-		itemRepo:   itemRepository,
-		updateChan: make(chan itemUpdateRequest),
-	}
-	go cs.processItemUpdates()
-	return cs
+type PriceResolver interface {
+	ResolvePrices(items ...*item.Item) *errors.AppError
+}
+
+// Transactor runs fn in a database transaction
+type Transactor interface {
+	WithTransaction(fn func(ctx context.Context) error) error
 }
 
-func (cs *CartService) processItemUpdates() {
-	for req := range cs.updateChan {
-		err := cs.itemRepo.UpdateItem(bson.M{"_id": req.itemID}, bson.M{"$inc": bson.M{"quantity": req.quantityChange}})
-		req.responseChan <- err
+func NewCartService(cartRepository CartRepository, itemRepository ItemRepository, priceResolver PriceResolver, transactor Transactor) *CartService {
+	return &CartService{
+		cartRepo:      cartRepository,
+		itemRepo:      itemRepository,
+		priceResolver: priceResolver,
+		transactor:    transactor,
 	}
 }
 
@@ -61,67 +61,140 @@ func (cs *CartService) AddToCart(userid primitive.ObjectID, cartItem CartItem) *
 		}
 		return errors.ErrInternalServer
 	}
-	if item.Quantity < cartItem.Quantity {
-		return errors.NewError("not enough quantity available in inventory", 400)
+	if !item.IsPublished() {
+		return errors.NewError("item is no longer available: "+cartItem.ItemID.Hex(), 400)
 	}
-	if item.Discount > 0 {
-		cartItem.Price = item.Price - item.Price*item.Discount/100
-	} else {
-		cartItem.Price = item.Price
+	if err := cs.checkStock(item, cartItem.Quantity); err != nil {
+		return err
 	}
+	if err := cs.priceResolver.ResolvePrices(item); err != nil {
+		return err
+	}
+	cartItem.Price = item.EffectivePrice
 	cartItem.TotalPrice = cartItem.Price * float64(cartItem.Quantity)
+	reserved := stockChanges(item, cartItem.Quantity)
 	ct, err := cs.cartRepo.GetCart(bson.M{"user_id": userid})
 	if err != nil {
 		if err != mongo.ErrNoDocuments {
 			return errors.ErrInternalServer
 		}
-		cart := &Cart{
+		cartItem.Reserved = reserved
+		ct = &Cart{
+			ID:         primitive.NewObjectID(),
 			UserID:     userid,
 			CartItems:  []CartItem{cartItem},
 			TotalPrice: cartItem.TotalPrice,
-			UpdatedAt:  time.Now(),
 		}
-		err := cs.cartRepo.CreateCart(cart)
-		if err != nil {
-			return errors.ErrInternalServer
-		}
-	} else {
-		itemExists := false
-		for i, v := range ct.CartItems {
-			if v.ItemID == cartItem.ItemID {
-				ct.CartItems[i].Quantity += cartItem.Quantity
-				ct.CartItems[i].TotalPrice += cartItem.TotalPrice
-				itemExists = true
-				break
+		return cs.saveCart(ct, true, reserved, add)
+	}
+	itemExists := false
+	for i, v := range ct.CartItems {
+		if v.ItemID == cartItem.ItemID {
+			if v.Reserved == nil {
+				v.Reserved = stockChanges(item, v.Quantity)
 			}
+			ct.CartItems[i].Quantity += cartItem.Quantity
+			ct.CartItems[i].TotalPrice += cartItem.TotalPrice
+			ct.CartItems[i].Reserved = mergeStock(v.Reserved, reserved)
+			itemExists = true
+			break
 		}
-		if !itemExists {
-			ct.CartItems = append(ct.CartItems, cartItem)
-		}
+	}
+	if !itemExists {
+		cartItem.Reserved = reserved
+		ct.CartItems = append(ct.CartItems, cartItem)
+	}
 
-		ct.TotalPrice = 0.0
-		for _, item := range ct.CartItems {
-			ct.TotalPrice += item.TotalPrice
-		}
+	if err := cs.repriceCart(ct); err != nil {
+		return err
 	}
-	return cs.updateConcurrently(ct, cartItem, add)
+	return cs.saveCart(ct, false, reserved, add)
 }
 
-func (cs *CartService) updateItemQuantity(itemID primitive.ObjectID, quantityChange int) *errors.AppError {
-	responseChan := make(chan error)
-	cs.updateChan <- itemUpdateRequest{
-		itemID:         itemID,
-		quantityChange: quantityChange,
-		responseChan:   responseChan,
+// checkStock reports whether quantity of the item can be reserved. A bundle is
+// available when every component has enough stock for the bundles requested.
+func (cs *CartService) checkStock(it *item.Item, quantity int) *errors.AppError {
+	if it.HasUnlimitedStock() {
+		return nil
+	}
+	if !it.IsBundle() {
+		if it.Quantity < quantity {
+			return errors.NewError("not enough quantity available in inventory", 400)
+		}
+		return nil
+	}
+	componentIDs := make([]primitive.ObjectID, 0, len(it.Components))
+	for _, v := range it.Components {
+		componentIDs = append(componentIDs, v.ItemID)
 	}
-	err := <-responseChan
-	close(responseChan)
+	components, err := cs.itemRepo.GetItems(bson.M{"_id": bson.M{"$in": componentIDs}})
 	if err != nil {
 		return errors.ErrInternalServer
 	}
+	stock := make(map[primitive.ObjectID]int, len(components))
+	for _, v := range components {
+		stock[v.ID] = v.Quantity
+	}
+	if item.BundleAvailability(it.Components, stock) < quantity {
+		return errors.NewError("not enough quantity available in inventory", 400)
+	}
 	return nil
 }
 
+// stockChanges lists the stock held by quantity of the item: nothing for unlimited
+// downloads, the components for a bundle and the item itself otherwise
+func stockChanges(it *item.Item, quantity int) []item.BundleComponent {
+	changes := []item.BundleComponent{}
+	if it.HasUnlimitedStock() {
+		return changes
+	}
+	if !it.IsBundle() {
+		return append(changes, item.BundleComponent{ItemID: it.ID, Quantity: quantity})
+	}
+	for _, v := range it.Components {
+		changes = append(changes, item.BundleComponent{ItemID: v.ItemID, Quantity: v.Quantity * quantity})
+	}
+	return changes
+}
+
+// mergeStock adds the stock in b to the stock in a
+func mergeStock(a, b []item.BundleComponent) []item.BundleComponent {
+	merged := append([]item.BundleComponent{}, a...)
+	for _, v := range b {
+		found := false
+		for i := range merged {
+			if merged[i].ItemID == v.ItemID {
+				merged[i].Quantity += v.Quantity
+				found = true
+				break
+			}
+		}
+		if !found {
+			merged = append(merged, v)
+		}
+	}
+	return merged
+}
+
+// releasedStock splits the stock reserved by a line of quantity items into the share of the
+// removed items and what the line keeps. Rounding leaves stock on the line, and the last item
+// removed releases whatever remains, so the line releases exactly what it reserved.
+func releasedStock(reserved []item.BundleComponent, quantity, removed int) (released, kept []item.BundleComponent) {
+	if removed >= quantity {
+		return reserved, []item.BundleComponent{}
+	}
+	released = []item.BundleComponent{}
+	kept = []item.BundleComponent{}
+	for _, v := range reserved {
+		share := v.Quantity * removed / quantity
+		if share > 0 {
+			released = append(released, item.BundleComponent{ItemID: v.ItemID, Quantity: share})
+		}
+		kept = append(kept, item.BundleComponent{ItemID: v.ItemID, Quantity: v.Quantity - share})
+	}
+	return released, kept
+}
+
 func (cs *CartService) RemoveFromCart(userid primitive.ObjectID, cartItem CartItem) *errors.AppError {
 	ct, err := cs.cartRepo.GetCart(bson.M{"user_id": userid})
 	if err != nil {
@@ -144,29 +217,35 @@ func (cs *CartService) RemoveFromCart(userid primitive.ObjectID, cartItem CartIt
 		return errors.NewError("cannot remove more items than what is in the cart cart", 400)
 	}
 
-	itemFound := false
-	for i, v := range ct.CartItems {
-		if v.ItemID == cartItem.ItemID {
-			if v.Quantity > cartItem.Quantity {
-				ct.CartItems[i].Quantity -= cartItem.Quantity
-				ct.CartItems[i].TotalPrice = ct.CartItems[i].Price * float64(ct.CartItems[i].Quantity)
-			} else {
+	reserved := foundCartItem.Reserved
+	if reserved == nil {
+		// lines added before reservations were recorded reserved what the item is now made of
+		reserved = []item.BundleComponent{{ItemID: foundCartItem.ItemID, Quantity: foundCartItem.Quantity}}
+		if it, err := cs.itemRepo.GetItem(bson.M{"_id": foundCartItem.ItemID}); err == nil {
+			reserved = stockChanges(it, foundCartItem.Quantity)
+		} else if err != mongo.ErrNoDocuments {
+			return errors.ErrInternalServer
+		}
+	}
+	released, kept := releasedStock(reserved, foundCartItem.Quantity, cartItem.Quantity)
+	if foundCartItem.Quantity > cartItem.Quantity {
+		foundCartItem.Quantity -= cartItem.Quantity
+		foundCartItem.TotalPrice = foundCartItem.Price * float64(foundCartItem.Quantity)
+		foundCartItem.Reserved = kept
+	} else {
+		for i, v := range ct.CartItems {
+			if v.ItemID == cartItem.ItemID {
 				ct.CartItems = append(ct.CartItems[:i], ct.CartItems[i+1:]...)
+				break
 			}
-			itemFound = true
-			break
 		}
 	}
 
-	if !itemFound {
-		return errors.NewError("item not found in cart", 404)
-	}
-
 	ct.TotalPrice = 0.0
 	for _, item := range ct.CartItems {
 		ct.TotalPrice += item.TotalPrice
 	}
-	return cs.updateConcurrently(ct, cartItem, remove)
+	return cs.saveCart(ct, false, released, remove)
 }
 
 func (cs *CartService) GetCart(userid primitive.ObjectID) (*Cart, *errors.AppError) {
@@ -177,45 +256,76 @@ func (cs *CartService) GetCart(userid primitive.ObjectID) (*Cart, *errors.AppErr
 		}
 		return nil, errors.NewError("cart not found", 404)
 	}
+	if err := cs.repriceCart(ct); err != nil {
+		return nil, err
+	}
 	return ct, nil
 }
 
+// repriceCart sets every cart line to its item's effective price at request time,
+// so sales that start or expire after an item was added are reflected in the cart
+func (cs *CartService) repriceCart(ct *Cart) *errors.AppError {
+	if len(ct.CartItems) == 0 {
+		ct.TotalPrice = 0.0
+		return nil
+	}
+	itemIDs := make([]primitive.ObjectID, 0, len(ct.CartItems))
+	for _, v := range ct.CartItems {
+		itemIDs = append(itemIDs, v.ItemID)
+	}
+	items, err := cs.itemRepo.GetItems(bson.M{"_id": bson.M{"$in": itemIDs}})
+	if err != nil {
+		return errors.ErrInternalServer
+	}
+	if err := cs.priceResolver.ResolvePrices(items...); err != nil {
+		return err
+	}
+	prices := make(map[primitive.ObjectID]float64, len(items))
+	for _, v := range items {
+		prices[v.ID] = v.EffectivePrice
+	}
+	ct.TotalPrice = 0.0
+	for i, v := range ct.CartItems {
+		if price, ok := prices[v.ItemID]; ok {
+			ct.CartItems[i].Price = price
+		}
+		ct.CartItems[i].TotalPrice = ct.CartItems[i].Price * float64(v.Quantity)
+		ct.TotalPrice += ct.CartItems[i].TotalPrice
+	}
+	return nil
+}
+
 type action string
 
 const add action = "add"
 const remove action = "remove"
 
-func (cs *CartService) updateConcurrently(ct *Cart, cartItem CartItem, act action) *errors.AppError {
-	errChan := make(chan *errors.AppError, 2)
-	var wg sync.WaitGroup
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		ct.UpdatedAt = time.Now()
-		err := cs.cartRepo.UpdateCart(bson.M{"_id": ct.ID}, bson.M{"$set": bson.M{"cart_items": ct.CartItems, "total_price": ct.TotalPrice, "updated_at": ct.UpdatedAt}})
-		if err != nil {
-			errChan <- errors.ErrInternalServer
-		}
-	}()
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		var err *errors.AppError
-		if act == remove {
-			err = cs.updateItemQuantity(cartItem.ItemID, cartItem.Quantity)
+// saveCart saves the cart and reserves or releases the stock in changes in one transaction
+func (cs *CartService) saveCart(ct *Cart, create bool, changes []item.BundleComponent, act action) *errors.AppError {
+	ct.UpdatedAt = time.Now()
+	err := cs.transactor.WithTransaction(func(ctx context.Context) error {
+		var err error
+		if create {
+			err = cs.cartRepo.CreateCartTx(ctx, ct)
 		} else {
-			err = cs.updateItemQuantity(cartItem.ItemID, -1*cartItem.Quantity)
-		}
-		if err != nil {
-			errChan <- errors.ErrInternalServer
+			err = cs.cartRepo.UpdateCartTx(ctx, bson.M{"_id": ct.ID}, bson.M{"$set": bson.M{"cart_items": ct.CartItems, "total_price": ct.TotalPrice, "updated_at": ct.UpdatedAt}})
 		}
-	}()
-	wg.Wait()
-	close(errChan)
-	for err := range errChan {
 		if err != nil {
 			return err
 		}
+		for _, change := range changes {
+			quantity := change.Quantity
+			if act == add {
+				quantity = -quantity
+			}
+			if err := cs.itemRepo.UpdateItemTx(ctx, bson.M{"_id": change.ItemID}, bson.M{"$inc": bson.M{"quantity": quantity}}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return errors.ErrInternalServer
 	}
 	return nil
 }
@@ -0,0 +1,160 @@
+package category
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/ayo-ajayi/ecommerce/internal/errors"
+)
+
+type AttributeType string
+
+const (
+	AttributeEnum    AttributeType = "enum"
+	AttributeNumber  AttributeType = "number"
+	AttributeBoolean AttributeType = "boolean"
+	AttributeText    AttributeType = "text"
+)
+
+type AttributeSchema struct {
+	Name     string        `json:"name" bson:"name"`
+	Label    string        `json:"label" bson:"label"`
+	Type     AttributeType `json:"type" bson:"type"`
+	Unit     string        `json:"unit,omitempty" bson:"unit,omitempty"`
+	Options  []string      `json:"options,omitempty" bson:"options,omitempty"`
+	Required bool          `json:"required" bson:"required"`
+}
+
+// attribute names end up as mongo field paths (attributes.<name>) so they are kept to a safe charset
+var attributeNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,39}$`)
+
+func IsValidAttributeName(name string) bool {
+	return attributeNamePattern.MatchString(name)
+}
+
+func ValidateAttributeSchemas(schemas []AttributeSchema) *errors.AppError {
+	seen := make(map[string]bool, len(schemas))
+	for _, v := range schemas {
+		if !IsValidAttributeName(v.Name) {
+			return errors.NewError("invalid attribute name: "+v.Name, 400)
+		}
+		if seen[v.Name] {
+			return errors.NewError("duplicate attribute name: "+v.Name, 400)
+		}
+		seen[v.Name] = true
+		switch v.Type {
+		case AttributeEnum:
+			if len(v.Options) == 0 {
+				return errors.NewError("enum attribute requires options: "+v.Name, 400)
+			}
+		case AttributeNumber, AttributeBoolean, AttributeText:
+			if len(v.Options) > 0 {
+				return errors.NewError("only enum attributes can have options: "+v.Name, 400)
+			}
+		default:
+			return errors.NewError("invalid attribute type: "+string(v.Type), 400)
+		}
+		if v.Unit != "" && v.Type != AttributeNumber {
+			return errors.NewError("only number attributes can have a unit: "+v.Name, 400)
+		}
+	}
+	return nil
+}
+
+// Conflicts reports whether two schemas for the same attribute name disagree on how its values
+// are stored or validated. Labels are only for display and may differ.
+func (as AttributeSchema) Conflicts(other AttributeSchema) bool {
+	if as.Type != other.Type || as.Unit != other.Unit || as.Required != other.Required || len(as.Options) != len(other.Options) {
+		return true
+	}
+	for i := range as.Options {
+		if as.Options[i] != other.Options[i] {
+			return true
+		}
+	}
+	return false
+}
+
+// NormalizeAttributes checks attributes against the attribute schemas of the categories an item
+// is in and returns them in the types stored on items
+func NormalizeAttributes(categories []*Category, attributes map[string]interface{}) (map[string]interface{}, *errors.AppError) {
+	schemas := make(map[string]AttributeSchema)
+	for _, c := range categories {
+		for _, schema := range c.Attributes {
+			if existing, ok := schemas[schema.Name]; ok && existing.Conflicts(schema) {
+				return nil, errors.NewError("item categories define attribute differently: "+schema.Name, 400)
+			}
+			schemas[schema.Name] = schema
+		}
+	}
+	normalized := make(map[string]interface{}, len(attributes))
+	for name, value := range attributes {
+		schema, ok := schemas[name]
+		if !ok {
+			return nil, errors.NewError("attribute not defined for item categories: "+name, 400)
+		}
+		v, err := schema.Normalize(value)
+		if err != nil {
+			return nil, err
+		}
+		normalized[name] = v
+	}
+	for name, schema := range schemas {
+		if _, ok := normalized[name]; schema.Required && !ok {
+			return nil, errors.NewError("missing required attribute: "+name, 400)
+		}
+	}
+	return normalized, nil
+}
+
+// Normalize checks value against the schema and returns it in the type stored on items
+func (as AttributeSchema) Normalize(value interface{}) (interface{}, *errors.AppError) {
+	invalid := errors.NewError("invalid value for attribute: "+as.Name, 400)
+	switch as.Type {
+	case AttributeEnum:
+		str, ok := value.(string)
+		if !ok {
+			return nil, invalid
+		}
+		for _, option := range as.Options {
+			if option == str {
+				return str, nil
+			}
+		}
+		return nil, errors.NewError("invalid option for attribute "+as.Name+": "+str, 400)
+	case AttributeNumber:
+		switch v := value.(type) {
+		case float64:
+			return v, nil
+		case int:
+			return float64(v), nil
+		case string:
+			num, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+			if err != nil {
+				return nil, invalid
+			}
+			return num, nil
+		}
+		return nil, invalid
+	case AttributeBoolean:
+		switch v := value.(type) {
+		case bool:
+			return v, nil
+		case string:
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return nil, invalid
+			}
+			return b, nil
+		}
+		return nil, invalid
+	case AttributeText:
+		str, ok := value.(string)
+		if !ok || strings.TrimSpace(str) == "" {
+			return nil, invalid
+		}
+		return str, nil
+	}
+	return nil, invalid
+}
@@ -10,11 +10,25 @@ type Category struct {
 	ID          primitive.ObjectID   `json:"id" bson:"_id,omitempty"`
 	Name        string               `json:"name" bson:"name"`
 	Slug        string               `json:"slug" bson:"slug"`
+	SlugHistory []string             `json:"-" bson:"slug_history,omitempty"`
 	Description string               `json:"description" bson:"description"`
 	Images      []string             `json:"images" bson:"images"`
 	ParentID    []primitive.ObjectID `json:"parent_id" bson:"parent_id,omitempty"`
+	Attributes  []AttributeSchema    `json:"attributes" bson:"attributes,omitempty"`
+	IsDefault   bool                 `json:"is_default" bson:"is_default,omitempty"`
+	Score       float64              `json:"score,omitempty" bson:"score,omitempty"`
 	CreatedBy   primitive.ObjectID   `json:"created_by" bson:"created_by,omitempty"`
 	UpdatedBy   primitive.ObjectID   `json:"updated_by" bson:"updated_by,omitempty"`
+	Version     int64                `json:"version" bson:"version"`
 	CreatedAt   time.Time            `json:"created_at" bson:"created_at"`
 	UpdatedAt   time.Time            `json:"updated_at" bson:"updated_at"`
 }
+
+// DeletedCategory keeps a copy of a deleted category and who deleted it
+type DeletedCategory struct {
+	ID           primitive.ObjectID  `json:"id" bson:"_id,omitempty"`
+	Category     Category            `json:"category" bson:"category"`
+	ReassignedTo *primitive.ObjectID `json:"reassigned_to,omitempty" bson:"reassigned_to,omitempty"`
+	DeletedBy    primitive.ObjectID  `json:"deleted_by" bson:"deleted_by"`
+	DeletedAt    time.Time           `json:"deleted_at" bson:"deleted_at"`
+}
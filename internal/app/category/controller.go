@@ -2,10 +2,14 @@ package category
 
 import (
 	"context"
+	"encoding/json"
 	"mime/multipart"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/ayo-ajayi/ecommerce/internal/errors"
+	"github.com/ayo-ajayi/ecommerce/internal/utils"
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
@@ -23,8 +27,13 @@ type CategoryServices interface {
 	GetCategoryByID(id string) (*Category, *errors.AppError)
 	GetCategories() ([]*Category, *errors.AppError)
 	UpdateCategory(category *Category) *errors.AppError
-	DeleteCategory(id string, userid primitive.ObjectID) *errors.AppError
+	PatchCategory(id string, userid primitive.ObjectID, patch map[string]json.RawMessage, version int64) (*Category, *errors.AppError)
+	DeleteCategory(id string, userid primitive.ObjectID, reassignTo string) *errors.AppError
 	GetCategoryBySlug(slug string) (*Category, *errors.AppError)
+	GetCategoryTree() ([]*CategoryNode, *errors.AppError)
+	GetChildren(id string) ([]*Category, *errors.AppError)
+	GetBreadcrumbs(id string) ([][]*Category, *errors.AppError)
+	AuditHierarchy() (*HierarchyAudit, *errors.AppError)
 }
 
 func NewCategoryController(categoryServices CategoryServices, uploader Uploader) *CategoryController {
@@ -65,6 +74,7 @@ func (cc *CategoryController) createCategory(c *gin.Context) (*Category, *errors
 		Description string               `json:"description" binding:"required"`
 		ParentID    []primitive.ObjectID `json:"parent_id"`
 		Images      []string             `json:"images"`
+		Attributes  []AttributeSchema    `json:"attributes"`
 	}{}
 	req.Name = c.PostForm("name")
 	req.Description = c.PostForm("description")
@@ -79,6 +89,11 @@ func (cc *CategoryController) createCategory(c *gin.Context) (*Category, *errors
 		}
 		req.ParentID = append(req.ParentID, objectID)
 	}
+	if attributes := c.PostForm("attributes"); attributes != "" {
+		if err := json.Unmarshal([]byte(attributes), &req.Attributes); err != nil {
+			return nil, errors.NewError("invalid attributes: "+err.Error(), 400)
+		}
+	}
 	files := c.Request.MultipartForm.File["images"]
 	if imgURLs, err := cc.uploader.UploadImage(c.Request.Context(), files, "categories"); err != nil {
 		return nil, errors.NewError("failed to upload images: "+err.Error(), 400)
@@ -90,6 +105,7 @@ func (cc *CategoryController) createCategory(c *gin.Context) (*Category, *errors
 		Description: req.Description,
 		ParentID:    req.ParentID,
 		Images:      req.Images,
+		Attributes:  req.Attributes,
 	}, nil
 }
 
@@ -110,6 +126,12 @@ func (cc *CategoryController) GetCategoryBySlug(c *gin.Context) {
 		c.JSON(err.StatusCode, gin.H{"error": gin.H{"message": err.Error()}})
 		return
 	}
+	if category.Slug != slug {
+		// an old slug: send clients and crawlers to the canonical url
+		c.Header("Location", strings.TrimSuffix(c.Request.URL.Path, slug)+category.Slug)
+		c.JSON(http.StatusMovedPermanently, gin.H{"data": gin.H{"category": category, "canonical_slug": category.Slug}})
+		return
+	}
 	c.JSON(200, gin.H{"data": gin.H{"category": category}})
 }
 
@@ -125,6 +147,11 @@ func (cc *CategoryController) UpdateCategory(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": "invalid user"}})
 		return
 	}
+	version, fromHeader, vErr := utils.ReadVersion(c)
+	if vErr != nil {
+		c.JSON(vErr.StatusCode, gin.H{"error": gin.H{"message": vErr.Error()}})
+		return
+	}
 	var cErr *errors.AppError
 	category, cErr := cc.createCategory(c)
 	if cErr != nil {
@@ -133,10 +160,41 @@ func (cc *CategoryController) UpdateCategory(c *gin.Context) {
 	}
 	category.ID = categoryId
 	category.UpdatedBy = userid
+	category.Version = version
 	if err := cc.categoryServices.UpdateCategory(category); err != nil {
+		if err == errors.ErrVersionConflict && fromHeader {
+			c.JSON(http.StatusPreconditionFailed, gin.H{"error": gin.H{"message": err.Error()}})
+			return
+		}
+		c.JSON(err.StatusCode, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	c.JSON(200, gin.H{"message": "category updated successfully", "data": gin.H{"category": category}})
+}
+
+// PatchCategory partially updates a category with a JSON merge patch made against the version
+// in the If-Match header or the patch's version field
+func (cc *CategoryController) PatchCategory(c *gin.Context) {
+	userid := c.MustGet("userId").(primitive.ObjectID)
+	if userid.IsZero() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": "invalid user"}})
+		return
+	}
+	patch, version, fromHeader, err := utils.ReadMergePatch(c)
+	if err != nil {
+		c.JSON(err.StatusCode, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	category, err := cc.categoryServices.PatchCategory(c.Param("id"), userid, patch, version)
+	if err != nil {
+		if err == errors.ErrVersionConflict && fromHeader {
+			c.JSON(http.StatusPreconditionFailed, gin.H{"error": gin.H{"message": err.Error()}})
+			return
+		}
 		c.JSON(err.StatusCode, gin.H{"error": gin.H{"message": err.Error()}})
 		return
 	}
+	c.Header("ETag", `"`+strconv.FormatInt(category.Version, 10)+`"`)
 	c.JSON(200, gin.H{"message": "category updated successfully", "data": gin.H{"category": category}})
 }
 
@@ -157,10 +215,47 @@ func (cc *CategoryController) DeleteCategory(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": "invalid user"}})
 		return
 	}
-	err := cc.categoryServices.DeleteCategory(categoryId, userid)
+	err := cc.categoryServices.DeleteCategory(categoryId, userid, c.Query("reassign_to"))
 	if err != nil {
 		c.JSON(err.StatusCode, gin.H{"error": gin.H{"message": err.Error()}})
 		return
 	}
 	c.JSON(200, gin.H{"message": "category deleted successfully"})
 }
+
+func (cc *CategoryController) GetCategoryTree(c *gin.Context) {
+	tree, err := cc.categoryServices.GetCategoryTree()
+	if err != nil {
+		c.JSON(err.StatusCode, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	c.JSON(200, gin.H{"data": gin.H{"tree": tree}})
+}
+
+func (cc *CategoryController) GetChildren(c *gin.Context) {
+	children, err := cc.categoryServices.GetChildren(c.Param("id"))
+	if err != nil {
+		c.JSON(err.StatusCode, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	c.JSON(200, gin.H{"data": gin.H{"categories": children}})
+}
+
+// GetBreadcrumbs returns every path to the category, with the first one as the default breadcrumb
+func (cc *CategoryController) GetBreadcrumbs(c *gin.Context) {
+	paths, err := cc.categoryServices.GetBreadcrumbs(c.Param("id"))
+	if err != nil {
+		c.JSON(err.StatusCode, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	c.JSON(200, gin.H{"data": gin.H{"breadcrumbs": paths[0], "paths": paths}})
+}
+
+func (cc *CategoryController) AuditCategories(c *gin.Context) {
+	audit, err := cc.categoryServices.AuditHierarchy()
+	if err != nil {
+		c.JSON(err.StatusCode, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	c.JSON(200, gin.H{"data": audit})
+}
@@ -0,0 +1,154 @@
+package category
+
+import (
+	"github.com/ayo-ajayi/ecommerce/internal/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// HierarchyAudit lists the problems found in the stored category hierarchy
+type HierarchyAudit struct {
+	Cycles  [][]*Category `json:"cycles"`
+	TooDeep []*Category   `json:"too_deep"`
+}
+
+// checkHierarchy reports whether the category with the given id can have parentID as its parents.
+// Every parent must exist, the category must not end up among its own ancestors and the hierarchy
+// must stay within the maximum depth. A new category has no id yet and passes primitive.NilObjectID.
+func (cs *CategoryService) checkHierarchy(id primitive.ObjectID, parentID []primitive.ObjectID) *errors.AppError {
+	categories, err := cs.categoryRepo.GetCategories(bson.M{})
+	if err != nil {
+		return errors.NewError("internal error: "+err.Error(), 500)
+	}
+	exists := make(map[primitive.ObjectID]bool, len(categories))
+	for _, v := range categories {
+		exists[v.ID] = true
+	}
+	for _, v := range parentID {
+		if v == id {
+			return errors.NewError("a category cannot be its own parent", 400)
+		}
+		if !exists[v] {
+			err := errors.ErrNotFound
+			return errors.NewError("category not found: "+err.Error(), err.StatusCode)
+		}
+	}
+
+	// check against the hierarchy as it would be after the change
+	if id.IsZero() {
+		id = primitive.NewObjectID()
+	}
+	proposed := make([]*Category, 0, len(categories)+1)
+	for _, v := range categories {
+		if v.ID != id {
+			proposed = append(proposed, v)
+		}
+	}
+	proposed = append(proposed, &Category{ID: id, ParentID: parentID})
+	g := newCategoryGraph(proposed)
+
+	for _, v := range g.descendants([]primitive.ObjectID{id}) {
+		for _, p := range parentID {
+			if v == p {
+				return errors.NewError("a category cannot have one of its descendants as a parent", 400)
+			}
+		}
+	}
+	if depth := g.depth(id, map[primitive.ObjectID]bool{}) + g.height(id, map[primitive.ObjectID]bool{}) - 1; depth > cs.maxDepth {
+		return errors.NewError("category hierarchy cannot be deeper than the maximum depth", 400)
+	}
+	return nil
+}
+
+// depth is the number of levels on the longest path from the top of the hierarchy down to id
+func (g *categoryGraph) depth(id primitive.ObjectID, path map[primitive.ObjectID]bool) int {
+	path[id] = true
+	defer delete(path, id)
+	deepest := 0
+	for _, p := range g.byID[id].ParentID {
+		if _, ok := g.byID[p]; !ok || path[p] {
+			continue
+		}
+		if d := g.depth(p, path); d > deepest {
+			deepest = d
+		}
+	}
+	return deepest + 1
+}
+
+// height is the number of levels on the longest path from id down to the bottom of the hierarchy
+func (g *categoryGraph) height(id primitive.ObjectID, path map[primitive.ObjectID]bool) int {
+	path[id] = true
+	defer delete(path, id)
+	highest := 0
+	for _, child := range g.children[id] {
+		if path[child.ID] {
+			continue
+		}
+		if h := g.height(child.ID, path); h > highest {
+			highest = h
+		}
+	}
+	return highest + 1
+}
+
+// cycles returns each loop in the parent links once, as the categories along it
+func (g *categoryGraph) cycles() [][]*Category {
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := make(map[primitive.ObjectID]int, len(g.byID))
+	var stack []*Category
+	var cycles [][]*Category
+	var visit func(c *Category)
+	visit = func(c *Category) {
+		state[c.ID] = visiting
+		stack = append(stack, c)
+		for _, p := range c.ParentID {
+			parent, ok := g.byID[p]
+			if !ok {
+				continue
+			}
+			switch state[p] {
+			case unvisited:
+				visit(parent)
+			case visiting:
+				for i := len(stack) - 1; i >= 0; i-- {
+					if stack[i].ID == p {
+						cycles = append(cycles, append([]*Category{}, stack[i:]...))
+						break
+					}
+				}
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[c.ID] = done
+	}
+	for _, v := range g.byID {
+		if state[v.ID] == unvisited {
+			visit(v)
+		}
+	}
+	return cycles
+}
+
+// AuditHierarchy checks the stored categories for cycles and for categories below the maximum depth
+func (cs *CategoryService) AuditHierarchy() (*HierarchyAudit, *errors.AppError) {
+	categories, err := cs.categoryRepo.GetCategories(bson.M{})
+	if err != nil {
+		return nil, errors.ErrInternalServer
+	}
+	g := newCategoryGraph(categories)
+	audit := &HierarchyAudit{Cycles: g.cycles(), TooDeep: []*Category{}}
+	if audit.Cycles == nil {
+		audit.Cycles = [][]*Category{}
+	}
+	for _, v := range categories {
+		if g.depth(v.ID, map[primitive.ObjectID]bool{}) > cs.maxDepth {
+			audit.TooDeep = append(audit.TooDeep, v)
+		}
+	}
+	return audit, nil
+}
@@ -0,0 +1,118 @@
+package category
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/ayo-ajayi/ecommerce/internal/errors"
+	"github.com/ayo-ajayi/ecommerce/internal/utils"
+	"github.com/gosimple/slug"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// PatchCategory applies a JSON merge patch to the category. Only the patched fields are written,
+// and only if the category is still at version.
+func (cs *CategoryService) PatchCategory(id string, userid primitive.ObjectID, patch map[string]json.RawMessage, version int64) (*Category, *errors.AppError) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, errors.ErrInvalidObjectID
+	}
+	oldcategory, err := cs.categoryRepo.GetCategory(bson.M{"_id": objectID})
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			err := errors.ErrNotFound
+			return nil, errors.NewError("category not found: "+err.Error(), err.StatusCode)
+		}
+		return nil, errors.ErrInternalServer
+	}
+	if oldcategory.Version != version {
+		return nil, errors.ErrVersionConflict
+	}
+
+	set := bson.M{}
+	for field, raw := range patch {
+		invalid := errors.NewError("invalid "+field, 400)
+		switch field {
+		case "version":
+			continue
+		case "name", "description":
+			var value string
+			if err := json.Unmarshal(raw, &value); err != nil || value == "" {
+				return nil, invalid
+			}
+			set[field] = value
+		case "parent_id":
+			parentID := []primitive.ObjectID{}
+			if err := json.Unmarshal(raw, &parentID); err != nil {
+				return nil, invalid
+			}
+			if parentID == nil {
+				parentID = []primitive.ObjectID{}
+			}
+			if err := cs.checkHierarchy(objectID, parentID); err != nil {
+				return nil, err
+			}
+			set[field] = parentID
+		case "attributes":
+			attributes := []AttributeSchema{}
+			if err := json.Unmarshal(raw, &attributes); err != nil {
+				return nil, invalid
+			}
+			if attributes == nil {
+				attributes = []AttributeSchema{}
+			}
+			if err := ValidateAttributeSchemas(attributes); err != nil {
+				return nil, err
+			}
+			set[field] = attributes
+		case "images":
+			return nil, errors.NewError("images are changed through a full update", 400)
+		default:
+			return nil, errors.NewError("field cannot be patched: "+field, 400)
+		}
+	}
+	if len(set) == 0 {
+		return nil, errors.NewError("nothing to update", 400)
+	}
+	if name, ok := set["name"].(string); ok && name != oldcategory.Name {
+		exists, err := cs.categoryRepo.IsExists(bson.M{"name": name, "_id": bson.M{"$ne": objectID}})
+		if err != nil {
+			return nil, errors.ErrInternalServer
+		}
+		if exists {
+			return nil, errors.ErrCategoryAlreadyExists
+		}
+	}
+	set["updated_by"] = userid
+	set["updated_at"] = time.Now()
+
+	filter := utils.WithVersion(bson.M{"_id": objectID}, version)
+	update := bson.M{"$set": set, "$inc": bson.M{"version": 1}}
+	var updated *Category
+	save := func() error {
+		updated, err = cs.categoryRepo.FindOneAndUpdateCategory(filter, update, options.FindOneAndUpdate().SetReturnDocument(options.After))
+		return err
+	}
+	name, _ := set["name"].(string)
+	if base := slug.Make(name); name == "" || base == slug.Make(oldcategory.Name) {
+		err = save()
+	} else {
+		_, err = utils.SaveWithUniqueSlug(base, func(slug string) error {
+			set["slug"] = slug
+			set["slug_history"] = utils.SlugHistory(oldcategory.SlugHistory, oldcategory.Slug, slug)
+			return save()
+		})
+	}
+	if err == mongo.ErrNoDocuments {
+		return nil, errors.ErrVersionConflict
+	}
+	if err != nil {
+		return nil, errors.ErrInternalServer
+	}
+	cs.invalidateCache()
+	cs.notify(oldcategory, updated)
+	return updated, nil
+}
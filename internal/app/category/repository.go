@@ -1,6 +1,8 @@
 package category
 
 import (
+	"context"
+
 	"github.com/ayo-ajayi/ecommerce/internal/database"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
@@ -44,6 +46,32 @@ func (cr *CategoryRepo) UpdateCategory(filter interface{}, update interface{}, o
 	return err
 }
 
+func (cr *CategoryRepo) UpdateCategories(filter interface{}, update interface{}, opts ...*options.UpdateOptions) error {
+	ctx, cancel := database.DBReqContext(5)
+	defer cancel()
+	_, err := cr.Collection.UpdateMany(ctx, filter, update, opts...)
+	return err
+}
+
+// UpdateCategoriesTx is UpdateCategories as part of the transaction ctx belongs to
+func (cr *CategoryRepo) UpdateCategoriesTx(ctx context.Context, filter interface{}, update interface{}) error {
+	_, err := cr.Collection.UpdateMany(ctx, filter, update)
+	return err
+}
+
+// FindOneAndUpdateCategory applies update to the first matching category and returns it.
+// It returns mongo.ErrNoDocuments when nothing matched, which makes it usable for guarded updates.
+func (cr *CategoryRepo) FindOneAndUpdateCategory(filter interface{}, update interface{}, opts ...*options.FindOneAndUpdateOptions) (*Category, error) {
+	ctx, cancel := database.DBReqContext(5)
+	defer cancel()
+	var category Category
+	err := cr.Collection.FindOneAndUpdate(ctx, filter, update, opts...).Decode(&category)
+	if err != nil {
+		return nil, err
+	}
+	return &category, nil
+}
+
 func (cr *CategoryRepo) GetCategory(filter interface{}, opts ...*options.FindOneOptions) (*Category, error) {
 	ctx, cancel := database.DBReqContext(5)
 	defer cancel()
@@ -76,3 +104,32 @@ func (cr *CategoryRepo) DeleteCategory(filter interface{}, opts ...*options.Dele
 	_, err := cr.Collection.DeleteOne(ctx, filter, opts...)
 	return err
 }
+
+// DeleteCategoryTx is DeleteCategory as part of the transaction ctx belongs to
+func (cr *CategoryRepo) DeleteCategoryTx(ctx context.Context, filter interface{}) error {
+	_, err := cr.Collection.DeleteOne(ctx, filter)
+	return err
+}
+
+type DeletedCategoryRepo struct {
+	Collection *mongo.Collection
+}
+
+func NewDeletedCategoryRepo(collection *mongo.Collection) *DeletedCategoryRepo {
+	return &DeletedCategoryRepo{
+		Collection: collection,
+	}
+}
+
+func (dr *DeletedCategoryRepo) CreateDeletedCategory(deletedCategory *DeletedCategory) error {
+	ctx, cancel := database.DBReqContext(5)
+	defer cancel()
+	_, err := dr.Collection.InsertOne(ctx, deletedCategory)
+	return err
+}
+
+// CreateDeletedCategoryTx is CreateDeletedCategory as part of the transaction ctx belongs to
+func (dr *DeletedCategoryRepo) CreateDeletedCategoryTx(ctx context.Context, deletedCategory *DeletedCategory) error {
+	_, err := dr.Collection.InsertOne(ctx, deletedCategory)
+	return err
+}
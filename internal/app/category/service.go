@@ -1,11 +1,14 @@
 package category
 
 import (
-	"sync"
+	"context"
 	"time"
 
+	"github.com/ayo-ajayi/ecommerce/internal/constants"
 	"github.com/ayo-ajayi/ecommerce/internal/errors"
+	"github.com/ayo-ajayi/ecommerce/internal/utils"
 	"github.com/gosimple/slug"
+	"github.com/redis/go-redis/v9"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -13,12 +16,23 @@ import (
 )
 
 type CategoryService struct {
-	categoryRepo CategoryRepository
+	categoryRepo        CategoryRepository
+	deletedCategoryRepo DeletedCategoryRepository
+	itemRepo            ItemRepository
+	transactor          Transactor
+	redisClient         *redis.Client
+	maxDepth            int
+	hooks               []CategoryHook
 }
 
-func NewCategoryService(categoryRepo CategoryRepository) *CategoryService {
+func NewCategoryService(categoryRepo CategoryRepository, deletedCategoryRepo DeletedCategoryRepository, itemRepo ItemRepository, transactor Transactor, redisClient *redis.Client, maxDepth int) *CategoryService {
 	return &CategoryService{
-		categoryRepo: categoryRepo,
+		categoryRepo:        categoryRepo,
+		deletedCategoryRepo: deletedCategoryRepo,
+		itemRepo:            itemRepo,
+		transactor:          transactor,
+		redisClient:         redisClient,
+		maxDepth:            maxDepth,
 	}
 }
 
@@ -26,15 +40,47 @@ type CategoryRepository interface {
 	IsExists(filter interface{}, opts ...*options.FindOneOptions) (bool, error)
 	CreateCategory(category *Category) error
 	UpdateCategory(filter interface{}, update interface{}, opts ...*options.UpdateOptions) error
+	UpdateCategoriesTx(ctx context.Context, filter interface{}, update interface{}) error
+	FindOneAndUpdateCategory(filter interface{}, update interface{}, opts ...*options.FindOneAndUpdateOptions) (*Category, error)
 	GetCategory(filter interface{}, opts ...*options.FindOneOptions) (*Category, error)
 	GetCategories(filter interface{}, opts ...*options.FindOptions) ([]*Category, error)
-	DeleteCategory(filter interface{}, opts ...*options.DeleteOptions) error
+	DeleteCategoryTx(ctx context.Context, filter interface{}) error
+}
+
+// CategoryHook is told about each category change once it is saved. old is nil for a new
+// category and category is nil for a deleted one.
+type CategoryHook interface {
+	CategoryChanged(old, category *Category)
+}
+
+type DeletedCategoryRepository interface {
+	CreateDeletedCategoryTx(ctx context.Context, deletedCategory *DeletedCategory) error
+}
+
+// ItemRepository moves items out of deleted categories
+type ItemRepository interface {
+	UpdateItems(filter interface{}, update interface{}, opts ...*options.UpdateOptions) error
+	UpdateItemsTx(ctx context.Context, filter interface{}, update interface{}) error
+	Aggregate(pipeline interface{}, result interface{}) error
+}
+
+type Transactor interface {
+	WithTransaction(fn func(ctx context.Context) error) error
+}
+
+// AddHook registers a hook to be told about category changes
+func (cs *CategoryService) AddHook(hook CategoryHook) {
+	cs.hooks = append(cs.hooks, hook)
+}
+
+func (cs *CategoryService) notify(old, category *Category) {
+	for _, v := range cs.hooks {
+		v.CategoryChanged(old, category)
+	}
 }
 
 func (cs *CategoryService) CreateCategory(category *Category) *errors.AppError {
-	category.Slug = slug.Make(category.Name)
 	categoryExists, err := cs.categoryRepo.IsExists(bson.M{
-		"slug": category.Slug,
 		"name": category.Name,
 	})
 	if err != nil {
@@ -45,13 +91,22 @@ func (cs *CategoryService) CreateCategory(category *Category) *errors.AppError {
 	}
 	category.CreatedAt = time.Now()
 	category.UpdatedAt = time.Now()
+	category.Version = 1
 
-	if err := cs.checkParentID(category.ParentID); err != nil {
+	if err := ValidateAttributeSchemas(category.Attributes); err != nil {
+		return err
+	}
+	if err := cs.checkHierarchy(primitive.NilObjectID, category.ParentID); err != nil {
 		return err
 	}
-	if err := cs.categoryRepo.CreateCategory(category); err != nil {
+	if _, err := utils.SaveWithUniqueSlug(slug.Make(category.Name), func(slug string) error {
+		category.Slug = slug
+		return cs.categoryRepo.CreateCategory(category)
+	}); err != nil {
 		return errors.NewError("internal error: "+err.Error(), 500)
 	}
+	cs.invalidateCache()
+	cs.notify(nil, category)
 	return nil
 }
 
@@ -73,11 +128,15 @@ func (cs *CategoryService) GetCategoryByID(id string) (*Category, *errors.AppErr
 	return category, nil
 }
 
+// GetCategoryBySlug finds the category by its current slug or, failing that, by a slug it had before.
+// Callers can tell the two apart by comparing slug with the returned category's Slug.
 func (cs *CategoryService) GetCategoryBySlug(slug string) (*Category, *errors.AppError) {
-
 	category, err := cs.categoryRepo.GetCategory(bson.M{
 		"slug": slug,
 	})
+	if err == mongo.ErrNoDocuments {
+		category, err = cs.categoryRepo.GetCategory(bson.M{"slug_history": slug}, options.FindOne().SetSort(bson.D{{Key: "updated_at", Value: -1}}))
+	}
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
 			err := errors.ErrNotFound
@@ -89,13 +148,10 @@ func (cs *CategoryService) GetCategoryBySlug(slug string) (*Category, *errors.Ap
 }
 
 func (cs *CategoryService) GetCategories() ([]*Category, *errors.AppError) {
-	categories, err := cs.categoryRepo.GetCategories(bson.M{})
-	if err != nil {
-		return nil, errors.ErrInternalServer
-	}
-	return categories, nil
+	return cs.allCategories()
 }
 
+// UpdateCategory replaces the category with category, but only if it is still at category.Version
 func (cs *CategoryService) UpdateCategory(category *Category) *errors.AppError {
 	oldcategory, err := cs.categoryRepo.GetCategory(bson.M{
 		"_id": category.ID,
@@ -107,17 +163,21 @@ func (cs *CategoryService) UpdateCategory(category *Category) *errors.AppError {
 		}
 		return errors.ErrInternalServer
 	}
+	if oldcategory.Version != category.Version {
+		return errors.ErrVersionConflict
+	}
 	if category.ParentID != nil {
-		if err := cs.checkParentID(category.ParentID); err != nil {
+		if err := cs.checkHierarchy(category.ID, category.ParentID); err != nil {
 			return err
 		}
 	}
+	if err := ValidateAttributeSchemas(category.Attributes); err != nil {
+		return err
+	}
 	category.UpdatedAt = time.Now()
 	category.CreatedBy = oldcategory.CreatedBy
 	category.CreatedAt = oldcategory.CreatedAt
-	category.Slug = slug.Make(category.Name)
 	getCategory, err := cs.categoryRepo.GetCategory(bson.M{
-		"slug": category.Slug,
 		"name": category.Name,
 	})
 	if err != nil && err != mongo.ErrNoDocuments {
@@ -126,72 +186,284 @@ func (cs *CategoryService) UpdateCategory(category *Category) *errors.AppError {
 	if getCategory != nil && getCategory.ID != category.ID {
 		return errors.ErrCategoryAlreadyExists
 	}
-	if err := cs.categoryRepo.UpdateCategory(bson.M{
-		"_id": category.ID,
-	}, bson.M{
-		"$set": category,
-	}); err != nil {
+	return cs.saveCategory(category, oldcategory)
+}
+
+// saveCategory replaces oldcategory with category unless it is no longer at the version category was
+// made against. The slug only changes when the name does, and the old slug is kept in the slug history
+// so existing links keep working.
+func (cs *CategoryService) saveCategory(category, oldcategory *Category) *errors.AppError {
+	filter := utils.WithVersion(bson.M{"_id": oldcategory.ID}, category.Version)
+	category.Version++
+	save := func() error {
+		_, err := cs.categoryRepo.FindOneAndUpdateCategory(filter, bson.M{"$set": category})
+		return err
+	}
+	var err error
+	if base := slug.Make(category.Name); base == slug.Make(oldcategory.Name) {
+		category.Slug = oldcategory.Slug
+		category.SlugHistory = oldcategory.SlugHistory
+		err = save()
+	} else {
+		_, err = utils.SaveWithUniqueSlug(base, func(slug string) error {
+			category.Slug = slug
+			category.SlugHistory = utils.SlugHistory(oldcategory.SlugHistory, oldcategory.Slug, slug)
+			return save()
+		})
+	}
+	if err == mongo.ErrNoDocuments {
+		return errors.ErrVersionConflict
+	}
+	if err != nil {
 		return errors.NewError("internal error: "+err.Error(), 500)
 	}
+	cs.invalidateCache()
+	cs.notify(oldcategory, category)
 	return nil
 }
 
-func (cs *CategoryService) DeleteCategory(id string, userid primitive.ObjectID) *errors.AppError {
+// DeleteCategory deletes the category and removes it from its items and child categories. When
+// reassignTo is given they are moved to that category instead. Items left without any category are
+// moved to the default category, and a copy of the deleted category is kept with who deleted it.
+// All of it happens in one transaction, so a failed delete can simply be retried.
+func (cs *CategoryService) DeleteCategory(id string, userid primitive.ObjectID, reassignTo string) *errors.AppError {
 	objectID, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
 		return errors.ErrInvalidObjectID
 	}
-	category, err := cs.categoryRepo.IsExists(bson.M{
+	category, err := cs.categoryRepo.GetCategory(bson.M{
 		"_id": objectID,
 	})
 	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			err := errors.ErrNotFound
+			return errors.NewError("category not found: "+err.Error(), err.StatusCode)
+		}
 		return errors.NewError("internal error: "+err.Error(), 500)
 	}
-	if !category {
-		err := errors.ErrNotFound
-		return errors.NewError("category not found: "+err.Error(), err.StatusCode)
+	if category.IsDefault {
+		return errors.NewError("the default category cannot be deleted", 400)
 	}
-	if err := cs.categoryRepo.DeleteCategory(bson.M{"_id": objectID}); err != nil {
+	var reassignID *primitive.ObjectID
+	if reassignTo != "" {
+		targetID, err := primitive.ObjectIDFromHex(reassignTo)
+		if err != nil {
+			return errors.NewError("invalid reassign_to", 400)
+		}
+		if err := cs.checkReassignment(objectID, targetID); err != nil {
+			return err
+		}
+		if err := cs.checkReassignedItems(objectID, targetID); err != nil {
+			return err
+		}
+		reassignID = &targetID
+	}
+	defaultCategory, err := cs.categoryRepo.GetCategory(bson.M{"is_default": true})
+	if err != nil && err != mongo.ErrNoDocuments {
 		return errors.NewError("internal error: "+err.Error(), 500)
 	}
 
-	//create_deleted category collection
-	//use {deleted_by: userid} to add item to deleted category list
-	//remove the category from all the items and all categories that have this category as parent
+	now := time.Now()
+	err = cs.transactor.WithTransaction(func(ctx context.Context) error {
+		if err := cs.deletedCategoryRepo.CreateDeletedCategoryTx(ctx, &DeletedCategory{
+			Category:     *category,
+			ReassignedTo: reassignID,
+			DeletedBy:    userid,
+			DeletedAt:    now,
+		}); err != nil {
+			return err
+		}
+		if reassignID != nil {
+			// $addToSet and $pull cannot change the same field in one update
+			if err := cs.itemRepo.UpdateItemsTx(ctx, bson.M{"category_id": objectID}, bson.M{"$addToSet": bson.M{"category_id": *reassignID}}); err != nil {
+				return err
+			}
+			if err := cs.categoryRepo.UpdateCategoriesTx(ctx, bson.M{"parent_id": objectID}, bson.M{"$addToSet": bson.M{"parent_id": *reassignID}}); err != nil {
+				return err
+			}
+		}
+		if err := cs.itemRepo.UpdateItemsTx(ctx, bson.M{"category_id": objectID}, bson.M{
+			"$pull": bson.M{"category_id": objectID},
+			"$set":  bson.M{"updated_at": now},
+			"$inc":  bson.M{"version": 1},
+		}); err != nil {
+			return err
+		}
+		if err := cs.categoryRepo.UpdateCategoriesTx(ctx, bson.M{"parent_id": objectID}, bson.M{
+			"$pull": bson.M{"parent_id": objectID},
+			"$set":  bson.M{"updated_at": now, "updated_by": userid},
+			"$inc":  bson.M{"version": 1},
+		}); err != nil {
+			return err
+		}
+		if err := cs.categoryRepo.DeleteCategoryTx(ctx, bson.M{"_id": objectID}); err != nil {
+			return err
+		}
+		if defaultCategory == nil {
+			return nil
+		}
+		filter, update := orphanedItems(defaultCategory.ID, now)
+		return cs.itemRepo.UpdateItemsTx(ctx, filter, update)
+	})
+	if err != nil {
+		return errors.NewError("internal error: "+err.Error(), 500)
+	}
+	cs.invalidateCache()
+	cs.notify(category, nil)
 	return nil
 }
 
-func (cs *CategoryService) checkParentID(parentID []primitive.ObjectID) *errors.AppError {
-	var wg sync.WaitGroup
-	idExistChanErr := make(chan *errors.AppError, len(parentID))
-	var allErrors []*errors.AppError
-	for _, v := range parentID {
-		wg.Add(1)
-		go func(parentId primitive.ObjectID) {
-			exists, err := cs.categoryRepo.IsExists(bson.M{
-				"_id": parentId,
-			})
-			if err != nil {
-				idExistChanErr <- errors.NewError("internal error: "+err.Error(), 500)
-			}
-			if !exists {
-				err := errors.ErrNotFound
-				idExistChanErr <- errors.NewError("category not found: "+err.Error(), err.StatusCode)
+// checkReassignedItems checks that the attributes of every item in the deleted category still match
+// the attribute schemas of the item's categories once it is moved to the target
+func (cs *CategoryService) checkReassignedItems(deletedID, targetID primitive.ObjectID) *errors.AppError {
+	var items []struct {
+		ID         primitive.ObjectID     `bson:"_id"`
+		CategoryID []primitive.ObjectID   `bson:"category_id"`
+		Attributes map[string]interface{} `bson:"attributes"`
+	}
+	if err := cs.itemRepo.Aggregate(mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"category_id": deletedID}}},
+		{{Key: "$project", Value: bson.M{"category_id": 1, "attributes": 1}}},
+	}, &items); err != nil {
+		return errors.NewError("internal error: "+err.Error(), 500)
+	}
+	if len(items) == 0 {
+		return nil
+	}
+	ids := []primitive.ObjectID{targetID}
+	for _, v := range items {
+		ids = append(ids, v.CategoryID...)
+	}
+	categories, err := cs.categoryRepo.GetCategories(bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return errors.NewError("internal error: "+err.Error(), 500)
+	}
+	byID := make(map[primitive.ObjectID]*Category, len(categories))
+	for _, v := range categories {
+		byID[v.ID] = v
+	}
+	for _, v := range items {
+		moved := []*Category{byID[targetID]}
+		for _, id := range v.CategoryID {
+			if c, ok := byID[id]; ok && id != deletedID && id != targetID {
+				moved = append(moved, c)
 			}
-			wg.Done()
-		}(v)
-		go func() {
-			wg.Wait()
-			close(idExistChanErr)
-		}()
-		for err := range idExistChanErr {
-			if err != nil {
-				allErrors = append(allErrors, err)
+		}
+		if _, err := NormalizeAttributes(moved, v.Attributes); err != nil {
+			return errors.NewError("item "+v.ID.Hex()+" cannot be moved to the category: "+err.Error(), err.StatusCode)
+		}
+	}
+	return nil
+}
+
+// checkReassignment reports whether the items and children of the deleted category can be moved
+// to the target: it must exist, must not be below the deleted category and the moved children
+// must stay within the maximum depth
+func (cs *CategoryService) checkReassignment(deletedID, targetID primitive.ObjectID) *errors.AppError {
+	if targetID == deletedID {
+		return errors.NewError("cannot reassign to the category being deleted", 400)
+	}
+	categories, err := cs.categoryRepo.GetCategories(bson.M{})
+	if err != nil {
+		return errors.NewError("internal error: "+err.Error(), 500)
+	}
+	g := newCategoryGraph(categories)
+	if _, ok := g.byID[targetID]; !ok {
+		err := errors.ErrNotFound
+		return errors.NewError("category to reassign to not found: "+err.Error(), err.StatusCode)
+	}
+	for _, v := range g.descendants([]primitive.ObjectID{deletedID}) {
+		if v == targetID {
+			return errors.NewError("cannot reassign to a category below the one being deleted", 400)
+		}
+	}
+
+	proposed := make([]*Category, 0, len(categories))
+	var children []primitive.ObjectID
+	for _, v := range categories {
+		if v.ID == deletedID {
+			continue
+		}
+		moved := false
+		parentID := make([]primitive.ObjectID, 0, len(v.ParentID)+1)
+		for _, p := range v.ParentID {
+			if p == deletedID {
+				moved = true
+			} else if p != targetID {
+				parentID = append(parentID, p)
 			}
 		}
+		if moved {
+			parentID = append(parentID, targetID)
+			children = append(children, v.ID)
+		}
+		c := *v
+		c.ParentID = parentID
+		proposed = append(proposed, &c)
 	}
-	if len(allErrors) > 0 {
-		return allErrors[0]
+	g = newCategoryGraph(proposed)
+	for _, v := range children {
+		if g.depth(v, map[primitive.ObjectID]bool{})+g.height(v, map[primitive.ObjectID]bool{})-1 > cs.maxDepth {
+			return errors.NewError("category hierarchy cannot be deeper than the maximum depth", 400)
+		}
+	}
+	return nil
+}
+
+// reassignOrphanedItems moves items without any category to the default category
+func (cs *CategoryService) reassignOrphanedItems() *errors.AppError {
+	defaultCategory, err := cs.categoryRepo.GetCategory(bson.M{"is_default": true})
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil
+		}
+		return errors.NewError("internal error: "+err.Error(), 500)
+	}
+	if err := cs.itemRepo.UpdateItems(orphanedItems(defaultCategory.ID, time.Now())); err != nil {
+		return errors.NewError("internal error: "+err.Error(), 500)
+	}
+	return nil
+}
+
+// orphanedItems returns the filter and update that move items without any category to the default category
+func orphanedItems(defaultID primitive.ObjectID, now time.Time) (filter, update bson.M) {
+	filter = bson.M{"$or": bson.A{
+		bson.M{"category_id": bson.M{"$exists": false}},
+		bson.M{"category_id": bson.M{"$size": 0}},
+	}}
+	update = bson.M{
+		"$set": bson.M{"category_id": []primitive.ObjectID{defaultID}, "updated_at": now},
+		"$inc": bson.M{"version": 1},
+	}
+	return filter, update
+}
+
+// SeedDefaultCategory creates the default category unless there is one already, and moves any
+// items without a category into it
+func (cs *CategoryService) SeedDefaultCategory() error {
+	exists, err := cs.categoryRepo.IsExists(bson.M{"is_default": true})
+	if err != nil {
+		return err
+	}
+	if !exists {
+		now := time.Now()
+		if err := cs.categoryRepo.UpdateCategory(bson.M{"name": constants.DefaultCategoryName}, bson.M{
+			"$set": bson.M{"is_default": true},
+			"$setOnInsert": bson.M{
+				"slug":        slug.Make(constants.DefaultCategoryName),
+				"description": "Items without a category",
+				"images":      []string{},
+				"version":     int64(1),
+				"created_at":  now,
+				"updated_at":  now,
+			},
+		}, options.Update().SetUpsert(true)); err != nil {
+			return err
+		}
+		cs.invalidateCache()
+	}
+	if err := cs.reassignOrphanedItems(); err != nil {
+		return err
 	}
 	return nil
 }
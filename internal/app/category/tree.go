@@ -0,0 +1,212 @@
+package category
+
+import (
+	"encoding/json"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/ayo-ajayi/ecommerce/internal/constants"
+	"github.com/ayo-ajayi/ecommerce/internal/database"
+	"github.com/ayo-ajayi/ecommerce/internal/errors"
+	"github.com/redis/go-redis/v9"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const categoriesCacheKey = "categories:all"
+
+// CategoryNode is a category in the category tree. A category with several parents
+// appears under each of them.
+type CategoryNode struct {
+	ID       primitive.ObjectID `json:"id"`
+	Name     string             `json:"name"`
+	Slug     string             `json:"slug"`
+	Children []*CategoryNode    `json:"children"`
+}
+
+// categoryGraph indexes every category by id and by parent
+type categoryGraph struct {
+	byID     map[primitive.ObjectID]*Category
+	children map[primitive.ObjectID][]*Category
+	roots    []*Category
+}
+
+func newCategoryGraph(categories []*Category) *categoryGraph {
+	g := &categoryGraph{
+		byID:     make(map[primitive.ObjectID]*Category, len(categories)),
+		children: make(map[primitive.ObjectID][]*Category),
+	}
+	sort.Slice(categories, func(i, j int) bool { return categories[i].Name < categories[j].Name })
+	for _, v := range categories {
+		g.byID[v.ID] = v
+	}
+	for _, v := range categories {
+		// parents that no longer exist are ignored, so such categories surface as roots
+		hasParent := false
+		for _, p := range v.ParentID {
+			if _, ok := g.byID[p]; ok {
+				g.children[p] = append(g.children[p], v)
+				hasParent = true
+			}
+		}
+		if !hasParent {
+			g.roots = append(g.roots, v)
+		}
+	}
+	return g
+}
+
+// node builds the subtree under c. path holds the categories above c so a cycle in the data
+// cannot make the walk loop forever.
+func (g *categoryGraph) node(c *Category, path map[primitive.ObjectID]bool) *CategoryNode {
+	n := &CategoryNode{ID: c.ID, Name: c.Name, Slug: c.Slug, Children: []*CategoryNode{}}
+	path[c.ID] = true
+	for _, child := range g.children[c.ID] {
+		if !path[child.ID] {
+			n.Children = append(n.Children, g.node(child, path))
+		}
+	}
+	delete(path, c.ID)
+	return n
+}
+
+// descendants returns the ids and every category below them, each once
+func (g *categoryGraph) descendants(ids []primitive.ObjectID) []primitive.ObjectID {
+	seen := make(map[primitive.ObjectID]bool)
+	var result []primitive.ObjectID
+	queue := append([]primitive.ObjectID{}, ids...)
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		result = append(result, id)
+		for _, child := range g.children[id] {
+			queue = append(queue, child.ID)
+		}
+	}
+	return result
+}
+
+// paths returns every path from a root down to the category
+func (g *categoryGraph) paths(c *Category, below map[primitive.ObjectID]bool) [][]*Category {
+	below[c.ID] = true
+	defer delete(below, c.ID)
+	var paths [][]*Category
+	for _, p := range c.ParentID {
+		parent, ok := g.byID[p]
+		if !ok || below[p] {
+			continue
+		}
+		for _, path := range g.paths(parent, below) {
+			paths = append(paths, append(path, c))
+		}
+	}
+	if len(paths) == 0 {
+		paths = [][]*Category{{c}}
+	}
+	return paths
+}
+
+// allCategories returns every category, from the cache when it is warm
+func (cs *CategoryService) allCategories() ([]*Category, *errors.AppError) {
+	ctx, cancel := database.DBReqContext(5)
+	defer cancel()
+	if cached, err := cs.redisClient.Get(ctx, categoriesCacheKey).Result(); err == nil {
+		var categories []*Category
+		if err := json.Unmarshal([]byte(cached), &categories); err == nil {
+			return categories, nil
+		}
+	} else if err != redis.Nil {
+		log.Println("failed to read categories cache: " + err.Error())
+	}
+	categories, err := cs.categoryRepo.GetCategories(bson.M{})
+	if err != nil {
+		return nil, errors.ErrInternalServer
+	}
+	if data, err := json.Marshal(categories); err == nil {
+		if err := cs.redisClient.Set(ctx, categoriesCacheKey, data, time.Minute*time.Duration(constants.CategoryCacheValidityInMins)).Err(); err != nil {
+			log.Println("failed to cache categories: " + err.Error())
+		}
+	}
+	return categories, nil
+}
+
+// invalidateCache drops the cached categories after any change to them
+func (cs *CategoryService) invalidateCache() {
+	ctx, cancel := database.DBReqContext(5)
+	defer cancel()
+	if err := cs.redisClient.Del(ctx, categoriesCacheKey).Err(); err != nil {
+		log.Println("failed to invalidate categories cache: " + err.Error())
+	}
+}
+
+func (cs *CategoryService) graph() (*categoryGraph, *errors.AppError) {
+	categories, err := cs.allCategories()
+	if err != nil {
+		return nil, err
+	}
+	return newCategoryGraph(categories), nil
+}
+
+func (cs *CategoryService) GetCategoryTree() ([]*CategoryNode, *errors.AppError) {
+	g, err := cs.graph()
+	if err != nil {
+		return nil, err
+	}
+	tree := make([]*CategoryNode, 0, len(g.roots))
+	for _, v := range g.roots {
+		tree = append(tree, g.node(v, map[primitive.ObjectID]bool{}))
+	}
+	return tree, nil
+}
+
+func (cs *CategoryService) GetChildren(id string) ([]*Category, *errors.AppError) {
+	g, categoryID, err := cs.graphWith(id)
+	if err != nil {
+		return nil, err
+	}
+	children := g.children[categoryID]
+	if children == nil {
+		children = []*Category{}
+	}
+	return children, nil
+}
+
+// GetBreadcrumbs returns the paths from the top of the hierarchy down to the category,
+// one for each way it can be reached through its parents
+func (cs *CategoryService) GetBreadcrumbs(id string) ([][]*Category, *errors.AppError) {
+	g, categoryID, err := cs.graphWith(id)
+	if err != nil {
+		return nil, err
+	}
+	return g.paths(g.byID[categoryID], map[primitive.ObjectID]bool{}), nil
+}
+
+// Descendants returns the categories and every category below them
+func (cs *CategoryService) Descendants(ids []primitive.ObjectID) ([]primitive.ObjectID, *errors.AppError) {
+	g, err := cs.graph()
+	if err != nil {
+		return nil, err
+	}
+	return g.descendants(ids), nil
+}
+
+func (cs *CategoryService) graphWith(id string) (*categoryGraph, primitive.ObjectID, *errors.AppError) {
+	categoryID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, primitive.NilObjectID, errors.ErrInvalidObjectID
+	}
+	g, appErr := cs.graph()
+	if appErr != nil {
+		return nil, primitive.NilObjectID, appErr
+	}
+	if _, ok := g.byID[categoryID]; !ok {
+		err := errors.ErrNotFound
+		return nil, primitive.NilObjectID, errors.NewError("category not found: "+err.Error(), err.StatusCode)
+	}
+	return g, categoryID, nil
+}
@@ -0,0 +1,47 @@
+package collection
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Collection is a curated list of items that can cut across categories. Its items are either
+// picked by hand, in order, or matched by its rules. A collection with a schedule is only shown
+// between StartsAt and EndsAt.
+type Collection struct {
+	ID          primitive.ObjectID   `json:"id" bson:"_id,omitempty"`
+	Name        string               `json:"name" bson:"name"`
+	Description string               `json:"description" bson:"description"`
+	CoverImage  string               `json:"cover_image" bson:"cover_image,omitempty"`
+	ItemID      []primitive.ObjectID `json:"item_id,omitempty" bson:"item_id,omitempty"`
+	Rules       *Rules               `json:"rules,omitempty" bson:"rules,omitempty"`
+	StartsAt    *time.Time           `json:"starts_at,omitempty" bson:"starts_at,omitempty"`
+	EndsAt      *time.Time           `json:"ends_at,omitempty" bson:"ends_at,omitempty"`
+	CreatedBy   primitive.ObjectID   `json:"created_by" bson:"created_by,omitempty"`
+	UpdatedBy   primitive.ObjectID   `json:"updated_by" bson:"updated_by,omitempty"`
+	CreatedAt   time.Time            `json:"created_at" bson:"created_at"`
+	UpdatedAt   time.Time            `json:"updated_at" bson:"updated_at"`
+}
+
+// Rules match items by category (including the categories below it), tag, list price and
+// permanent discount. An item must match every rule that is set, and any of the listed
+// categories or tags.
+type Rules struct {
+	CategoryID  []primitive.ObjectID `json:"category_id,omitempty" bson:"category_id,omitempty"`
+	Tags        []string             `json:"tags,omitempty" bson:"tags,omitempty"`
+	MinPrice    float64              `json:"min_price,omitempty" bson:"min_price,omitempty"`
+	MaxPrice    float64              `json:"max_price,omitempty" bson:"max_price,omitempty"`
+	MinDiscount float64              `json:"min_discount,omitempty" bson:"min_discount,omitempty"`
+}
+
+func (c *Collection) IsRuleBased() bool {
+	return c.Rules != nil
+}
+
+func (c *Collection) IsLive(at time.Time) bool {
+	if c.StartsAt != nil && at.Before(*c.StartsAt) {
+		return false
+	}
+	return c.EndsAt == nil || at.Before(*c.EndsAt)
+}
@@ -0,0 +1,170 @@
+package collection
+
+import (
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"time"
+
+	"github.com/ayo-ajayi/ecommerce/internal/app/item"
+	"github.com/ayo-ajayi/ecommerce/internal/errors"
+	"github.com/ayo-ajayi/ecommerce/internal/types"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type CollectionController struct {
+	collectionServices CollectionServices
+}
+
+type CollectionServices interface {
+	CreateCollection(collection *Collection, coverImage *multipart.FileHeader) *errors.AppError
+	UpdateCollection(collection *Collection, coverImage *multipart.FileHeader) *errors.AppError
+	DeleteCollection(id string) *errors.AppError
+	GetCollection(id string, liveOnly bool) (*Collection, *errors.AppError)
+	GetCollections(liveOnly bool) ([]*Collection, *errors.AppError)
+	GetCollectionItems(id string, pagination *types.Pagination, liveOnly bool) ([]*item.Item, *errors.AppError)
+}
+
+func NewCollectionController(collectionServices CollectionServices) *CollectionController {
+	return &CollectionController{
+		collectionServices: collectionServices,
+	}
+}
+
+func (cc *CollectionController) CreateCollection(c *gin.Context) {
+	userid := c.MustGet("userId").(primitive.ObjectID)
+	if userid.IsZero() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": "invalid user"}})
+		return
+	}
+	collection, coverImage, err := cc.createCollection(c)
+	if err != nil {
+		c.JSON(err.StatusCode, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	collection.CreatedBy = userid
+	collection.UpdatedBy = userid
+	if err := cc.collectionServices.CreateCollection(collection, coverImage); err != nil {
+		c.JSON(err.StatusCode, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	c.JSON(201, gin.H{"message": "collection created successfully", "data": gin.H{"collection": collection}})
+}
+
+func (cc *CollectionController) UpdateCollection(c *gin.Context) {
+	collectionID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": "invalid collection id"}})
+		return
+	}
+	userid := c.MustGet("userId").(primitive.ObjectID)
+	if userid.IsZero() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": "invalid user"}})
+		return
+	}
+	collection, coverImage, appErr := cc.createCollection(c)
+	if appErr != nil {
+		c.JSON(appErr.StatusCode, gin.H{"error": gin.H{"message": appErr.Error()}})
+		return
+	}
+	collection.ID = collectionID
+	collection.UpdatedBy = userid
+	if err := cc.collectionServices.UpdateCollection(collection, coverImage); err != nil {
+		c.JSON(err.StatusCode, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	c.JSON(200, gin.H{"message": "collection updated successfully", "data": gin.H{"collection": collection}})
+}
+
+// createCollection reads a collection and its cover image, if any, from a multipart form. Items are
+// picked with repeated item_id fields in order, or matched with a JSON rules field. The schedule is
+// given in RFC 3339.
+func (cc *CollectionController) createCollection(c *gin.Context) (*Collection, *multipart.FileHeader, *errors.AppError) {
+	if err := c.Request.ParseMultipartForm(10 << 20); err != nil {
+		return nil, nil, errors.NewError("file too large"+err.Error(), 400)
+	}
+	collection := &Collection{
+		Name:        c.PostForm("name"),
+		Description: c.PostForm("description"),
+	}
+	if collection.Name == "" {
+		return nil, nil, errors.NewError("invalid name", 400)
+	}
+	for _, v := range c.PostFormArray("item_id") {
+		itemID, err := primitive.ObjectIDFromHex(v)
+		if err != nil {
+			return nil, nil, errors.NewError("invalid item id", 400)
+		}
+		collection.ItemID = append(collection.ItemID, itemID)
+	}
+	if rules := c.PostForm("rules"); rules != "" {
+		collection.Rules = &Rules{}
+		if err := json.Unmarshal([]byte(rules), collection.Rules); err != nil {
+			return nil, nil, errors.NewError("invalid rules: "+err.Error(), 400)
+		}
+	}
+	for field, at := range map[string]**time.Time{"starts_at": &collection.StartsAt, "ends_at": &collection.EndsAt} {
+		if v := c.PostForm(field); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return nil, nil, errors.NewError("invalid "+field, 400)
+			}
+			*at = &t
+		}
+	}
+	var coverImage *multipart.FileHeader
+	if files := c.Request.MultipartForm.File["cover_image"]; len(files) > 0 {
+		coverImage = files[0]
+	}
+	return collection, coverImage, nil
+}
+
+func (cc *CollectionController) DeleteCollection(c *gin.Context) {
+	if err := cc.collectionServices.DeleteCollection(c.Param("id")); err != nil {
+		c.JSON(err.StatusCode, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	c.JSON(200, gin.H{"message": "collection deleted successfully"})
+}
+
+func (cc *CollectionController) GetCollection(c *gin.Context) {
+	collection, err := cc.collectionServices.GetCollection(c.Param("id"), true)
+	if err != nil {
+		c.JSON(err.StatusCode, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	c.JSON(200, gin.H{"data": gin.H{"collection": collection}})
+}
+
+func (cc *CollectionController) GetLiveCollections(c *gin.Context) {
+	collections, err := cc.collectionServices.GetCollections(true)
+	if err != nil {
+		c.JSON(err.StatusCode, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	c.JSON(200, gin.H{"data": gin.H{"collections": collections}})
+}
+
+func (cc *CollectionController) GetCollections(c *gin.Context) {
+	collections, err := cc.collectionServices.GetCollections(false)
+	if err != nil {
+		c.JSON(err.StatusCode, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	c.JSON(200, gin.H{"data": gin.H{"collections": collections}})
+}
+
+func (cc *CollectionController) GetCollectionItems(c *gin.Context) {
+	pagination, err := types.NewPagination(c.Query("page"), c.Query("limit"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	items, appErr := cc.collectionServices.GetCollectionItems(c.Param("id"), pagination, true)
+	if appErr != nil {
+		c.JSON(appErr.StatusCode, gin.H{"error": gin.H{"message": appErr.Error()}})
+		return
+	}
+	c.JSON(200, gin.H{"data": gin.H{"items": items, "pagination": pagination}})
+}
@@ -0,0 +1,63 @@
+package collection
+
+import (
+	"github.com/ayo-ajayi/ecommerce/internal/database"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type CollectionRepo struct {
+	Collection *mongo.Collection
+}
+
+func NewCollectionRepo(collection *mongo.Collection) *CollectionRepo {
+	return &CollectionRepo{
+		Collection: collection,
+	}
+}
+
+func (cr *CollectionRepo) CreateCollection(collection *Collection) error {
+	ctx, cancel := database.DBReqContext(5)
+	defer cancel()
+	_, err := cr.Collection.InsertOne(ctx, collection)
+	return err
+}
+
+func (cr *CollectionRepo) UpdateCollection(filter interface{}, update interface{}, opts ...*options.UpdateOptions) error {
+	ctx, cancel := database.DBReqContext(5)
+	defer cancel()
+	_, err := cr.Collection.UpdateOne(ctx, filter, update, opts...)
+	return err
+}
+
+func (cr *CollectionRepo) GetCollection(filter interface{}, opts ...*options.FindOneOptions) (*Collection, error) {
+	ctx, cancel := database.DBReqContext(5)
+	defer cancel()
+	var collection Collection
+	err := cr.Collection.FindOne(ctx, filter, opts...).Decode(&collection)
+	if err != nil {
+		return nil, err
+	}
+	return &collection, nil
+}
+
+func (cr *CollectionRepo) GetCollections(filter interface{}, opts ...*options.FindOptions) ([]*Collection, error) {
+	ctx, cancel := database.DBReqContext(5)
+	defer cancel()
+	var collections []*Collection
+	cursor, err := cr.Collection.Find(ctx, filter, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if err := cursor.All(ctx, &collections); err != nil {
+		return nil, err
+	}
+	return collections, nil
+}
+
+func (cr *CollectionRepo) DeleteCollection(filter interface{}, opts ...*options.DeleteOptions) error {
+	ctx, cancel := database.DBReqContext(5)
+	defer cancel()
+	_, err := cr.Collection.DeleteOne(ctx, filter, opts...)
+	return err
+}
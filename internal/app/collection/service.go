@@ -0,0 +1,368 @@
+package collection
+
+import (
+	"context"
+	"mime/multipart"
+	"time"
+
+	"github.com/ayo-ajayi/ecommerce/internal/app/category"
+	"github.com/ayo-ajayi/ecommerce/internal/app/item"
+	"github.com/ayo-ajayi/ecommerce/internal/errors"
+	"github.com/ayo-ajayi/ecommerce/internal/types"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type CollectionService struct {
+	collectionRepo CollectionRepository
+	itemRepo       ItemRepository
+	categoryRepo   CategoryRepository
+	categoryTree   CategoryTree
+	itemPreparer   ItemPreparer
+	uploader       Uploader
+}
+
+type CollectionRepository interface {
+	CreateCollection(collection *Collection) error
+	UpdateCollection(filter interface{}, update interface{}, opts ...*options.UpdateOptions) error
+	GetCollection(filter interface{}, opts ...*options.FindOneOptions) (*Collection, error)
+	GetCollections(filter interface{}, opts ...*options.FindOptions) ([]*Collection, error)
+	DeleteCollection(filter interface{}, opts ...*options.DeleteOptions) error
+}
+
+type ItemRepository interface {
+	GetItems(filter interface{}, opts ...*options.FindOptions) ([]*item.Item, error)
+	CountItems(filter interface{}) (int64, error)
+}
+
+type CategoryRepository interface {
+	GetCategories(filter interface{}, opts ...*options.FindOptions) ([]*category.Category, error)
+}
+
+// CategoryTree walks the category hierarchy
+type CategoryTree interface {
+	Descendants(ids []primitive.ObjectID) ([]primitive.ObjectID, *errors.AppError)
+}
+
+// ItemPreparer fills in an item's effective price and computed stock
+type ItemPreparer interface {
+	PrepareItems(items ...*item.Item) *errors.AppError
+}
+
+type Uploader interface {
+	UploadImage(ctx context.Context, files []*multipart.FileHeader, collection string) ([]string, *errors.AppError)
+	DeleteImageBySecureURL(ctx context.Context, secureUrl string) *errors.AppError
+}
+
+func NewCollectionService(collectionRepo CollectionRepository, itemRepo ItemRepository, categoryRepo CategoryRepository, categoryTree CategoryTree, itemPreparer ItemPreparer, uploader Uploader) *CollectionService {
+	return &CollectionService{
+		collectionRepo: collectionRepo,
+		itemRepo:       itemRepo,
+		categoryRepo:   categoryRepo,
+		categoryTree:   categoryTree,
+		itemPreparer:   itemPreparer,
+		uploader:       uploader,
+	}
+}
+
+// uploadCoverImage uploads the cover image, if there is one, once the collection is known to be valid
+func (cs *CollectionService) uploadCoverImage(collection *Collection, file *multipart.FileHeader) *errors.AppError {
+	if file == nil {
+		return nil
+	}
+	urls, err := cs.uploader.UploadImage(context.Background(), []*multipart.FileHeader{file}, "collections")
+	if err != nil {
+		return errors.NewError("failed to upload cover image: "+err.Error(), 400)
+	}
+	if len(urls) == 0 {
+		return errors.NewError("failed to upload cover image", 500)
+	}
+	collection.CoverImage = urls[0]
+	return nil
+}
+
+// CreateCollection saves the collection and uploads its cover image. The cover image is deleted
+// again if the collection cannot be saved.
+func (cs *CollectionService) CreateCollection(collection *Collection, coverImage *multipart.FileHeader) *errors.AppError {
+	if err := cs.validateCollection(collection); err != nil {
+		return err
+	}
+	if err := cs.uploadCoverImage(collection, coverImage); err != nil {
+		return err
+	}
+	collection.CreatedAt = time.Now()
+	collection.UpdatedAt = time.Now()
+	if err := cs.collectionRepo.CreateCollection(collection); err != nil {
+		if collection.CoverImage != "" {
+			cs.uploader.DeleteImageBySecureURL(context.Background(), collection.CoverImage)
+		}
+		return errors.NewError("internal error: "+err.Error(), 500)
+	}
+	return nil
+}
+
+// UpdateCollection replaces the collection. The cover image is kept unless a new one is given,
+// in which case the old one is deleted once the collection is saved.
+func (cs *CollectionService) UpdateCollection(collection *Collection, coverImage *multipart.FileHeader) *errors.AppError {
+	oldCollection, err := cs.collectionRepo.GetCollection(bson.M{"_id": collection.ID})
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			err := errors.ErrNotFound
+			return errors.NewError("collection not found: "+err.Error(), err.StatusCode)
+		}
+		return errors.ErrInternalServer
+	}
+	if err := cs.validateCollection(collection); err != nil {
+		return err
+	}
+	if err := cs.uploadCoverImage(collection, coverImage); err != nil {
+		return err
+	}
+	if collection.CoverImage == "" {
+		collection.CoverImage = oldCollection.CoverImage
+	}
+	collection.CreatedBy = oldCollection.CreatedBy
+	collection.CreatedAt = oldCollection.CreatedAt
+	collection.UpdatedAt = time.Now()
+	// a collection switches between picked items and rules, and can lose its schedule
+	unset := bson.M{}
+	if collection.ItemID == nil {
+		unset["item_id"] = ""
+	}
+	if collection.Rules == nil {
+		unset["rules"] = ""
+	}
+	if collection.StartsAt == nil {
+		unset["starts_at"] = ""
+	}
+	if collection.EndsAt == nil {
+		unset["ends_at"] = ""
+	}
+	update := bson.M{"$set": collection}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+	if err := cs.collectionRepo.UpdateCollection(bson.M{"_id": collection.ID}, update); err != nil {
+		if collection.CoverImage != oldCollection.CoverImage {
+			cs.uploader.DeleteImageBySecureURL(context.Background(), collection.CoverImage)
+		}
+		return errors.NewError("internal error: "+err.Error(), 500)
+	}
+	if oldCollection.CoverImage != "" && oldCollection.CoverImage != collection.CoverImage {
+		cs.uploader.DeleteImageBySecureURL(context.Background(), oldCollection.CoverImage)
+	}
+	return nil
+}
+
+func (cs *CollectionService) DeleteCollection(id string) *errors.AppError {
+	collection, appErr := cs.getCollection(id, false)
+	if appErr != nil {
+		return appErr
+	}
+	if err := cs.collectionRepo.DeleteCollection(bson.M{"_id": collection.ID}); err != nil {
+		return errors.NewError("internal error: "+err.Error(), 500)
+	}
+	if collection.CoverImage != "" {
+		cs.uploader.DeleteImageBySecureURL(context.Background(), collection.CoverImage)
+	}
+	return nil
+}
+
+// GetCollection returns the collection. Outside its schedule it is only returned to admins.
+func (cs *CollectionService) GetCollection(id string, liveOnly bool) (*Collection, *errors.AppError) {
+	return cs.getCollection(id, liveOnly)
+}
+
+// GetCollections returns every collection, or only the ones within their schedule when liveOnly is set
+func (cs *CollectionService) GetCollections(liveOnly bool) ([]*Collection, *errors.AppError) {
+	filter := bson.M{}
+	if liveOnly {
+		now := time.Now()
+		filter = bson.M{"$and": bson.A{
+			bson.M{"$or": bson.A{bson.M{"starts_at": bson.M{"$exists": false}}, bson.M{"starts_at": bson.M{"$lte": now}}}},
+			bson.M{"$or": bson.A{bson.M{"ends_at": bson.M{"$exists": false}}, bson.M{"ends_at": bson.M{"$gt": now}}}},
+		}}
+	}
+	collections, err := cs.collectionRepo.GetCollections(filter, options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}))
+	if err != nil {
+		return nil, errors.ErrInternalServer
+	}
+	if collections == nil {
+		collections = []*Collection{}
+	}
+	return collections, nil
+}
+
+// GetCollectionItems returns a page of the collection's published items: picked items in the
+// order they were picked and rule-based ones newest first
+func (cs *CollectionService) GetCollectionItems(id string, pagination *types.Pagination, liveOnly bool) ([]*item.Item, *errors.AppError) {
+	collection, appErr := cs.getCollection(id, liveOnly)
+	if appErr != nil {
+		return nil, appErr
+	}
+	var items []*item.Item
+	if collection.IsRuleBased() {
+		items, appErr = cs.ruleItems(collection.Rules, pagination)
+	} else {
+		items, appErr = cs.pickedItems(collection.ItemID, pagination)
+	}
+	if appErr != nil {
+		return nil, appErr
+	}
+	if err := cs.itemPreparer.PrepareItems(items...); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+func (cs *CollectionService) pickedItems(itemIDs []primitive.ObjectID, pagination *types.Pagination) ([]*item.Item, *errors.AppError) {
+	items, err := cs.itemRepo.GetItems(bson.M{"_id": bson.M{"$in": itemIDs}, "status": bson.M{"$ne": item.Draft}})
+	if err != nil {
+		return nil, errors.ErrInternalServer
+	}
+	byID := make(map[primitive.ObjectID]*item.Item, len(items))
+	for _, v := range items {
+		byID[v.ID] = v
+	}
+	ordered := make([]*item.Item, 0, len(items))
+	for _, v := range itemIDs {
+		if it, ok := byID[v]; ok {
+			ordered = append(ordered, it)
+		}
+	}
+	pagination.Total = int64(len(ordered))
+	start := pagination.Skip()
+	if start > pagination.Total {
+		start = pagination.Total
+	}
+	end := start + pagination.Limit
+	if end > pagination.Total {
+		end = pagination.Total
+	}
+	return ordered[start:end], nil
+}
+
+// ruleItems matches items on their stored list price and their own discount. Scheduled sales do
+// not move items into or out of a collection; the matched items still show their sale price once
+// prepared.
+func (cs *CollectionService) ruleItems(rules *Rules, pagination *types.Pagination) ([]*item.Item, *errors.AppError) {
+	filter := bson.M{"status": bson.M{"$ne": item.Draft}}
+	if len(rules.CategoryID) > 0 {
+		categoryIDs, err := cs.categoryTree.Descendants(rules.CategoryID)
+		if err != nil {
+			return nil, err
+		}
+		filter["category_id"] = bson.M{"$in": categoryIDs}
+	}
+	if len(rules.Tags) > 0 {
+		filter["tags"] = bson.M{"$in": rules.Tags}
+	}
+	price := bson.M{}
+	if rules.MinPrice > 0 {
+		price["$gte"] = rules.MinPrice
+	}
+	if rules.MaxPrice > 0 {
+		price["$lte"] = rules.MaxPrice
+	}
+	if len(price) > 0 {
+		filter["price"] = price
+	}
+	if rules.MinDiscount > 0 {
+		filter["discount"] = bson.M{"$gte": rules.MinDiscount}
+	}
+	total, err := cs.itemRepo.CountItems(filter)
+	if err != nil {
+		return nil, errors.ErrInternalServer
+	}
+	pagination.Total = total
+	items, err := cs.itemRepo.GetItems(filter, pagination.FindOptions().SetSort(bson.D{{Key: "created_at", Value: -1}}))
+	if err != nil {
+		return nil, errors.ErrInternalServer
+	}
+	if items == nil {
+		items = []*item.Item{}
+	}
+	return items, nil
+}
+
+func (cs *CollectionService) getCollection(id string, liveOnly bool) (*Collection, *errors.AppError) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, errors.ErrInvalidObjectID
+	}
+	collection, err := cs.collectionRepo.GetCollection(bson.M{"_id": objectID})
+	if err == nil && liveOnly && !collection.IsLive(time.Now()) {
+		err = mongo.ErrNoDocuments
+	}
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			err := errors.ErrNotFound
+			return nil, errors.NewError("collection not found: "+err.Error(), err.StatusCode)
+		}
+		return nil, errors.ErrInternalServer
+	}
+	return collection, nil
+}
+
+func (cs *CollectionService) validateCollection(collection *Collection) *errors.AppError {
+	if collection.Name == "" {
+		return errors.NewError("invalid name", 400)
+	}
+	if (len(collection.ItemID) > 0) == (collection.Rules != nil) {
+		return errors.NewError("collection must have either items or rules", 400)
+	}
+	if collection.StartsAt != nil && collection.EndsAt != nil && !collection.EndsAt.After(*collection.StartsAt) {
+		return errors.NewError("collection must end after it starts", 400)
+	}
+	if collection.Rules != nil {
+		return cs.validateRules(collection.Rules)
+	}
+	seen := make(map[primitive.ObjectID]bool, len(collection.ItemID))
+	for _, v := range collection.ItemID {
+		if seen[v] {
+			return errors.NewError("an item can only be picked once", 400)
+		}
+		seen[v] = true
+	}
+	found, err := cs.itemRepo.CountItems(bson.M{"_id": bson.M{"$in": collection.ItemID}})
+	if err != nil {
+		return errors.NewError("internal error: "+err.Error(), 500)
+	}
+	if found != int64(len(collection.ItemID)) {
+		err := errors.ErrNotFound
+		return errors.NewError("item not found: "+err.Error(), err.StatusCode)
+	}
+	return nil
+}
+
+func (cs *CollectionService) validateRules(rules *Rules) *errors.AppError {
+	rules.Tags = item.NormalizeTags(rules.Tags)
+	if len(rules.CategoryID) == 0 && len(rules.Tags) == 0 && rules.MinPrice == 0 && rules.MaxPrice == 0 && rules.MinDiscount == 0 {
+		return errors.NewError("rules must match on at least one of category, tag, price or discount", 400)
+	}
+	if rules.MinPrice < 0 || rules.MaxPrice < 0 || (rules.MaxPrice > 0 && rules.MaxPrice < rules.MinPrice) {
+		return errors.NewError("invalid price range", 400)
+	}
+	if rules.MinDiscount < 0 || rules.MinDiscount > 100 {
+		return errors.NewError("invalid discount", 400)
+	}
+	if len(rules.CategoryID) > 0 {
+		categories, err := cs.categoryRepo.GetCategories(bson.M{"_id": bson.M{"$in": rules.CategoryID}})
+		if err != nil {
+			return errors.NewError("internal error: "+err.Error(), 500)
+		}
+		found := make(map[primitive.ObjectID]bool, len(categories))
+		for _, v := range categories {
+			found[v.ID] = true
+		}
+		for _, v := range rules.CategoryID {
+			if !found[v] {
+				err := errors.ErrNotFound
+				return errors.NewError("category not found: "+err.Error(), err.StatusCode)
+			}
+		}
+	}
+	return nil
+}
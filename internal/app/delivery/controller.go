@@ -0,0 +1,74 @@
+package delivery
+
+import (
+	"net/http"
+
+	"github.com/ayo-ajayi/ecommerce/internal/errors"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type DeliveryController struct {
+	deliveryServices DeliveryServices
+}
+
+type DeliveryServices interface {
+	AddLicenseKeys(itemId string, vendorId primitive.ObjectID, keys []string) (int, *errors.AppError)
+	DownloadURL(userid primitive.ObjectID, orderId, itemId string) (string, *errors.AppError)
+	Download(token string) (string, *errors.AppError)
+}
+
+func NewDeliveryController(deliveryServices DeliveryServices) *DeliveryController {
+	return &DeliveryController{
+		deliveryServices: deliveryServices,
+	}
+}
+
+func (dc *DeliveryController) AddLicenseKeys(c *gin.Context) {
+	vendorId := c.MustGet("userId").(primitive.ObjectID)
+	if vendorId.IsZero() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": "invalid user"}})
+		return
+	}
+	req := struct {
+		Keys []string `json:"keys" binding:"required"`
+	}{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	added, err := dc.deliveryServices.AddLicenseKeys(c.Param("id"), vendorId, req.Keys)
+	if err != nil {
+		c.JSON(err.StatusCode, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	c.JSON(200, gin.H{"message": "licence keys added successfully", "data": gin.H{"added": added}})
+}
+
+func (dc *DeliveryController) GetDownloadURL(c *gin.Context) {
+	userid := c.MustGet("userId").(primitive.ObjectID)
+	if userid.IsZero() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": "invalid user"}})
+		return
+	}
+	url, err := dc.deliveryServices.DownloadURL(userid, c.Param("id"), c.Param("item_id"))
+	if err != nil {
+		c.JSON(err.StatusCode, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	c.JSON(200, gin.H{"data": gin.H{"download_url": url}})
+}
+
+func (dc *DeliveryController) Download(c *gin.Context) {
+	token := c.Query("token")
+	if token == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": "token required"}})
+		return
+	}
+	fileURL, err := dc.deliveryServices.Download(token)
+	if err != nil {
+		c.JSON(err.StatusCode, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	c.Redirect(http.StatusFound, fileURL)
+}
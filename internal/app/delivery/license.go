@@ -0,0 +1,17 @@
+package delivery
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// LicenseKey is one key in an item's licence key pool. It is assigned to an order on delivery.
+type LicenseKey struct {
+	ID         primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	ItemID     primitive.ObjectID `json:"item_id" bson:"item_id"`
+	Key        string             `json:"-" bson:"key"`
+	OrderID    primitive.ObjectID `json:"order_id,omitempty" bson:"order_id,omitempty"`
+	AssignedAt *time.Time         `json:"assigned_at,omitempty" bson:"assigned_at,omitempty"`
+	CreatedAt  time.Time          `json:"created_at" bson:"created_at"`
+}
@@ -0,0 +1,89 @@
+package delivery
+
+import (
+	"context"
+	"errors"
+
+	"github.com/ayo-ajayi/ecommerce/internal/database"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type LicenseKeyRepo struct {
+	Collection *mongo.Collection
+}
+
+func NewLicenseKeyRepo(collection *mongo.Collection) *LicenseKeyRepo {
+	return &LicenseKeyRepo{
+		Collection: collection,
+	}
+}
+
+func InitLicenseKeyIndex(collection *mongo.Collection) error {
+	ctx, cancel := database.DBReqContext(5)
+	defer cancel()
+	_, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "item_id", Value: 1}, {Key: "key", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return errors.New("Error creating unique index for license key collection:" + err.Error())
+	}
+	return nil
+}
+
+// CreateLicenseKeys inserts the keys and returns how many were new. Keys already in the pool are skipped.
+func (lr *LicenseKeyRepo) CreateLicenseKeys(keys []*LicenseKey) (int, error) {
+	ctx, cancel := database.DBReqContext(10)
+	defer cancel()
+	docs := make([]interface{}, 0, len(keys))
+	for _, v := range keys {
+		docs = append(docs, v)
+	}
+	res, err := lr.Collection.InsertMany(ctx, docs, options.InsertMany().SetOrdered(false))
+	if err != nil {
+		var bulkErr mongo.BulkWriteException
+		if !errors.As(err, &bulkErr) {
+			return 0, err
+		}
+		for _, v := range bulkErr.WriteErrors {
+			if !mongo.IsDuplicateKeyError(v) {
+				return 0, err
+			}
+		}
+		return len(keys) - len(bulkErr.WriteErrors), nil
+	}
+	return len(res.InsertedIDs), nil
+}
+
+func (lr *LicenseKeyRepo) AssignLicenseKey(filter interface{}, update interface{}) (*LicenseKey, error) {
+	ctx, cancel := database.DBReqContext(5)
+	defer cancel()
+	var key LicenseKey
+	err := lr.Collection.FindOneAndUpdate(ctx, filter, update, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&key)
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+func (lr *LicenseKeyRepo) GetLicenseKeys(filter interface{}, opts ...*options.FindOptions) ([]*LicenseKey, error) {
+	ctx, cancel := database.DBReqContext(5)
+	defer cancel()
+	var keys []*LicenseKey
+	cursor, err := lr.Collection.Find(ctx, filter, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if err := cursor.All(ctx, &keys); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// UpdateLicenseKeysTx is part of the transaction ctx belongs to
+func (lr *LicenseKeyRepo) UpdateLicenseKeysTx(ctx context.Context, filter interface{}, update interface{}) error {
+	_, err := lr.Collection.UpdateMany(ctx, filter, update)
+	return err
+}
@@ -0,0 +1,329 @@
+package delivery
+
+import (
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ayo-ajayi/ecommerce/internal/app/item"
+	"github.com/ayo-ajayi/ecommerce/internal/app/order"
+	"github.com/ayo-ajayi/ecommerce/internal/app/user"
+	"github.com/ayo-ajayi/ecommerce/internal/constants"
+	"github.com/ayo-ajayi/ecommerce/internal/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type DeliveryService struct {
+	licenseKeyRepo LicenseKeyRepository
+	itemRepo       ItemRepository
+	orderRepo      OrderRepository
+	userRepo       UserRepository
+	emailRepo      EmailRepository
+	signer         Signer
+	fileSigner     FileSigner
+	baseURL        string
+}
+
+type LicenseKeyRepository interface {
+	CreateLicenseKeys(keys []*LicenseKey) (int, error)
+	AssignLicenseKey(filter interface{}, update interface{}) (*LicenseKey, error)
+	GetLicenseKeys(filter interface{}, opts ...*options.FindOptions) ([]*LicenseKey, error)
+}
+
+type ItemRepository interface {
+	GetItem(filter interface{}, opts ...*options.FindOneOptions) (*item.Item, error)
+	GetItems(filter interface{}, opts ...*options.FindOptions) ([]*item.Item, error)
+	UpdateItem(filter interface{}, update interface{}, opts ...*options.UpdateOptions) error
+}
+
+type OrderRepository interface {
+	GetOrder(filter interface{}, opts ...*options.FindOneOptions) (*order.Order, error)
+	UpdateOrder(filter interface{}, update interface{}, opts ...*options.UpdateOptions) error
+	FindOneAndUpdateOrder(filter interface{}, update interface{}, opts ...*options.FindOneAndUpdateOptions) (*order.Order, error)
+}
+
+type UserRepository interface {
+	GetUser(filter interface{}) (*user.User, error)
+}
+
+type EmailRepository interface {
+	SendLicenseKeyEmail(email, firstname, itemName, licenseKey string) error
+	SendDownloadEmail(email, firstname, itemName, downloadURL string) error
+}
+
+// FileSigner signs short-lived urls for private files
+type FileSigner interface {
+	PrivateDownloadURL(publicID string, expiresAt time.Time) (string, *errors.AppError)
+}
+
+type Signer interface {
+	Sign(payload string, expiresAt time.Time) string
+	Verify(token string) (string, error)
+}
+
+func NewDeliveryService(licenseKeyRepo LicenseKeyRepository, itemRepo ItemRepository, orderRepo OrderRepository, userRepo UserRepository, emailRepo EmailRepository, signer Signer, fileSigner FileSigner, baseURL string) *DeliveryService {
+	return &DeliveryService{
+		licenseKeyRepo: licenseKeyRepo,
+		itemRepo:       itemRepo,
+		orderRepo:      orderRepo,
+		userRepo:       userRepo,
+		emailRepo:      emailRepo,
+		signer:         signer,
+		fileSigner:     fileSigner,
+		baseURL:        strings.TrimSuffix(baseURL, "/"),
+	}
+}
+
+// AddLicenseKeys adds keys to a licence key item's pool and grows its stock by the number of new keys
+func (ds *DeliveryService) AddLicenseKeys(itemId string, vendorId primitive.ObjectID, keys []string) (int, *errors.AppError) {
+	itemID, err := primitive.ObjectIDFromHex(itemId)
+	if err != nil {
+		return 0, errors.ErrInvalidObjectID
+	}
+	it, err := ds.itemRepo.GetItem(bson.M{"_id": itemID, "vendor_id": vendorId})
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			err := errors.ErrNotFound
+			return 0, errors.NewError("item not found: "+err.Error(), err.StatusCode)
+		}
+		return 0, errors.ErrInternalServer
+	}
+	if !it.IsDigital() || it.Digital.Delivery != item.LicenseKeyDelivery {
+		return 0, errors.NewError("item is not delivered by licence key", 400)
+	}
+	seen := make(map[string]bool, len(keys))
+	var licenseKeys []*LicenseKey
+	for _, v := range keys {
+		key := strings.TrimSpace(v)
+		if key == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		licenseKeys = append(licenseKeys, &LicenseKey{ItemID: itemID, Key: key, CreatedAt: time.Now()})
+	}
+	if len(licenseKeys) == 0 {
+		return 0, errors.NewError("no licence keys to add", 400)
+	}
+	added, err := ds.licenseKeyRepo.CreateLicenseKeys(licenseKeys)
+	if err != nil {
+		return 0, errors.NewError("internal error: "+err.Error(), 500)
+	}
+	if added > 0 {
+		if err := ds.itemRepo.UpdateItem(bson.M{"_id": itemID}, bson.M{"$inc": bson.M{"quantity": added}}); err != nil {
+			return 0, errors.NewError("internal error: "+err.Error(), 500)
+		}
+	}
+	return added, nil
+}
+
+// Deliver assigns licence keys and download allowances to the digital lines of a paid order
+// and emails them to the customer. Lines that were already delivered are left alone.
+func (ds *DeliveryService) Deliver(o *order.Order) *errors.AppError {
+	var itemIDs []primitive.ObjectID
+	for _, v := range o.OrderItems {
+		if v.Type == item.Digital && v.Digital == nil {
+			itemIDs = append(itemIDs, v.ItemID)
+		}
+	}
+	if len(itemIDs) == 0 {
+		return nil
+	}
+	items, err := ds.itemRepo.GetItems(bson.M{"_id": bson.M{"$in": itemIDs}})
+	if err != nil {
+		return errors.ErrInternalServer
+	}
+	itemsByID := make(map[primitive.ObjectID]*item.Item, len(items))
+	for _, v := range items {
+		itemsByID[v.ID] = v
+	}
+	customer, err := ds.userRepo.GetUser(bson.M{"_id": o.UserID})
+	if err != nil {
+		return errors.NewError("failed to find customer: "+err.Error(), 500)
+	}
+
+	for i, line := range o.OrderItems {
+		if line.Type != item.Digital || line.Digital != nil {
+			continue
+		}
+		it, ok := itemsByID[line.ItemID]
+		if !ok || !it.IsDigital() {
+			return errors.NewError("digital item not found: "+line.Name, 404)
+		}
+		delivery := &order.DigitalDelivery{Method: it.Digital.Delivery, DeliveredAt: time.Now()}
+		switch it.Digital.Delivery {
+		case item.LicenseKeyDelivery:
+			keys, appErr := ds.assignLicenseKeys(o.ID, it.ID, line.Quantity)
+			if appErr != nil {
+				return appErr
+			}
+			delivery.LicenseKeys = keys
+		case item.DownloadDelivery:
+			maxDownloads := it.Digital.MaxDownloads
+			if maxDownloads == 0 {
+				maxDownloads = constants.DefaultMaxDownloads
+			}
+			delivery.FileID, delivery.FileURL = it.Digital.FileID, it.Digital.FileURL
+			delivery.MaxDownloads = maxDownloads * line.Quantity
+		}
+		if err := ds.orderRepo.UpdateOrder(bson.M{"_id": o.ID}, bson.M{"$set": bson.M{
+			"order_items." + strconv.Itoa(i) + ".digital": delivery,
+		}}); err != nil {
+			return errors.NewError("internal error: "+err.Error(), 500)
+		}
+		o.OrderItems[i].Digital = delivery
+
+		if delivery.Method == item.LicenseKeyDelivery {
+			err = ds.emailRepo.SendLicenseKeyEmail(customer.Email, customer.FirstName, line.Name, strings.Join(delivery.LicenseKeys, ", "))
+		} else {
+			token := ds.signer.Sign(o.ID.Hex()+":"+line.ItemID.Hex(), time.Now().Add(time.Duration(constants.DownloadLinkValidityInHours)*time.Hour))
+			err = ds.emailRepo.SendDownloadEmail(customer.Email, customer.FirstName, line.Name, ds.downloadURL(token))
+		}
+		if err != nil {
+			// the delivery is saved on the order, so the customer can still get it from there
+			log.Println("failed to email digital delivery for order " + o.ID.Hex() + ": " + err.Error())
+		}
+	}
+	return nil
+}
+
+// assignLicenseKeys takes keys from the pool for an order line, reusing any keys that a
+// previous, interrupted delivery already assigned to the same order
+func (ds *DeliveryService) assignLicenseKeys(orderID, itemID primitive.ObjectID, quantity int) ([]string, *errors.AppError) {
+	assigned, err := ds.licenseKeyRepo.GetLicenseKeys(bson.M{"item_id": itemID, "order_id": orderID})
+	if err != nil {
+		return nil, errors.ErrInternalServer
+	}
+	keys := make([]string, 0, quantity)
+	for _, v := range assigned {
+		keys = append(keys, v.Key)
+	}
+	for len(keys) < quantity {
+		now := time.Now()
+		key, err := ds.licenseKeyRepo.AssignLicenseKey(
+			bson.M{"item_id": itemID, "order_id": bson.M{"$exists": false}},
+			bson.M{"$set": bson.M{"order_id": orderID, "assigned_at": now}},
+		)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				return nil, errors.NewError("licence key pool is exhausted for item: "+itemID.Hex(), 409)
+			}
+			return nil, errors.ErrInternalServer
+		}
+		keys = append(keys, key.Key)
+	}
+	return keys, nil
+}
+
+// DownloadURL issues a fresh time-limited download link for a delivered order line
+func (ds *DeliveryService) DownloadURL(userid primitive.ObjectID, orderId, itemId string) (string, *errors.AppError) {
+	orderID, err := primitive.ObjectIDFromHex(orderId)
+	if err != nil {
+		return "", errors.ErrInvalidObjectID
+	}
+	itemID, err := primitive.ObjectIDFromHex(itemId)
+	if err != nil {
+		return "", errors.ErrInvalidObjectID
+	}
+	o, err := ds.orderRepo.GetOrder(bson.M{"_id": orderID, "user_id": userid})
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			err := errors.ErrNotFound
+			return "", errors.NewError("order not found: "+err.Error(), err.StatusCode)
+		}
+		return "", errors.ErrInternalServer
+	}
+	line, appErr := downloadLine(o, itemID)
+	if appErr != nil {
+		return "", appErr
+	}
+	if line.Digital.Downloads >= line.Digital.MaxDownloads {
+		return "", errors.NewError("download limit reached for this order", 403)
+	}
+	token := ds.signer.Sign(o.ID.Hex()+":"+itemID.Hex(), time.Now().Add(time.Duration(constants.DownloadLinkValidityInHours)*time.Hour))
+	return ds.downloadURL(token), nil
+}
+
+// Download checks a download token, counts the download against the order's cap and returns a
+// url for the file that expires within minutes, so it cannot be shared in place of the download link.
+func (ds *DeliveryService) Download(token string) (string, *errors.AppError) {
+	payload, err := ds.signer.Verify(token)
+	if err != nil {
+		return "", errors.NewError("invalid download link: "+err.Error(), 403)
+	}
+	ids := strings.Split(payload, ":")
+	if len(ids) != 2 {
+		return "", errors.NewError("invalid download link", 403)
+	}
+	orderID, err := primitive.ObjectIDFromHex(ids[0])
+	if err != nil {
+		return "", errors.NewError("invalid download link", 403)
+	}
+	itemID, err := primitive.ObjectIDFromHex(ids[1])
+	if err != nil {
+		return "", errors.NewError("invalid download link", 403)
+	}
+	// the count is compare-and-swapped so concurrent downloads cannot exceed the cap
+	for attempt := 0; attempt < 3; attempt++ {
+		o, err := ds.orderRepo.GetOrder(bson.M{"_id": orderID})
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				err := errors.ErrNotFound
+				return "", errors.NewError("order not found: "+err.Error(), err.StatusCode)
+			}
+			return "", errors.ErrInternalServer
+		}
+		line, appErr := downloadLine(o, itemID)
+		if appErr != nil {
+			return "", appErr
+		}
+		if line.Digital.Downloads >= line.Digital.MaxDownloads {
+			return "", errors.NewError("download limit reached for this order", 403)
+		}
+		_, err = ds.orderRepo.FindOneAndUpdateOrder(
+			bson.M{"_id": orderID, "order_status": bson.M{"$ne": order.OrderStatusCancelled}, "order_items": bson.M{"$elemMatch": bson.M{"item_id": itemID, "digital.downloads": line.Digital.Downloads}}},
+			bson.M{"$inc": bson.M{"order_items.$.digital.downloads": 1}},
+		)
+		if err == nil {
+			return ds.fileURL(line.Digital)
+		}
+		if err != mongo.ErrNoDocuments {
+			return "", errors.ErrInternalServer
+		}
+	}
+	return "", errors.NewError("too many concurrent downloads, try again", 409)
+}
+
+func downloadLine(o *order.Order, itemID primitive.ObjectID) (*order.OrderItem, *errors.AppError) {
+	if o.PaymentStatus != order.PaymentStatusPaid {
+		return nil, errors.NewError("order has not been paid", 403)
+	}
+	if o.OrderStatus == order.OrderStatusCancelled {
+		return nil, errors.NewError("order is cancelled", 403)
+	}
+	for i, v := range o.OrderItems {
+		if v.ItemID == itemID {
+			if v.Digital == nil || v.Digital.Method != item.DownloadDelivery {
+				return nil, errors.NewError("item has no download for this order", 400)
+			}
+			return &o.OrderItems[i], nil
+		}
+	}
+	return nil, errors.NewError("item not found in order", 404)
+}
+
+// fileURL signs a short-lived url for a delivered file. Files uploaded before downloads were
+// private only have their public url.
+func (ds *DeliveryService) fileURL(delivery *order.DigitalDelivery) (string, *errors.AppError) {
+	if delivery.FileID == "" {
+		return delivery.FileURL, nil
+	}
+	return ds.fileSigner.PrivateDownloadURL(delivery.FileID, time.Now().Add(time.Duration(constants.DownloadFileURLValidityInMins)*time.Minute))
+}
+
+func (ds *DeliveryService) downloadURL(token string) string {
+	return ds.baseURL + "/api/download?token=" + token
+}
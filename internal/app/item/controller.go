@@ -2,34 +2,51 @@ package item
 
 import (
 	"context"
+	"encoding/json"
 	"mime/multipart"
 	"net/http"
 
 	"strconv"
+	"strings"
 
 	"github.com/ayo-ajayi/ecommerce/internal/errors"
+	"github.com/ayo-ajayi/ecommerce/internal/utils"
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type ItemController struct {
 	itemServices ItemServices
+	viewRecorder ViewRecorder
+}
+
+// ViewRecorder records that an item was viewed by a user or, when userId is zero, an anonymous visitor
+type ViewRecorder interface {
+	RecordView(item *Item, userId primitive.ObjectID, visitorId string)
 }
 
 type ItemServices interface {
 	CreateItem(item *Item) *errors.AppError
 	DeleteItem(itemId string, userId primitive.ObjectID) *errors.AppError
-	GetItems() ([]*Item, *errors.AppError)
+	GetItems(query *ItemQuery) ([]*Item, *errors.AppError)
 	UpdateItem(item *Item) *errors.AppError
-	GetItemByID(itemId string) (*Item, *errors.AppError)
-	GetItemBySlug(slug string) (*Item, *errors.AppError)
+	PatchItem(itemId string, vendorId primitive.ObjectID, patch map[string]json.RawMessage, version int64) (*Item, *errors.AppError)
+	GetItemByID(itemId string, viewerId primitive.ObjectID) (*Item, *errors.AppError)
+	GetItemBySlug(slug string, viewerId primitive.ObjectID) (*Item, *errors.AppError)
 	GetVendorItems(vendorId primitive.ObjectID) ([]*Item, *errors.AppError)
 	UploadImage(ctx context.Context, files []*multipart.FileHeader, collection string) ([]string, *errors.AppError)
+	UploadFile(ctx context.Context, file *multipart.FileHeader, collection string) (string, *errors.AppError)
+	AddImages(ctx context.Context, itemId string, vendorId primitive.ObjectID, files []*multipart.FileHeader, alts []string) ([]Image, *errors.AppError)
+	DeleteImage(itemId string, vendorId primitive.ObjectID, imageRef string) ([]Image, *errors.AppError)
+	ReorderImages(itemId string, vendorId primitive.ObjectID, imageRefs []string) ([]Image, *errors.AppError)
+	SetPrimaryImage(itemId string, vendorId primitive.ObjectID, imageRef string) ([]Image, *errors.AppError)
+	UpdateImageAlt(itemId string, vendorId primitive.ObjectID, imageRef, alt string) ([]Image, *errors.AppError)
 }
 
-func NewItemController(itemServices ItemServices) *ItemController {
+func NewItemController(itemServices ItemServices, viewRecorder ViewRecorder) *ItemController {
 	return &ItemController{
 		itemServices: itemServices,
+		viewRecorder: viewRecorder,
 	}
 }
 func (ic *ItemController) CreateItem(c *gin.Context) {
@@ -58,13 +75,19 @@ func (ic *ItemController) createItem(c *gin.Context) (*Item, *errors.AppError) {
 		return nil, errors.NewError("file too large"+err.Error(), 400)
 	}
 	req := struct {
-		Name        string               `json:"name" binding:"required"`
-		Description string               `json:"description" binding:"required"`
-		CategoryID  []primitive.ObjectID `json:"category_id"`
-		Price       float64              `json:"price" binding:"required"`
-		Quantity    int                  `json:"quantity" binding:"required"`
-		Discount    float64              `json:"discount"`
-		Images      []string             `json:"images"`
+		Name        string                 `json:"name" binding:"required"`
+		Description string                 `json:"description" binding:"required"`
+		CategoryID  []primitive.ObjectID   `json:"category_id"`
+		Price       float64                `json:"price" binding:"required"`
+		Quantity    int                    `json:"quantity" binding:"required"`
+		Discount    float64                `json:"discount"`
+		Images      []Image                `json:"images"`
+		Attributes  map[string]interface{} `json:"attributes"`
+		Tags        []string               `json:"tags"`
+		Type        ItemType               `json:"type"`
+		Digital     *DigitalContent        `json:"digital"`
+		Components  []BundleComponent      `json:"components"`
+		Status      ItemStatus             `json:"status"`
 	}{}
 
 	req.Name = c.PostForm("name")
@@ -82,15 +105,36 @@ func (ic *ItemController) createItem(c *gin.Context) (*Item, *errors.AppError) {
 	}
 	req.Price = price
 
-	quantityStr := c.PostForm("quantity")
-	if quantityStr == "" {
-		return nil, errors.NewError("invalid quantity", 400)
-	}
-	quantity, err := strconv.Atoi(quantityStr)
-	if err != nil {
-		return nil, errors.NewError("invalid quantity", 400)
+	req.Status = ItemStatus(c.DefaultPostForm("status", string(Published)))
+	req.Type = ItemType(c.DefaultPostForm("type", string(Physical)))
+	switch req.Type {
+	case Physical:
+		quantityStr := c.PostForm("quantity")
+		if quantityStr == "" {
+			return nil, errors.NewError("invalid quantity", 400)
+		}
+		quantity, err := strconv.Atoi(quantityStr)
+		if err != nil {
+			return nil, errors.NewError("invalid quantity", 400)
+		}
+		req.Quantity = quantity
+	case Bundle:
+		if err := json.Unmarshal([]byte(c.PostForm("components")), &req.Components); err != nil {
+			return nil, errors.NewError("invalid components", 400)
+		}
+	case Digital:
+		// download stock is unlimited and licence key stock comes from the key pool
+		req.Digital = &DigitalContent{Delivery: DeliveryMethod(c.PostForm("delivery"))}
+		if maxDownloads := c.PostForm("max_downloads"); maxDownloads != "" {
+			max, err := strconv.Atoi(maxDownloads)
+			if err != nil || max < 1 {
+				return nil, errors.NewError("invalid max downloads", 400)
+			}
+			req.Digital.MaxDownloads = max
+		}
+	default:
+		return nil, errors.NewError("invalid item type", 400)
 	}
-	req.Quantity = quantity
 
 	discountStr := c.PostForm("discount")
 	if discountStr != "" {
@@ -110,12 +154,31 @@ func (ic *ItemController) createItem(c *gin.Context) (*Item, *errors.AppError) {
 		req.CategoryID = append(req.CategoryID, categoryID)
 	}
 
+	if attributes := c.PostForm("attributes"); attributes != "" {
+		if err := json.Unmarshal([]byte(attributes), &req.Attributes); err != nil {
+			return nil, errors.NewError("invalid attributes: "+err.Error(), 400)
+		}
+	}
+	req.Tags = c.PostFormArray("tags")
+
 	files := c.Request.MultipartForm.File["images"]
+	if err := utils.CheckImages(files); err != nil {
+		return nil, err
+	}
+	if req.Digital != nil && req.Digital.Delivery == DownloadDelivery {
+		if files := c.Request.MultipartForm.File["file"]; len(files) > 0 {
+			fileID, err := ic.itemServices.UploadFile(c.Request.Context(), files[0], "downloads")
+			if err != nil {
+				return nil, errors.NewError("failed to upload file: "+err.Error(), 400)
+			}
+			req.Digital.FileID = fileID
+		}
+	}
 
 	if imgURLs, err := ic.itemServices.UploadImage(c.Request.Context(), files, "items"); err != nil {
 		return nil, errors.NewError("failed to upload images: "+err.Error(), 400)
 	} else {
-		req.Images = imgURLs
+		req.Images = newImages(imgURLs, c.PostFormArray("alt"))
 	}
 	return &Item{
 		Name:        req.Name,
@@ -125,6 +188,12 @@ func (ic *ItemController) createItem(c *gin.Context) (*Item, *errors.AppError) {
 		Discount:    req.Discount,
 		CategoryID:  req.CategoryID,
 		Images:      req.Images,
+		Attributes:  req.Attributes,
+		Tags:        req.Tags,
+		Type:        req.Type,
+		Digital:     req.Digital,
+		Components:  req.Components,
+		Status:      req.Status,
 	}, nil
 }
 
@@ -143,7 +212,12 @@ func (ic *ItemController) DeleteItem(c *gin.Context) {
 }
 
 func (ic *ItemController) GetItems(c *gin.Context) {
-	items, err := ic.itemServices.GetItems()
+	query, err := ParseItemQuery(c)
+	if err != nil {
+		c.JSON(err.StatusCode, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	items, err := ic.itemServices.GetItems(query)
 	if err != nil {
 		c.JSON(err.StatusCode, gin.H{"error": gin.H{"message": err.Error()}})
 		return
@@ -163,6 +237,11 @@ func (ic *ItemController) UpdateItem(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": "invalid user"}})
 		return
 	}
+	version, fromHeader, vErr := utils.ReadVersion(c)
+	if vErr != nil {
+		c.JSON(vErr.StatusCode, gin.H{"error": gin.H{"message": vErr.Error()}})
+		return
+	}
 	var cErr *errors.AppError
 	item, cErr := ic.createItem(c)
 	if cErr != nil {
@@ -170,8 +249,14 @@ func (ic *ItemController) UpdateItem(c *gin.Context) {
 		return
 	}
 	item.ID = itemID
+	item.VendorID = vendorId
+	item.Version = version
 
 	if err := ic.itemServices.UpdateItem(item); err != nil {
+		if err == errors.ErrVersionConflict && fromHeader {
+			c.JSON(http.StatusPreconditionFailed, gin.H{"error": gin.H{"message": err.Error()}})
+			return
+		}
 		c.JSON(err.StatusCode, gin.H{"error": gin.H{"message": err.Error()}})
 		return
 	}
@@ -179,26 +264,75 @@ func (ic *ItemController) UpdateItem(c *gin.Context) {
 	c.JSON(200, gin.H{"message": "item updated successfully", "data": gin.H{"name": item.Name}})
 }
 
+// PatchItem partially updates an item with a JSON merge patch made against the version
+// in the If-Match header or the patch's version field
+func (ic *ItemController) PatchItem(c *gin.Context) {
+	vendorId := c.MustGet("userId").(primitive.ObjectID)
+	if vendorId.IsZero() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": "invalid user"}})
+		return
+	}
+	patch, version, fromHeader, err := utils.ReadMergePatch(c)
+	if err != nil {
+		c.JSON(err.StatusCode, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	item, err := ic.itemServices.PatchItem(c.Param("id"), vendorId, patch, version)
+	if err != nil {
+		if err == errors.ErrVersionConflict && fromHeader {
+			c.JSON(http.StatusPreconditionFailed, gin.H{"error": gin.H{"message": err.Error()}})
+			return
+		}
+		c.JSON(err.StatusCode, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	c.Header("ETag", `"`+strconv.FormatInt(item.Version, 10)+`"`)
+	c.JSON(200, gin.H{"message": "item updated successfully", "data": gin.H{"item": item}})
+}
+
 func (ic *ItemController) GetItemByID(c *gin.Context) {
 	id := c.Param("id")
-	item, err := ic.itemServices.GetItemByID(id)
+	item, err := ic.itemServices.GetItemByID(id, viewerID(c))
 	if err != nil {
 		c.JSON(err.StatusCode, gin.H{"error": gin.H{"message": err.Error()}})
 		return
 	}
+	ic.recordView(c, item)
 	c.JSON(200, gin.H{"data": gin.H{"item": item}})
 }
 
 func (ic *ItemController) GetItemBySlug(c *gin.Context) {
 	slug := c.Param("slug")
-	item, err := ic.itemServices.GetItemBySlug(slug)
+	item, err := ic.itemServices.GetItemBySlug(slug, viewerID(c))
 	if err != nil {
 		c.JSON(err.StatusCode, gin.H{"error": gin.H{"message": err.Error()}})
 		return
 	}
+	if item.Slug != slug {
+		// an old slug: send clients and crawlers to the canonical url
+		c.Header("Location", strings.TrimSuffix(c.Request.URL.Path, slug)+item.Slug)
+		c.JSON(http.StatusMovedPermanently, gin.H{"data": gin.H{"item": item, "canonical_slug": item.Slug}})
+		return
+	}
+	ic.recordView(c, item)
 	c.JSON(200, gin.H{"data": gin.H{"item": item}})
 }
 
+// viewerID is the signed in user, or zero for anonymous visitors
+func viewerID(c *gin.Context) primitive.ObjectID {
+	userid, _ := c.Get("userId")
+	userId, _ := userid.(primitive.ObjectID)
+	return userId
+}
+
+// recordView records a view of a published item. Vendors looking at their drafts are not counted.
+func (ic *ItemController) recordView(c *gin.Context, item *Item) {
+	if !item.IsPublished() {
+		return
+	}
+	ic.viewRecorder.RecordView(item, viewerID(c), c.GetString("visitorId"))
+}
+
 func (ic *ItemController) GetVendorItems(c *gin.Context) {
 	userid := c.MustGet("userId").(primitive.ObjectID)
 	if userid.IsZero() || userid.Hex() == "" {
@@ -212,3 +346,108 @@ func (ic *ItemController) GetVendorItems(c *gin.Context) {
 	}
 	c.JSON(200, gin.H{"data": gin.H{"items": items}})
 }
+
+func (ic *ItemController) AddImages(c *gin.Context) {
+	vendorId := c.MustGet("userId").(primitive.ObjectID)
+	if vendorId.IsZero() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": "invalid user"}})
+		return
+	}
+	if err := c.Request.ParseMultipartForm(32 << 20); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": "file too large" + err.Error()}})
+		return
+	}
+	files := c.Request.MultipartForm.File["images"]
+	images, err := ic.itemServices.AddImages(c.Request.Context(), c.Param("id"), vendorId, files, c.PostFormArray("alt"))
+	if err != nil {
+		c.JSON(err.StatusCode, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	c.JSON(200, gin.H{"message": "images added successfully", "data": gin.H{"images": images}})
+}
+
+func (ic *ItemController) DeleteImage(c *gin.Context) {
+	vendorId := c.MustGet("userId").(primitive.ObjectID)
+	if vendorId.IsZero() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": "invalid user"}})
+		return
+	}
+	imageRef := c.Query("image_id")
+	if imageRef == "" {
+		imageRef = c.Query("url")
+	}
+	if imageRef == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": "image_id or url required"}})
+		return
+	}
+	images, err := ic.itemServices.DeleteImage(c.Param("id"), vendorId, imageRef)
+	if err != nil {
+		c.JSON(err.StatusCode, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	c.JSON(200, gin.H{"message": "image deleted successfully", "data": gin.H{"images": images}})
+}
+
+func (ic *ItemController) ReorderImages(c *gin.Context) {
+	vendorId := c.MustGet("userId").(primitive.ObjectID)
+	if vendorId.IsZero() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": "invalid user"}})
+		return
+	}
+	req := struct {
+		Images []string `json:"images" binding:"required"` // image ids or urls in the new order
+	}{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	images, err := ic.itemServices.ReorderImages(c.Param("id"), vendorId, req.Images)
+	if err != nil {
+		c.JSON(err.StatusCode, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	c.JSON(200, gin.H{"message": "images reordered successfully", "data": gin.H{"images": images}})
+}
+
+func (ic *ItemController) SetPrimaryImage(c *gin.Context) {
+	vendorId := c.MustGet("userId").(primitive.ObjectID)
+	if vendorId.IsZero() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": "invalid user"}})
+		return
+	}
+	req := struct {
+		Image string `json:"image" binding:"required"`
+	}{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	images, err := ic.itemServices.SetPrimaryImage(c.Param("id"), vendorId, req.Image)
+	if err != nil {
+		c.JSON(err.StatusCode, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	c.JSON(200, gin.H{"message": "primary image set successfully", "data": gin.H{"images": images}})
+}
+
+func (ic *ItemController) UpdateImageAlt(c *gin.Context) {
+	vendorId := c.MustGet("userId").(primitive.ObjectID)
+	if vendorId.IsZero() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": "invalid user"}})
+		return
+	}
+	req := struct {
+		Image string `json:"image" binding:"required"`
+		Alt   string `json:"alt"`
+	}{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	images, err := ic.itemServices.UpdateImageAlt(c.Param("id"), vendorId, req.Image, req.Alt)
+	if err != nil {
+		c.JSON(err.StatusCode, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	c.JSON(200, gin.H{"message": "image updated successfully", "data": gin.H{"images": images}})
+}
@@ -0,0 +1,235 @@
+package item
+
+import (
+	"context"
+	"mime/multipart"
+	"time"
+
+	"github.com/ayo-ajayi/ecommerce/internal/constants"
+	"github.com/ayo-ajayi/ecommerce/internal/errors"
+	"github.com/ayo-ajayi/ecommerce/internal/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type Image struct {
+	ID      primitive.ObjectID `json:"id" bson:"_id"`
+	URL     string             `json:"url" bson:"url"`
+	Alt     string             `json:"alt" bson:"alt"`
+	Primary bool               `json:"primary" bson:"primary"`
+}
+
+// UnmarshalBSONValue also accepts the plain url strings items used to store their images as.
+// Such images get an id the next time the item's images are saved.
+func (img *Image) UnmarshalBSONValue(t bsontype.Type, data []byte) error {
+	if t == bsontype.String {
+		var url string
+		if err := bson.UnmarshalValue(t, data, &url); err != nil {
+			return err
+		}
+		*img = Image{URL: url}
+		return nil
+	}
+	type image Image
+	return bson.Unmarshal(data, (*image)(img))
+}
+
+// matches reports whether ref is the image's id or url
+func (img *Image) matches(ref string) bool {
+	return ref != "" && (ref == img.URL || (!img.ID.IsZero() && ref == img.ID.Hex()))
+}
+
+func newImages(urls, alts []string) []Image {
+	images := make([]Image, 0, len(urls))
+	for i, url := range urls {
+		img := Image{ID: primitive.NewObjectID(), URL: url}
+		if i < len(alts) {
+			img.Alt = alts[i]
+		}
+		images = append(images, img)
+	}
+	return images
+}
+
+// normalizeImages gives legacy images an id and makes sure exactly one image is primary
+func normalizeImages(images []Image) {
+	primary := -1
+	for i := range images {
+		if images[i].ID.IsZero() {
+			images[i].ID = primitive.NewObjectID()
+		}
+		if images[i].Primary {
+			if primary >= 0 {
+				images[i].Primary = false
+				continue
+			}
+			primary = i
+		}
+	}
+	if primary < 0 && len(images) > 0 {
+		images[0].Primary = true
+	}
+}
+
+func findImage(images []Image, ref string) int {
+	for i := range images {
+		if images[i].matches(ref) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (is *ItemService) AddImages(ctx context.Context, itemId string, vendorId primitive.ObjectID, files []*multipart.FileHeader, alts []string) ([]Image, *errors.AppError) {
+	if len(files) == 0 {
+		return nil, errors.NewError("no images to add", 400)
+	}
+	if appErr := utils.CheckImages(files); appErr != nil {
+		return nil, appErr
+	}
+	if _, appErr := is.getVendorItem(itemId, vendorId); appErr != nil {
+		return nil, appErr
+	}
+	urls, appErr := is.uploader.UploadImage(ctx, files, "items")
+	if appErr != nil {
+		return nil, errors.NewError("failed to upload images: "+appErr.Error(), appErr.StatusCode)
+	}
+	images := newImages(urls, alts)
+	item, appErr := is.updateImages(itemId, vendorId, func(item *Item) *errors.AppError {
+		item.Images = append(item.Images, images...)
+		return nil
+	})
+	if appErr != nil {
+		for _, v := range urls {
+			is.uploader.DeleteImageBySecureURL(context.Background(), v)
+		}
+		return nil, appErr
+	}
+	return item.Images, nil
+}
+
+func (is *ItemService) DeleteImage(itemId string, vendorId primitive.ObjectID, imageRef string) ([]Image, *errors.AppError) {
+	var removed Image
+	item, appErr := is.updateImages(itemId, vendorId, func(item *Item) *errors.AppError {
+		i := findImage(item.Images, imageRef)
+		if i < 0 {
+			return errors.NewError("image not found", 404)
+		}
+		removed = item.Images[i]
+		item.Images = append(item.Images[:i], item.Images[i+1:]...)
+		return nil
+	})
+	if appErr != nil {
+		return nil, appErr
+	}
+	is.uploader.DeleteImageBySecureURL(context.Background(), removed.URL)
+	return item.Images, nil
+}
+
+// ReorderImages sets the order of the item's images. imageRefs must list every image exactly once.
+func (is *ItemService) ReorderImages(itemId string, vendorId primitive.ObjectID, imageRefs []string) ([]Image, *errors.AppError) {
+	item, appErr := is.updateImages(itemId, vendorId, func(item *Item) *errors.AppError {
+		if len(imageRefs) != len(item.Images) {
+			return errors.NewError("every image of the item must be listed exactly once", 400)
+		}
+		reordered := make([]Image, 0, len(item.Images))
+		used := make([]bool, len(item.Images))
+		for _, ref := range imageRefs {
+			i := findImage(item.Images, ref)
+			if i < 0 {
+				return errors.NewError("image not found: "+ref, 404)
+			}
+			if used[i] {
+				return errors.NewError("duplicate image: "+ref, 400)
+			}
+			used[i] = true
+			reordered = append(reordered, item.Images[i])
+		}
+		item.Images = reordered
+		return nil
+	})
+	if appErr != nil {
+		return nil, appErr
+	}
+	return item.Images, nil
+}
+
+func (is *ItemService) SetPrimaryImage(itemId string, vendorId primitive.ObjectID, imageRef string) ([]Image, *errors.AppError) {
+	item, appErr := is.updateImages(itemId, vendorId, func(item *Item) *errors.AppError {
+		i := findImage(item.Images, imageRef)
+		if i < 0 {
+			return errors.NewError("image not found", 404)
+		}
+		for j := range item.Images {
+			item.Images[j].Primary = j == i
+		}
+		return nil
+	})
+	if appErr != nil {
+		return nil, appErr
+	}
+	return item.Images, nil
+}
+
+func (is *ItemService) UpdateImageAlt(itemId string, vendorId primitive.ObjectID, imageRef, alt string) ([]Image, *errors.AppError) {
+	item, appErr := is.updateImages(itemId, vendorId, func(item *Item) *errors.AppError {
+		i := findImage(item.Images, imageRef)
+		if i < 0 {
+			return errors.NewError("image not found", 404)
+		}
+		item.Images[i].Alt = alt
+		return nil
+	})
+	if appErr != nil {
+		return nil, appErr
+	}
+	return item.Images, nil
+}
+
+func (is *ItemService) getVendorItem(itemId string, vendorId primitive.ObjectID) (*Item, *errors.AppError) {
+	item_id, err := primitive.ObjectIDFromHex(itemId)
+	if err != nil {
+		return nil, errors.ErrInvalidObjectID
+	}
+	item, err := is.itemRepository.GetItem(bson.M{"_id": item_id, "vendor_id": vendorId})
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			err := errors.ErrNotFound
+			return nil, errors.NewError("item not found: "+err.Error(), err.StatusCode)
+		}
+		return nil, errors.ErrInternalServer
+	}
+	return item, nil
+}
+
+// updateImages applies change to the vendor's item and writes only its images, leaving every other
+// field untouched. The write is guarded by the item's version, so concurrent image changes are
+// retried on the fresh item instead of overwriting each other.
+func (is *ItemService) updateImages(itemId string, vendorId primitive.ObjectID, change func(item *Item) *errors.AppError) (*Item, *errors.AppError) {
+	for attempt := 0; attempt < constants.MaxImageSaveAttempts; attempt++ {
+		item, appErr := is.getVendorItem(itemId, vendorId)
+		if appErr != nil {
+			return nil, appErr
+		}
+		if appErr := change(item); appErr != nil {
+			return nil, appErr
+		}
+		normalizeImages(item.Images)
+		filter := utils.WithVersion(bson.M{"_id": item.ID, "vendor_id": vendorId}, item.Version)
+		updated, err := is.itemRepository.FindOneAndUpdateItem(filter, bson.M{
+			"$set": bson.M{"images": item.Images, "updated_at": time.Now()},
+			"$inc": bson.M{"version": 1},
+		}, options.FindOneAndUpdate().SetReturnDocument(options.After))
+		if err == mongo.ErrNoDocuments {
+			continue
+		}
+		if err != nil {
+			return nil, errors.NewError("internal error: "+err.Error(), 500)
+		}
+		return updated, nil
+	}
+	return nil, errors.ErrVersionConflict
+}
@@ -1,22 +1,143 @@
 package item
 
 import (
+	"strings"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type Item struct {
-	ID          primitive.ObjectID   `json:"id" bson:"_id,omitempty"`
-	Name        string               `json:"name" bson:"name"`
-	Slug        string               `json:"slug" bson:"slug"`
-	Description string               `json:"description" bson:"description"`
-	CategoryID  []primitive.ObjectID `json:"category_id" bson:"category_id,omitempty"`
-	Price       float64              `json:"price" bson:"price"`
-	Discount    float64              `json:"discount" bson:"discount"`
-	Quantity    int                  `json:"quantity" bson:"quantity"`
-	Images      []string             `json:"images" bson:"images"`
-	VendorID    primitive.ObjectID   `json:"vendor_id" bson:"vendor_id,omitempty"`
-	CreatedAt   time.Time            `json:"created_at" bson:"created_at"`
-	UpdatedAt   time.Time            `json:"updated_at" bson:"updated_at"`
+	ID             primitive.ObjectID     `json:"id" bson:"_id,omitempty"`
+	Name           string                 `json:"name" bson:"name"`
+	Slug           string                 `json:"slug" bson:"slug"`
+	SlugHistory    []string               `json:"-" bson:"slug_history,omitempty"`
+	Description    string                 `json:"description" bson:"description"`
+	CategoryID     []primitive.ObjectID   `json:"category_id" bson:"category_id,omitempty"`
+	Price          float64                `json:"price" bson:"price"`
+	Discount       float64                `json:"discount" bson:"discount"`
+	Quantity       int                    `json:"quantity" bson:"quantity"`
+	EffectivePrice float64                `json:"effective_price" bson:"-"`
+	SaleEndsAt     *time.Time             `json:"sale_ends_at,omitempty" bson:"-"`
+	Images         []Image                `json:"images" bson:"images"`
+	Attributes     map[string]interface{} `json:"attributes,omitempty" bson:"attributes,omitempty"`
+	Tags           []string               `json:"tags,omitempty" bson:"tags,omitempty"`
+	Type           ItemType               `json:"type" bson:"type,omitempty"`
+	Digital        *DigitalContent        `json:"digital,omitempty" bson:"digital,omitempty"`
+	Components     []BundleComponent      `json:"components,omitempty" bson:"components,omitempty"`
+	Status         ItemStatus             `json:"status" bson:"status,omitempty"`
+	ViewCount      int                    `json:"view_count" bson:"view_count,omitempty"`
+	Rating         *Rating                `json:"rating,omitempty" bson:"rating,omitempty"`
+	Score          float64                `json:"score,omitempty" bson:"score,omitempty"`
+	VendorID       primitive.ObjectID     `json:"vendor_id" bson:"vendor_id,omitempty"`
+	Version        int64                  `json:"version" bson:"version"`
+	CreatedAt      time.Time              `json:"created_at" bson:"created_at"`
+	UpdatedAt      time.Time              `json:"updated_at" bson:"updated_at"`
+}
+
+type ItemType string
+
+const (
+	Physical ItemType = "physical"
+	Digital  ItemType = "digital"
+	Bundle   ItemType = "bundle"
+)
+
+// ItemStatus controls whether an item is shown to customers. Items saved before
+// statuses existed have none and are published.
+type ItemStatus string
+
+const (
+	Published ItemStatus = "published"
+	Draft     ItemStatus = "draft"
+)
+
+type DeliveryMethod string
+
+const (
+	DownloadDelivery   DeliveryMethod = "download"
+	LicenseKeyDelivery DeliveryMethod = "license_key"
+)
+
+// DigitalContent describes how a digital item is delivered after payment.
+// Downloads have unlimited stock; licence key items are stocked by their key pool.
+// FileID is the downloadable file's private media id. FileURL is the public url of files
+// uploaded before downloads were private, which vendors should upload again.
+type DigitalContent struct {
+	Delivery     DeliveryMethod `json:"delivery" bson:"delivery"`
+	FileID       string         `json:"-" bson:"file_id,omitempty"`
+	FileURL      string         `json:"-" bson:"file_url,omitempty"`
+	MaxDownloads int            `json:"max_downloads,omitempty" bson:"max_downloads,omitempty"`
+}
+
+// BundleComponent is one physical item, and how many of it, that a bundle is made of
+type BundleComponent struct {
+	ItemID   primitive.ObjectID `json:"item_id" bson:"item_id"`
+	Quantity int                `json:"quantity" bson:"quantity"`
+}
+
+// items created before item types existed have no type and are physical
+func (i *Item) IsDigital() bool {
+	return i.Type == Digital && i.Digital != nil
+}
+
+func (i *Item) HasUnlimitedStock() bool {
+	return i.IsDigital() && i.Digital.Delivery == DownloadDelivery
+}
+
+func (i *Item) RequiresShipping() bool {
+	return !i.IsDigital()
+}
+
+func (i *Item) IsPublished() bool {
+	return i.Status != Draft
+}
+
+func (i *Item) InStock() bool {
+	return i.HasUnlimitedStock() || i.Quantity > 0
+}
+
+func (i *Item) IsBundle() bool {
+	return i.Type == Bundle
+}
+
+// BundleAvailability is how many bundles can be made from the given component stock
+func BundleAvailability(components []BundleComponent, stock map[primitive.ObjectID]int) int {
+	available := -1
+	for _, v := range components {
+		if v.Quantity <= 0 {
+			continue
+		}
+		n := stock[v.ItemID] / v.Quantity
+		if available < 0 || n < available {
+			available = n
+		}
+	}
+	if available < 0 {
+		return 0
+	}
+	return available
+}
+
+// BasePrice is the price after the item's permanent discount, before any sale
+func (i *Item) BasePrice() float64 {
+	if i.Discount > 0 {
+		return i.Price - i.Price*i.Discount/100
+	}
+	return i.Price
+}
+
+// NormalizeTags lowercases and trims tags and drops empty and repeated ones
+func NormalizeTags(tags []string) []string {
+	normalized := make([]string, 0, len(tags))
+	seen := make(map[string]bool, len(tags))
+	for _, v := range tags {
+		tag := strings.ToLower(strings.TrimSpace(v))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	return normalized
 }
@@ -0,0 +1,215 @@
+package item
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/ayo-ajayi/ecommerce/internal/errors"
+	"github.com/ayo-ajayi/ecommerce/internal/utils"
+	"github.com/gosimple/slug"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// PatchItem applies a JSON merge patch to the vendor's item. Only the patched fields are written,
+// and only if the item is still at version. Images are changed through the image endpoints.
+func (is *ItemService) PatchItem(itemId string, vendorId primitive.ObjectID, patch map[string]json.RawMessage, version int64) (*Item, *errors.AppError) {
+	oldItem, appErr := is.getVendorItem(itemId, vendorId)
+	if appErr != nil {
+		return nil, appErr
+	}
+	if oldItem.Version != version {
+		return nil, errors.ErrVersionConflict
+	}
+	item, fields, appErr := applyItemPatch(oldItem, patch)
+	if appErr != nil {
+		return nil, appErr
+	}
+	if len(fields) == 0 {
+		return nil, errors.NewError("nothing to update", 400)
+	}
+	if err := validateItemType(item); err != nil {
+		return nil, err
+	}
+	if fields["components"] {
+		if err := is.validateBundle(item); err != nil {
+			return nil, err
+		}
+	}
+	if fields["category_id"] || fields["attributes"] {
+		if err := is.validateCategories(item); err != nil {
+			return nil, err
+		}
+		fields["attributes"] = true
+	}
+
+	values := map[string]interface{}{
+		"name":        item.Name,
+		"description": item.Description,
+		"category_id": item.CategoryID,
+		"price":       item.Price,
+		"discount":    item.Discount,
+		"quantity":    item.Quantity,
+		"attributes":  item.Attributes,
+		"tags":        item.Tags,
+		"status":      item.Status,
+		"digital":     item.Digital,
+		"components":  item.Components,
+	}
+	set := bson.M{"updated_at": time.Now()}
+	for field := range fields {
+		set[field] = values[field]
+	}
+	filter := utils.WithVersion(bson.M{"_id": oldItem.ID, "vendor_id": vendorId}, version)
+	update := bson.M{"$set": set, "$inc": bson.M{"version": 1}}
+	var updated *Item
+	save := func() error {
+		var err error
+		updated, err = is.itemRepository.FindOneAndUpdateItem(filter, update, options.FindOneAndUpdate().SetReturnDocument(options.After))
+		return err
+	}
+	var err error
+	if base := slug.Make(item.Name); base == slug.Make(oldItem.Name) {
+		err = save()
+	} else {
+		_, err = utils.SaveWithUniqueSlug(base, func(slug string) error {
+			set["slug"] = slug
+			set["slug_history"] = utils.SlugHistory(oldItem.SlugHistory, oldItem.Slug, slug)
+			return save()
+		})
+	}
+	if err == mongo.ErrNoDocuments {
+		return nil, errors.ErrVersionConflict
+	}
+	if err != nil {
+		return nil, errors.ErrInternalServer
+	}
+	is.notify(oldItem, updated)
+	if err := is.PrepareItems(updated); err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+// applyItemPatch returns a copy of item with the patch applied and the fields it changed.
+// Each field is validated on its own here; rules spanning fields are checked by the caller.
+func applyItemPatch(item *Item, patch map[string]json.RawMessage) (*Item, map[string]bool, *errors.AppError) {
+	patched := *item
+	if item.Digital != nil {
+		digital := *item.Digital
+		patched.Digital = &digital
+	}
+	fields := make(map[string]bool, len(patch))
+	for field, raw := range patch {
+		null := utils.IsNull(raw)
+		invalid := errors.NewError("invalid "+field, 400)
+		switch field {
+		case "version":
+			continue
+		case "name", "description":
+			var value string
+			if err := json.Unmarshal(raw, &value); err != nil || value == "" {
+				return nil, nil, invalid
+			}
+			if field == "name" {
+				patched.Name = value
+			} else {
+				patched.Description = value
+			}
+		case "price", "discount":
+			var value float64
+			if err := json.Unmarshal(raw, &value); err != nil || null || value < 0 || (field == "discount" && value > 100) {
+				return nil, nil, invalid
+			}
+			if field == "price" {
+				patched.Price = value
+			} else {
+				patched.Discount = value
+			}
+		case "quantity":
+			if patched.Type != "" && patched.Type != Physical {
+				return nil, nil, errors.NewError("quantity can only be set on physical items", 400)
+			}
+			if err := json.Unmarshal(raw, &patched.Quantity); err != nil || null || patched.Quantity < 0 {
+				return nil, nil, invalid
+			}
+		case "category_id":
+			patched.CategoryID = []primitive.ObjectID{}
+			if err := json.Unmarshal(raw, &patched.CategoryID); err != nil {
+				return nil, nil, invalid
+			}
+			if patched.CategoryID == nil {
+				patched.CategoryID = []primitive.ObjectID{}
+			}
+		case "attributes":
+			// attributes are merged key by key: null removes an attribute
+			var changes map[string]interface{}
+			if err := json.Unmarshal(raw, &changes); err != nil {
+				return nil, nil, invalid
+			}
+			attributes := make(map[string]interface{}, len(item.Attributes))
+			if !null {
+				for k, v := range item.Attributes {
+					attributes[k] = v
+				}
+			}
+			for k, v := range changes {
+				if v == nil {
+					delete(attributes, k)
+				} else {
+					attributes[k] = v
+				}
+			}
+			patched.Attributes = attributes
+		case "tags":
+			patched.Tags = nil
+			if err := json.Unmarshal(raw, &patched.Tags); err != nil {
+				return nil, nil, invalid
+			}
+			patched.Tags = NormalizeTags(patched.Tags)
+		case "status":
+			if err := json.Unmarshal(raw, &patched.Status); err != nil || null {
+				return nil, nil, invalid
+			}
+		case "digital":
+			if !patched.IsDigital() {
+				return nil, nil, errors.NewError("digital can only be set on digital items", 400)
+			}
+			// the file is replaced through a full update, so only the delivery settings are patchable
+			changes := struct {
+				Delivery     *DeliveryMethod `json:"delivery"`
+				MaxDownloads *int            `json:"max_downloads"`
+			}{}
+			if err := json.Unmarshal(raw, &changes); err != nil || null {
+				return nil, nil, invalid
+			}
+			if changes.Delivery != nil {
+				patched.Digital.Delivery = *changes.Delivery
+			}
+			if changes.MaxDownloads != nil {
+				if *changes.MaxDownloads < 0 {
+					return nil, nil, errors.NewError("invalid max downloads", 400)
+				}
+				patched.Digital.MaxDownloads = *changes.MaxDownloads
+			}
+		case "components":
+			if !patched.IsBundle() {
+				return nil, nil, errors.NewError("components can only be set on bundles", 400)
+			}
+			patched.Components = nil
+			if err := json.Unmarshal(raw, &patched.Components); err != nil {
+				return nil, nil, invalid
+			}
+		case "type":
+			return nil, nil, errors.NewError("the item type cannot be changed", 400)
+		case "images":
+			return nil, nil, errors.NewError("images are changed through the image endpoints", 400)
+		default:
+			return nil, nil, errors.NewError("field cannot be patched: "+field, 400)
+		}
+		fields[field] = true
+	}
+	return &patched, fields, nil
+}
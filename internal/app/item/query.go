@@ -0,0 +1,154 @@
+package item
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/ayo-ajayi/ecommerce/internal/app/category"
+	"github.com/ayo-ajayi/ecommerce/internal/errors"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type ItemQuery struct {
+	CategoryID         []primitive.ObjectID
+	IncludeDescendants bool
+	Attributes         map[string]string
+	AttributesMin      map[string]string
+	AttributesMax      map[string]string
+	MinRating          float64
+	Sort               ItemSort
+}
+
+// ItemSort orders a listing. Listings are unordered when it is empty.
+type ItemSort string
+
+const (
+	// SortByRating lists the best rated items first, and the most reviewed first among equals
+	SortByRating ItemSort = "rating"
+	// SortByReviewCount lists the most reviewed items first
+	SortByReviewCount ItemSort = "review_count"
+)
+
+// ParseItemQuery reads listing filters such as ?category_id=..&include_descendants=true&attr[color]=red,blue&attr_min[ram]=8&min_rating=4&sort=rating
+func ParseItemQuery(c *gin.Context) (*ItemQuery, *errors.AppError) {
+	query := &ItemQuery{
+		Attributes:    c.QueryMap("attr"),
+		AttributesMin: c.QueryMap("attr_min"),
+		AttributesMax: c.QueryMap("attr_max"),
+		Sort:          ItemSort(c.Query("sort")),
+	}
+	switch query.Sort {
+	case "", SortByRating, SortByReviewCount:
+	default:
+		return nil, errors.NewError("invalid sort", 400)
+	}
+	if v := c.Query("min_rating"); v != "" {
+		minRating, err := strconv.ParseFloat(v, 64)
+		if err != nil || minRating < 0 || minRating > 5 {
+			return nil, errors.NewError("invalid min_rating", 400)
+		}
+		query.MinRating = minRating
+	}
+	if v := c.Query("include_descendants"); v != "" {
+		include, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, errors.NewError("invalid include_descendants", 400)
+		}
+		query.IncludeDescendants = include
+	}
+	for _, v := range c.QueryArray("category_id") {
+		categoryID, err := primitive.ObjectIDFromHex(v)
+		if err != nil {
+			return nil, errors.NewError("invalid category id", 400)
+		}
+		query.CategoryID = append(query.CategoryID, categoryID)
+	}
+	return query, nil
+}
+
+// ExpandCategories adds the descendants of the queried categories when they were asked for
+func (q *ItemQuery) ExpandCategories(tree CategoryTree) *errors.AppError {
+	if q == nil || !q.IncludeDescendants || len(q.CategoryID) == 0 {
+		return nil
+	}
+	categoryIDs, err := tree.Descendants(q.CategoryID)
+	if err != nil {
+		return err
+	}
+	q.CategoryID = categoryIDs
+	return nil
+}
+
+// Filter builds the listing filter. Draft items are never listed.
+func (q *ItemQuery) Filter() (bson.M, *errors.AppError) {
+	filter := bson.M{"status": bson.M{"$ne": Draft}}
+	if q == nil {
+		return filter, nil
+	}
+	if len(q.CategoryID) > 0 {
+		filter["category_id"] = bson.M{"$in": q.CategoryID}
+	}
+	if q.MinRating > 0 {
+		filter["rating.average"] = bson.M{"$gte": q.MinRating}
+	}
+	for name, value := range q.Attributes {
+		if !category.IsValidAttributeName(name) {
+			return nil, errors.NewError("invalid attribute filter: "+name, 400)
+		}
+		var candidates []interface{}
+		for _, v := range strings.Split(value, ",") {
+			candidates = append(candidates, attributeFilterValues(v)...)
+		}
+		filter["attributes."+name] = bson.M{"$in": candidates}
+	}
+	for op, bounds := range map[string]map[string]string{"$gte": q.AttributesMin, "$lte": q.AttributesMax} {
+		for name, value := range bounds {
+			if !category.IsValidAttributeName(name) {
+				return nil, errors.NewError("invalid attribute filter: "+name, 400)
+			}
+			num, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return nil, errors.NewError("invalid range for attribute: "+name, 400)
+			}
+			key := "attributes." + name
+			rng, ok := filter[key].(bson.M)
+			if !ok {
+				rng = bson.M{}
+				filter[key] = rng
+			}
+			rng[op] = num
+		}
+	}
+	return filter, nil
+}
+
+// FindOptions orders the listing
+func (q *ItemQuery) FindOptions() *options.FindOptions {
+	opts := options.Find()
+	if q == nil {
+		return opts
+	}
+	switch q.Sort {
+	case SortByRating:
+		opts.SetSort(bson.D{{Key: "rating.average", Value: -1}, {Key: "rating.count", Value: -1}, {Key: "_id", Value: 1}})
+	case SortByReviewCount:
+		opts.SetSort(bson.D{{Key: "rating.count", Value: -1}, {Key: "_id", Value: 1}})
+	}
+	return opts
+}
+
+// attributeFilterValues returns every typed form a query string value could be stored as
+func attributeFilterValues(value string) []interface{} {
+	value = strings.TrimSpace(value)
+	values := []interface{}{value}
+	if num, err := strconv.ParseFloat(value, 64); err == nil {
+		values = append(values, num)
+	}
+	if value == "true" || value == "false" {
+		values = append(values, value == "true")
+	}
+	return values
+}
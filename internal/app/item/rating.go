@@ -0,0 +1,25 @@
+package item
+
+import "math"
+
+// Rating summarises an item's reviews. It is kept current by the review service.
+// Histogram holds the number of 1 to 5 star reviews at index 0 to 4.
+type Rating struct {
+	Average   float64 `json:"average" bson:"average"`
+	Count     int     `json:"count" bson:"count"`
+	Histogram [5]int  `json:"histogram" bson:"histogram"`
+}
+
+// NewRating summarises a star histogram, rounding the average to two decimal places
+func NewRating(histogram [5]int) *Rating {
+	rating := &Rating{Histogram: histogram}
+	total := 0
+	for i, count := range histogram {
+		rating.Count += count
+		total += (i + 1) * count
+	}
+	if rating.Count > 0 {
+		rating.Average = math.Round(float64(total)/float64(rating.Count)*100) / 100
+	}
+	return rating
+}
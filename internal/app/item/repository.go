@@ -1,6 +1,8 @@
 package item
 
 import (
+	"context"
+
 	"github.com/ayo-ajayi/ecommerce/internal/database"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
@@ -43,6 +45,38 @@ func (ir *ItemRepo) UpdateItem(filter interface{}, update interface{}, opts ...*
 	return err
 }
 
+// UpdateItemTx is UpdateItem as part of the transaction ctx belongs to
+func (ir *ItemRepo) UpdateItemTx(ctx context.Context, filter interface{}, update interface{}) error {
+	_, err := ir.Collection.UpdateOne(ctx, filter, update)
+	return err
+}
+
+func (ir *ItemRepo) UpdateItems(filter interface{}, update interface{}, opts ...*options.UpdateOptions) error {
+	ctx, cancel := database.DBReqContext(5)
+	defer cancel()
+	_, err := ir.Collection.UpdateMany(ctx, filter, update, opts...)
+	return err
+}
+
+// UpdateItemsTx is UpdateItems as part of the transaction ctx belongs to
+func (ir *ItemRepo) UpdateItemsTx(ctx context.Context, filter interface{}, update interface{}) error {
+	_, err := ir.Collection.UpdateMany(ctx, filter, update)
+	return err
+}
+
+// FindOneAndUpdateItem applies update to the first matching item and returns it.
+// It returns mongo.ErrNoDocuments when nothing matched, which makes it usable for guarded updates.
+func (ir *ItemRepo) FindOneAndUpdateItem(filter interface{}, update interface{}, opts ...*options.FindOneAndUpdateOptions) (*Item, error) {
+	ctx, cancel := database.DBReqContext(5)
+	defer cancel()
+	var item Item
+	err := ir.Collection.FindOneAndUpdate(ctx, filter, update, opts...).Decode(&item)
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
 func (ir *ItemRepo) GetItem(filter interface{}, opts ...*options.FindOneOptions) (*Item, error) {
 	ctx, cancel := database.DBReqContext(5)
 	defer cancel()
@@ -73,6 +107,22 @@ func (ir *ItemRepo) GetItems(filter interface{}, opts ...*options.FindOptions) (
 	return items, nil
 }
 
+func (ir *ItemRepo) CountItems(filter interface{}) (int64, error) {
+	ctx, cancel := database.DBReqContext(5)
+	defer cancel()
+	return ir.Collection.CountDocuments(ctx, filter)
+}
+
+func (ir *ItemRepo) Aggregate(pipeline interface{}, result interface{}) error {
+	ctx, cancel := database.DBReqContext(5)
+	defer cancel()
+	cursor, err := ir.Collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return err
+	}
+	return cursor.All(ctx, result)
+}
+
 func (ir *ItemRepo) DeleteItem(filter interface{}, opts ...*options.DeleteOptions) error {
 	ctx, cancel := database.DBReqContext(5)
 	defer cancel()
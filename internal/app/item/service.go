@@ -3,11 +3,11 @@ package item
 import (
 	"context"
 	"mime/multipart"
-	"sync"
 	"time"
 
+	"github.com/ayo-ajayi/ecommerce/internal/app/category"
 	"github.com/ayo-ajayi/ecommerce/internal/errors"
-	"github.com/google/uuid"
+	"github.com/ayo-ajayi/ecommerce/internal/utils"
 	"github.com/gosimple/slug"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -19,47 +19,102 @@ type ItemService struct {
 	itemRepository     ItemRepository
 	categoryRepository CategoryRepository
 	uploader           Uploader
+	priceResolver      PriceResolver
+	categoryTree       CategoryTree
+	hooks              []ItemHook
 }
 type CategoryRepository interface {
 	IsExists(filter interface{}, opts ...*options.FindOneOptions) (bool, error)
+	GetCategories(filter interface{}, opts ...*options.FindOptions) ([]*category.Category, error)
 }
 type ItemRepository interface {
 	IsExists(filter interface{}, opts ...*options.FindOneOptions) (bool, error)
 	CreateItem(item *Item) error
 	UpdateItem(filter interface{}, update interface{}, opts ...*options.UpdateOptions) error
+	FindOneAndUpdateItem(filter interface{}, update interface{}, opts ...*options.FindOneAndUpdateOptions) (*Item, error)
 	GetItem(filter interface{}, opts ...*options.FindOneOptions) (*Item, error)
 	GetItems(filter interface{}, opts ...*options.FindOptions) ([]*Item, error)
 	DeleteItem(filter interface{}, opts ...*options.DeleteOptions) error
 }
+
+// CategoryTree walks the category hierarchy
+type CategoryTree interface {
+	Descendants(ids []primitive.ObjectID) ([]primitive.ObjectID, *errors.AppError)
+}
+
+// ItemHook is told about each item change once it is saved. old is nil for a new item and
+// item is nil for a deleted one.
+type ItemHook interface {
+	ItemChanged(old, item *Item)
+}
+type PriceResolver interface {
+	ResolvePrices(items ...*Item) *errors.AppError
+}
 type Uploader interface {
 	UploadImage(ctx context.Context, files []*multipart.FileHeader, collection string) ([]string, *errors.AppError)
+	UploadFile(ctx context.Context, file *multipart.FileHeader, collection string) (string, *errors.AppError)
 	DeleteImageBySecureURL(ctx context.Context, secureUrl string) *errors.AppError
+	DeleteFile(ctx context.Context, publicID string) *errors.AppError
 }
 
-func NewItemService(itemRepository ItemRepository, categoryRepository CategoryRepository, uploader Uploader) *ItemService {
-	return &ItemService{itemRepository, categoryRepository, uploader}
+func NewItemService(itemRepository ItemRepository, categoryRepository CategoryRepository, uploader Uploader, priceResolver PriceResolver, categoryTree CategoryTree) *ItemService {
+	return &ItemService{
+		itemRepository:     itemRepository,
+		categoryRepository: categoryRepository,
+		uploader:           uploader,
+		priceResolver:      priceResolver,
+		categoryTree:       categoryTree,
+	}
 }
 
-func (is *ItemService) CreateItem(item *Item) *errors.AppError {
-	item.Slug = slug.Make(item.Name)
-	itemExists, err := is.itemRepository.IsExists(bson.M{
-		"slug": item.Slug,
-	})
-	if err != nil {
-		return errors.ErrInternalServer
+// AddHook registers a hook to be told about item changes
+func (is *ItemService) AddHook(hook ItemHook) {
+	is.hooks = append(is.hooks, hook)
+}
+
+func (is *ItemService) notify(old, item *Item) {
+	for _, v := range is.hooks {
+		v.ItemChanged(old, item)
 	}
-	if itemExists {
-		item.Slug = item.Slug + "-" + uuid.New().String()
+}
+
+// CreateItem saves the new item. Its images and file were uploaded for it, so they are
+// deleted again if the item is not saved.
+func (is *ItemService) CreateItem(item *Item) *errors.AppError {
+	images, fileID := uploadsOf(item)
+	if err := is.createItem(item); err != nil {
+		is.discardUploads(images, fileID)
+		return err
 	}
+	return nil
+}
+
+func (is *ItemService) createItem(item *Item) *errors.AppError {
 	item.CreatedAt = time.Now()
 	item.UpdatedAt = time.Now()
-	if err := is.checkCategoryID(item.CategoryID); err != nil {
+	item.Version = 1
+	if err := validateItemType(item); err != nil {
 		return err
 	}
-	err = is.itemRepository.CreateItem(item)
-	if err != nil {
+	if err := is.validateBundle(item); err != nil {
+		return err
+	}
+	if item.IsDigital() || item.IsBundle() {
+		// licence key stock comes from the key pool and bundle stock from its components
+		item.Quantity = 0
+	}
+	if err := is.validateCategories(item); err != nil {
+		return err
+	}
+	normalizeImages(item.Images)
+	item.Tags = NormalizeTags(item.Tags)
+	if _, err := utils.SaveWithUniqueSlug(slug.Make(item.Name), func(slug string) error {
+		item.Slug = slug
+		return is.itemRepository.CreateItem(item)
+	}); err != nil {
 		return errors.ErrInternalServer
 	}
+	is.notify(nil, item)
 	return nil
 }
 
@@ -79,10 +134,11 @@ func (is *ItemService) DeleteItem(itemId string, userId primitive.ObjectID) *err
 	if err := is.itemRepository.DeleteItem(bson.M{"_id": item_id, "vendor_id": vendorId}); err != nil {
 		return errors.NewError("internal error: "+err.Error(), 500)
 	}
+	is.notify(item, nil)
 	oldImages := item.Images
 	if len(oldImages) > 0 {
 		for _, v := range oldImages {
-			is.uploader.DeleteImageBySecureURL(context.Background(), v)
+			is.uploader.DeleteImageBySecureURL(context.Background(), v.URL)
 		}
 	}
 	return nil
@@ -92,16 +148,36 @@ func (is *ItemService) UploadImage(ctx context.Context, files []*multipart.FileH
 	return is.uploader.UploadImage(ctx, files, collection)
 }
 
-func (is *ItemService) GetItems() ([]*Item, *errors.AppError) {
-	items, err := is.itemRepository.GetItems(bson.M{})
+func (is *ItemService) UploadFile(ctx context.Context, file *multipart.FileHeader, collection string) (string, *errors.AppError) {
+	return is.uploader.UploadFile(ctx, file, collection)
+}
+
+func (is *ItemService) GetItems(query *ItemQuery) ([]*Item, *errors.AppError) {
+	if err := query.ExpandCategories(is.categoryTree); err != nil {
+		return nil, err
+	}
+	filter, appErr := query.Filter()
+	if appErr != nil {
+		return nil, appErr
+	}
+	items, err := is.itemRepository.GetItems(filter, query.FindOptions())
 	if err != nil {
 		return nil, errors.ErrInternalServer
 	}
+	if err := is.PrepareItems(items...); err != nil {
+		return nil, err
+	}
 	return items, nil
 }
 
-func (is *ItemService) GetItemBySlug(slug string) (*Item, *errors.AppError) {
+// GetItemBySlug finds the item by its current slug or, failing that, by a slug it had before.
+// Callers can tell the two apart by comparing slug with the returned item's Slug. Drafts are
+// only found by their vendor.
+func (is *ItemService) GetItemBySlug(slug string, viewerId primitive.ObjectID) (*Item, *errors.AppError) {
 	item, err := is.itemRepository.GetItem(bson.M{"slug": slug})
+	if err == mongo.ErrNoDocuments {
+		item, err = is.itemRepository.GetItem(bson.M{"slug_history": slug}, options.FindOne().SetSort(bson.D{{Key: "updated_at", Value: -1}}))
+	}
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
 			err := errors.ErrNotFound
@@ -109,6 +185,13 @@ func (is *ItemService) GetItemBySlug(slug string) (*Item, *errors.AppError) {
 		}
 		return nil, errors.ErrInternalServer
 	}
+	if !item.IsPublished() && item.VendorID != viewerId {
+		err := errors.ErrNotFound
+		return nil, errors.NewError("item not found: "+err.Error(), err.StatusCode)
+	}
+	if err := is.PrepareItems(item); err != nil {
+		return nil, err
+	}
 	return item, nil
 }
 
@@ -118,10 +201,14 @@ func (is *ItemService) GetVendorItems(vendorid primitive.ObjectID) ([]*Item, *er
 	if err != nil {
 		return nil, errors.ErrInternalServer
 	}
+	if err := is.PrepareItems(items...); err != nil {
+		return nil, err
+	}
 	return items, nil
 }
 
-func (is *ItemService) GetItemByID(itemId string) (*Item, *errors.AppError) {
+// GetItemByID returns the item. Drafts are only found by their vendor.
+func (is *ItemService) GetItemByID(itemId string, viewerId primitive.ObjectID) (*Item, *errors.AppError) {
 	item_id, err := primitive.ObjectIDFromHex(itemId)
 	if err != nil {
 		return nil, errors.ErrInvalidObjectID
@@ -134,12 +221,29 @@ func (is *ItemService) GetItemByID(itemId string) (*Item, *errors.AppError) {
 		}
 		return nil, errors.ErrInternalServer
 	}
+	if !item.IsPublished() && item.VendorID != viewerId {
+		err := errors.ErrNotFound
+		return nil, errors.NewError("item not found: "+err.Error(), err.StatusCode)
+	}
+	if err := is.PrepareItems(item); err != nil {
+		return nil, err
+	}
 	return item, nil
 }
 
+// UpdateItem replaces the vendor's item with item, but only if the item is still at item.Version.
+// The new images and file were uploaded for the update, so they are deleted again if it fails.
 func (is *ItemService) UpdateItem(item *Item) *errors.AppError {
+	images, fileID := uploadsOf(item)
+	if err := is.updateItem(item); err != nil {
+		is.discardUploads(images, fileID)
+		return err
+	}
+	return nil
+}
 
-	oldItem, err := is.itemRepository.GetItem(bson.M{"_id": item.ID})
+func (is *ItemService) updateItem(item *Item) *errors.AppError {
+	oldItem, err := is.itemRepository.GetItem(bson.M{"_id": item.ID, "vendor_id": item.VendorID})
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
 			err := errors.ErrNotFound
@@ -147,55 +251,253 @@ func (is *ItemService) UpdateItem(item *Item) *errors.AppError {
 		}
 		return errors.ErrInternalServer
 	}
+	if oldItem.Version != item.Version {
+		return errors.ErrVersionConflict
+	}
+	// stock reserved in carts and licence keys in the pool depend on the type
+	if itemType(item) != itemType(oldItem) {
+		return errors.NewError("the item type cannot be changed", 400)
+	}
 	item.UpdatedAt = time.Now()
 	item.CreatedAt = oldItem.CreatedAt
-	item.Slug = slug.Make(item.Name)
+	if item.IsDigital() && oldItem.IsDigital() {
+		if item.Digital.FileID == "" {
+			item.Digital.FileID, item.Digital.FileURL = oldItem.Digital.FileID, oldItem.Digital.FileURL
+		}
+		item.Quantity = oldItem.Quantity
+	}
+	if err := validateItemType(item); err != nil {
+		return err
+	}
+	if err := is.validateBundle(item); err != nil {
+		return err
+	}
 
-	if err := is.checkCategoryID(item.CategoryID); err != nil {
+	if err := is.validateCategories(item); err != nil {
 		return err
 	}
-	if err := is.itemRepository.UpdateItem(bson.M{"_id": item.ID}, bson.M{"$set": item}); err != nil {
-		return errors.ErrInternalServer
+	normalizeImages(item.Images)
+	item.Tags = NormalizeTags(item.Tags)
+	if err := is.saveItem(item, oldItem); err != nil {
+		return err
 	}
 	oldImages := oldItem.Images
 	if len(oldImages) > 0 {
 		for _, v := range oldImages {
-			is.uploader.DeleteImageBySecureURL(context.Background(), v)
+			is.uploader.DeleteImageBySecureURL(context.Background(), v.URL)
 		}
 	}
 	return nil
 }
 
-func (is *ItemService) checkCategoryID(categoryID []primitive.ObjectID) *errors.AppError {
-	var wg sync.WaitGroup
-	itemExistChan := make(chan *errors.AppError, len(categoryID))
-	var allErrors []*errors.AppError
+// uploadsOf returns the images and file uploaded with item, before any are carried over from the
+// item it replaces
+func uploadsOf(item *Item) ([]Image, string) {
+	if item.Digital == nil {
+		return item.Images, ""
+	}
+	return item.Images, item.Digital.FileID
+}
 
-	for _, v := range categoryID {
-		wg.Add(1)
-		go func(categoryID primitive.ObjectID) {
-			exists, err := is.categoryRepository.IsExists(bson.M{"_id": categoryID})
-			if err != nil {
-				itemExistChan <- errors.NewError("internal error: "+err.Error(), 500)
+func (is *ItemService) discardUploads(images []Image, fileID string) {
+	for _, v := range images {
+		is.uploader.DeleteImageBySecureURL(context.Background(), v.URL)
+	}
+	if fileID != "" {
+		is.uploader.DeleteFile(context.Background(), fileID)
+	}
+}
+
+// saveItem replaces oldItem with item unless it is no longer at the version item was made against.
+// The slug only changes when the name does, and the old slug is kept in the slug history so existing
+// links keep working.
+func (is *ItemService) saveItem(item, oldItem *Item) *errors.AppError {
+	filter := utils.WithVersion(bson.M{"_id": oldItem.ID}, item.Version)
+	item.Version++
+	save := func() error {
+		_, err := is.itemRepository.FindOneAndUpdateItem(filter, bson.M{"$set": item})
+		return err
+	}
+	var err error
+	if base := slug.Make(item.Name); base == slug.Make(oldItem.Name) {
+		item.Slug = oldItem.Slug
+		item.SlugHistory = oldItem.SlugHistory
+		err = save()
+	} else {
+		_, err = utils.SaveWithUniqueSlug(base, func(slug string) error {
+			item.Slug = slug
+			item.SlugHistory = utils.SlugHistory(oldItem.SlugHistory, oldItem.Slug, slug)
+			return save()
+		})
+	}
+	if err == mongo.ErrNoDocuments {
+		return errors.ErrVersionConflict
+	}
+	if err != nil {
+		return errors.ErrInternalServer
+	}
+	is.notify(oldItem, item)
+	return nil
+}
+
+// validateCategories checks that every category of the item exists and that the item's
+// attributes match the attribute schemas of those categories. Items without a category are
+// put in the default category.
+func (is *ItemService) validateCategories(item *Item) *errors.AppError {
+	var categories []*category.Category
+	if len(item.CategoryID) == 0 {
+		var err error
+		categories, err = is.categoryRepository.GetCategories(bson.M{"is_default": true})
+		if err != nil {
+			return errors.NewError("internal error: "+err.Error(), 500)
+		}
+		for _, v := range categories {
+			item.CategoryID = append(item.CategoryID, v.ID)
+		}
+	} else {
+		var err error
+		categories, err = is.categoryRepository.GetCategories(bson.M{"_id": bson.M{"$in": item.CategoryID}})
+		if err != nil {
+			return errors.NewError("internal error: "+err.Error(), 500)
+		}
+	}
+	found := make(map[primitive.ObjectID]bool, len(categories))
+	for _, v := range categories {
+		found[v.ID] = true
+	}
+	for _, v := range item.CategoryID {
+		if !found[v] {
+			err := errors.ErrNotFound
+			return errors.NewError("category not found: "+err.Error(), err.StatusCode)
+		}
+	}
+
+	attributes, err := category.NormalizeAttributes(categories, item.Attributes)
+	if err != nil {
+		return err
+	}
+	item.Attributes = attributes
+	return nil
+}
+
+// itemType is the item's type. Items saved before there were types are physical.
+func itemType(item *Item) ItemType {
+	if item.Type == "" {
+		return Physical
+	}
+	return item.Type
+}
+
+func validateItemType(item *Item) *errors.AppError {
+	if item.Type == "" {
+		item.Type = Physical
+	}
+	if item.Status == "" {
+		item.Status = Published
+	}
+	if item.Status != Published && item.Status != Draft {
+		return errors.NewError("invalid item status", 400)
+	}
+	switch item.Type {
+	case Physical:
+		item.Digital = nil
+		item.Components = nil
+		if item.Quantity < 0 {
+			return errors.NewError("invalid quantity", 400)
+		}
+	case Bundle:
+		item.Digital = nil
+		item.Quantity = 0
+		if len(item.Components) == 0 {
+			return errors.NewError("bundles require at least one component", 400)
+		}
+	case Digital:
+		item.Components = nil
+		if item.Digital == nil {
+			return errors.NewError("digital items require a delivery method", 400)
+		}
+		switch item.Digital.Delivery {
+		case DownloadDelivery:
+			if item.Digital.FileID == "" && item.Digital.FileURL == "" {
+				return errors.NewError("downloadable items require a file", 400)
 			}
-			if !exists {
-				err := errors.ErrNotFound
-				itemExistChan <- errors.NewError("category not found: "+err.Error(), err.StatusCode)
+		case LicenseKeyDelivery:
+			item.Digital.FileID, item.Digital.FileURL = "", ""
+			item.Digital.MaxDownloads = 0
+		default:
+			return errors.NewError("invalid delivery method", 400)
+		}
+	default:
+		return errors.NewError("invalid item type", 400)
+	}
+	return nil
+}
+
+// validateBundle checks that a bundle's components are distinct physical items of the same vendor
+func (is *ItemService) validateBundle(item *Item) *errors.AppError {
+	if !item.IsBundle() {
+		return nil
+	}
+	ids := make([]primitive.ObjectID, 0, len(item.Components))
+	seen := make(map[primitive.ObjectID]bool, len(item.Components))
+	for _, v := range item.Components {
+		if v.Quantity < 1 {
+			return errors.NewError("invalid component quantity", 400)
+		}
+		if seen[v.ItemID] || v.ItemID == item.ID {
+			return errors.NewError("invalid component: "+v.ItemID.Hex(), 400)
+		}
+		seen[v.ItemID] = true
+		ids = append(ids, v.ItemID)
+	}
+	components, err := is.itemRepository.GetItems(bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return errors.ErrInternalServer
+	}
+	if len(components) != len(ids) {
+		err := errors.ErrNotFound
+		return errors.NewError("component not found: "+err.Error(), err.StatusCode)
+	}
+	for _, v := range components {
+		if v.Type != "" && v.Type != Physical {
+			return errors.NewError("bundle components must be physical items: "+v.Name, 400)
+		}
+		if v.VendorID != item.VendorID {
+			return errors.NewError("bundle components must belong to the same vendor: "+v.Name, 400)
+		}
+	}
+	return nil
+}
+
+// PrepareItems fills in the request-time fields of items: the effective price and, for
+// bundles, the stock available from their components
+func (is *ItemService) PrepareItems(items ...*Item) *errors.AppError {
+	if err := is.priceResolver.ResolvePrices(items...); err != nil {
+		return err
+	}
+	var componentIDs []primitive.ObjectID
+	for _, v := range items {
+		if v.IsBundle() {
+			for _, c := range v.Components {
+				componentIDs = append(componentIDs, c.ItemID)
 			}
-			wg.Done()
-		}(v)
-	}
-	go func() {
-		wg.Wait()
-		close(itemExistChan)
-	}()
-	for err := range itemExistChan {
-		if err != nil {
-			allErrors = append(allErrors, err)
 		}
 	}
-	if len(allErrors) > 0 {
-		return allErrors[0]
+	if len(componentIDs) == 0 {
+		return nil
+	}
+	components, err := is.itemRepository.GetItems(bson.M{"_id": bson.M{"$in": componentIDs}})
+	if err != nil {
+		return errors.ErrInternalServer
+	}
+	stock := make(map[primitive.ObjectID]int, len(components))
+	for _, v := range components {
+		stock[v.ID] = v.Quantity
+	}
+	for _, v := range items {
+		if v.IsBundle() {
+			v.Quantity = BundleAvailability(v.Components, stock)
+		}
 	}
 	return nil
 }
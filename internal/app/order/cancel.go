@@ -0,0 +1,144 @@
+package order
+
+import (
+	"context"
+	"time"
+
+	"github.com/ayo-ajayi/ecommerce/internal/app/item"
+	"github.com/ayo-ajayi/ecommerce/internal/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// cancellable are the statuses an order can be cancelled from. Shipped and delivered orders
+// have left the warehouse, so their stock cannot be released.
+var cancellable = []OrderStatus{OrderStatusPending, OrderStatusProcessing}
+
+// cancelOrder cancels the order and, in the same transaction, releases the stock it reserved and
+// returns licence keys that were assigned to it but never delivered. Keys that were delivered
+// have been seen by the customer and stay with the order.
+func (ors *OrderService) cancelOrder(orderID primitive.ObjectID) (*Order, *errors.AppError) {
+	order, err := ors.orderRepo.GetOrder(bson.M{"_id": orderID})
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			err := errors.ErrNotFound
+			return nil, errors.NewError("order not found: "+err.Error(), err.StatusCode)
+		}
+		return nil, errors.ErrInternalServer
+	}
+	if appErr := checkCancellable(order.OrderStatus); appErr != nil {
+		return nil, appErr
+	}
+	licenseKeyItems, appErr := ors.undeliveredLicenseKeyItems(order)
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	cancelled := false
+	err = ors.transactor.WithTransaction(func(ctx context.Context) error {
+		now := time.Now()
+		var err error
+		order, err = ors.orderRepo.FindOneAndUpdateOrderTx(ctx,
+			bson.M{"_id": orderID, "order_status": bson.M{"$in": cancellable}},
+			bson.M{"$set": bson.M{"order_status": OrderStatusCancelled, "updated_at": now}},
+		)
+		if err == mongo.ErrNoDocuments {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		cancelled = true
+		for _, line := range order.OrderItems {
+			for _, change := range reservedStock(line, licenseKeyItems) {
+				if err := ors.itemRepo.UpdateItemTx(ctx, bson.M{"_id": change.itemID}, bson.M{"$inc": bson.M{"quantity": change.quantity}}); err != nil {
+					return err
+				}
+			}
+			if line.Digital == nil && licenseKeyItems[line.ItemID] {
+				if err := ors.licenseKeyRepo.UpdateLicenseKeysTx(ctx,
+					bson.M{"item_id": line.ItemID, "order_id": order.ID},
+					bson.M{"$unset": bson.M{"order_id": "", "assigned_at": ""}},
+				); err != nil {
+					return err
+				}
+			}
+		}
+		order.OrderStatus, order.UpdatedAt = OrderStatusCancelled, now
+		return nil
+	})
+	if err != nil {
+		return nil, errors.ErrInternalServer
+	}
+	if !cancelled {
+		// the order moved on while it was being cancelled
+		current, err := ors.orderRepo.GetOrder(bson.M{"_id": orderID})
+		if err != nil {
+			return nil, errors.ErrInternalServer
+		}
+		if appErr := checkCancellable(current.OrderStatus); appErr != nil {
+			return nil, appErr
+		}
+		return nil, errors.ErrVersionConflict
+	}
+	return order, nil
+}
+
+func checkCancellable(status OrderStatus) *errors.AppError {
+	switch status {
+	case OrderStatusCancelled:
+		return errors.NewError("order is already cancelled", 409)
+	case OrderStatusShipped, OrderStatusDelivered:
+		return errors.NewError("order has already been "+string(status)+" and cannot be cancelled", 409)
+	}
+	return nil
+}
+
+// undeliveredLicenseKeyItems finds which undelivered digital lines of the order are licence key
+// items, whose stock was reserved when they were added to the cart
+func (ors *OrderService) undeliveredLicenseKeyItems(order *Order) (map[primitive.ObjectID]bool, *errors.AppError) {
+	var itemIDs []primitive.ObjectID
+	for _, line := range order.OrderItems {
+		if line.Type == item.Digital && line.Digital == nil {
+			itemIDs = append(itemIDs, line.ItemID)
+		}
+	}
+	licenseKeyItems := make(map[primitive.ObjectID]bool, len(itemIDs))
+	if len(itemIDs) == 0 {
+		return licenseKeyItems, nil
+	}
+	items, err := ors.itemRepo.GetItems(bson.M{"_id": bson.M{"$in": itemIDs}})
+	if err != nil {
+		return nil, errors.ErrInternalServer
+	}
+	for _, v := range items {
+		if v.IsDigital() && v.Digital.Delivery == item.LicenseKeyDelivery {
+			licenseKeyItems[v.ID] = true
+		}
+	}
+	return licenseKeyItems, nil
+}
+
+type stockChange struct {
+	itemID   primitive.ObjectID
+	quantity int
+}
+
+// reservedStock lists the stock an order line holds: the components shipped with a bundle, the
+// item itself for physical lines and undelivered licence keys, and nothing for downloads
+func reservedStock(line OrderItem, licenseKeyItems map[primitive.ObjectID]bool) []stockChange {
+	switch line.Type {
+	case item.Bundle:
+		changes := make([]stockChange, 0, len(line.Components))
+		for _, v := range line.Components {
+			changes = append(changes, stockChange{itemID: v.ItemID, quantity: v.Quantity})
+		}
+		return changes
+	case item.Digital:
+		if line.Digital != nil || !licenseKeyItems[line.ItemID] {
+			return nil
+		}
+	}
+	return []stockChange{{itemID: line.ItemID, quantity: line.Quantity}}
+}
@@ -1 +1,120 @@
 package order
+
+import (
+	"net/http"
+
+	"github.com/ayo-ajayi/ecommerce/internal/errors"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type OrderController struct {
+	orderServices OrderServices
+}
+
+type OrderServices interface {
+	Checkout(userid, addressid primitive.ObjectID) (*Order, *errors.AppError)
+	ConfirmPayment(orderId string) (*Order, *errors.AppError)
+	UpdateOrderStatus(orderId string, status OrderStatus) (*Order, *errors.AppError)
+	GetOrder(userid primitive.ObjectID, orderId string) (*Order, *errors.AppError)
+	GetOrders(userid primitive.ObjectID) ([]*Order, *errors.AppError)
+	GetAllOrders() ([]*Order, *errors.AppError)
+}
+
+func NewOrderController(orderServices OrderServices) *OrderController {
+	return &OrderController{
+		orderServices: orderServices,
+	}
+}
+
+func (oc *OrderController) Checkout(c *gin.Context) {
+	userid := c.MustGet("userId").(primitive.ObjectID)
+	if userid.IsZero() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": "invalid user"}})
+		return
+	}
+	req := struct {
+		AddressID string `json:"address_id"`
+	}{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	var addressid primitive.ObjectID
+	if req.AddressID != "" {
+		id, err := primitive.ObjectIDFromHex(req.AddressID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": "invalid address id"}})
+			return
+		}
+		addressid = id
+	}
+	order, err := oc.orderServices.Checkout(userid, addressid)
+	if err != nil {
+		c.JSON(err.StatusCode, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	c.JSON(201, gin.H{"message": "order placed successfully", "data": gin.H{"order": order}})
+}
+
+func (oc *OrderController) GetOrders(c *gin.Context) {
+	userid := c.MustGet("userId").(primitive.ObjectID)
+	if userid.IsZero() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": "invalid user"}})
+		return
+	}
+	orders, err := oc.orderServices.GetOrders(userid)
+	if err != nil {
+		c.JSON(err.StatusCode, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	c.JSON(200, gin.H{"data": gin.H{"orders": orders}})
+}
+
+func (oc *OrderController) GetOrder(c *gin.Context) {
+	userid := c.MustGet("userId").(primitive.ObjectID)
+	if userid.IsZero() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": "invalid user"}})
+		return
+	}
+	order, err := oc.orderServices.GetOrder(userid, c.Param("id"))
+	if err != nil {
+		c.JSON(err.StatusCode, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	c.JSON(200, gin.H{"data": gin.H{"order": order}})
+}
+
+func (oc *OrderController) GetAllOrders(c *gin.Context) {
+	orders, err := oc.orderServices.GetAllOrders()
+	if err != nil {
+		c.JSON(err.StatusCode, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	c.JSON(200, gin.H{"data": gin.H{"orders": orders}})
+}
+
+func (oc *OrderController) ConfirmPayment(c *gin.Context) {
+	order, err := oc.orderServices.ConfirmPayment(c.Param("id"))
+	if err != nil {
+		c.JSON(err.StatusCode, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	c.JSON(200, gin.H{"message": "payment confirmed successfully", "data": gin.H{"order": order}})
+}
+
+func (oc *OrderController) UpdateOrderStatus(c *gin.Context) {
+	req := struct {
+		Status OrderStatus `json:"status" binding:"required"`
+	}{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	order, err := oc.orderServices.UpdateOrderStatus(c.Param("id"), req.Status)
+	if err != nil {
+		c.JSON(err.StatusCode, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	c.JSON(200, gin.H{"message": "order status updated successfully", "data": gin.H{"order": order}})
+}
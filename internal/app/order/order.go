@@ -1,28 +1,55 @@
 package order
 
 import (
+	"time"
+
+	"github.com/ayo-ajayi/ecommerce/internal/app/item"
 	"github.com/ayo-ajayi/ecommerce/internal/types"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"time"
 )
 
 type Order struct {
 	ID              primitive.ObjectID `json:"id" bson:"_id"`
-	UserID          string             `json:"user_id" bson:"user_id"`
+	UserID          primitive.ObjectID `json:"user_id" bson:"user_id"`
 	OrderItems      []OrderItem        `json:"order_items" bson:"order_items"`
 	TotalPrice      float64            `json:"total_price" bson:"total_price"`
 	OrderDate       string             `json:"order_date" bson:"order_date"`
-	ShippingAddress types.Address      `json:"shipping_address" bson:"shipping_address"`
-	PaymentMethod   PaymentMethod      `json:"payment_method" bson:"payment_method"`
+	ShippingAddress *types.Address     `json:"shipping_address,omitempty" bson:"shipping_address,omitempty"`
+	PaymentMethod   *PaymentMethod     `json:"payment_method,omitempty" bson:"payment_method,omitempty"`
+	PaymentStatus   PaymentStatus      `json:"payment_status" bson:"payment_status"`
 	OrderStatus     OrderStatus        `json:"order_status" bson:"order_status"`
 	CreatedAt       time.Time          `json:"created_at" bson:"created_at"`
 	UpdatedAt       time.Time          `json:"updated_at" bson:"updated_at"`
 }
 
 type OrderItem struct {
-	ItemID   string  `json:"item_id" bson:"item_id"`
-	Quantity int     `json:"quantity" bson:"quantity"`
-	Price    float64 `json:"price" bson:"price"`
+	ItemID     primitive.ObjectID   `json:"item_id" bson:"item_id"`
+	Name       string               `json:"name" bson:"name"`
+	Type       item.ItemType        `json:"type" bson:"type"`
+	VendorID   primitive.ObjectID   `json:"vendor_id" bson:"vendor_id"`
+	Quantity   int                  `json:"quantity" bson:"quantity"`
+	Price      float64              `json:"price" bson:"price"`
+	Digital    *DigitalDelivery     `json:"digital,omitempty" bson:"digital,omitempty"`
+	Components []OrderItemComponent `json:"components,omitempty" bson:"components,omitempty"`
+}
+
+// OrderItemComponent is a component shipped as part of a bundle order line.
+// Quantity is the total across all the bundles on the line.
+type OrderItemComponent struct {
+	ItemID   primitive.ObjectID `json:"item_id" bson:"item_id"`
+	Name     string             `json:"name" bson:"name"`
+	Quantity int                `json:"quantity" bson:"quantity"`
+}
+
+// DigitalDelivery records what was delivered for a digital order line
+type DigitalDelivery struct {
+	Method       item.DeliveryMethod `json:"method" bson:"method"`
+	LicenseKeys  []string            `json:"license_keys,omitempty" bson:"license_keys,omitempty"`
+	FileID       string              `json:"-" bson:"file_id,omitempty"`
+	FileURL      string              `json:"-" bson:"file_url,omitempty"`
+	Downloads    int                 `json:"downloads" bson:"downloads"`
+	MaxDownloads int                 `json:"max_downloads,omitempty" bson:"max_downloads,omitempty"`
+	DeliveredAt  time.Time           `json:"delivered_at" bson:"delivered_at"`
 }
 
 type PaymentMethod struct {
@@ -51,3 +78,12 @@ const (
 	OrderStatusDelivered  OrderStatus = "delivered"
 	OrderStatusCancelled  OrderStatus = "cancelled"
 )
+
+func (o *Order) RequiresShipping() bool {
+	for _, v := range o.OrderItems {
+		if v.Type != item.Digital {
+			return true
+		}
+	}
+	return false
+}
@@ -1 +1,112 @@
 package order
+
+import (
+	"context"
+
+	"github.com/ayo-ajayi/ecommerce/internal/database"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type OrderRepo struct {
+	Collection *mongo.Collection
+}
+
+func NewOrderRepo(collection *mongo.Collection) *OrderRepo {
+	return &OrderRepo{
+		Collection: collection,
+	}
+}
+
+func (or *OrderRepo) IsExists(filter interface{}, opts ...*options.FindOneOptions) (bool, error) {
+	ctx, cancel := database.DBReqContext(5)
+	defer cancel()
+	err := or.Collection.FindOne(ctx, filter, opts...).Err()
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func (or *OrderRepo) CreateOrder(order *Order) error {
+	ctx, cancel := database.DBReqContext(5)
+	defer cancel()
+	_, err := or.Collection.InsertOne(ctx, order)
+	return err
+}
+
+// CreateOrderTx is CreateOrder as part of the transaction ctx belongs to
+func (or *OrderRepo) CreateOrderTx(ctx context.Context, order *Order) error {
+	_, err := or.Collection.InsertOne(ctx, order)
+	return err
+}
+
+func (or *OrderRepo) UpdateOrder(filter interface{}, update interface{}, opts ...*options.UpdateOptions) error {
+	ctx, cancel := database.DBReqContext(5)
+	defer cancel()
+	_, err := or.Collection.UpdateOne(ctx, filter, update, opts...)
+	return err
+}
+
+// FindOneAndUpdateOrder applies update to the first matching order and returns it.
+// It returns mongo.ErrNoDocuments when nothing matched, which makes it usable for guarded updates.
+func (or *OrderRepo) FindOneAndUpdateOrder(filter interface{}, update interface{}, opts ...*options.FindOneAndUpdateOptions) (*Order, error) {
+	ctx, cancel := database.DBReqContext(5)
+	defer cancel()
+	var order Order
+	err := or.Collection.FindOneAndUpdate(ctx, filter, update, opts...).Decode(&order)
+	if err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
+// FindOneAndUpdateOrderTx is part of the transaction ctx belongs to. It returns the order as it
+// was before the update.
+func (or *OrderRepo) FindOneAndUpdateOrderTx(ctx context.Context, filter interface{}, update interface{}) (*Order, error) {
+	var order Order
+	err := or.Collection.FindOneAndUpdate(ctx, filter, update).Decode(&order)
+	if err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
+func (or *OrderRepo) GetOrder(filter interface{}, opts ...*options.FindOneOptions) (*Order, error) {
+	ctx, cancel := database.DBReqContext(5)
+	defer cancel()
+	var order Order
+	err := or.Collection.FindOne(ctx, filter, opts...).Decode(&order)
+	if err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
+func (or *OrderRepo) GetOrders(filter interface{}, opts ...*options.FindOptions) ([]*Order, error) {
+	ctx, cancel := database.DBReqContext(5)
+	defer cancel()
+	var orders []*Order
+	cursor, err := or.Collection.Find(ctx, filter, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if err := cursor.All(ctx, &orders); err != nil {
+		return nil, err
+	}
+	return orders, nil
+}
+
+// Aggregate runs a pipeline over every order, so it may spill to disk and gets longer to finish
+func (or *OrderRepo) Aggregate(pipeline interface{}, result interface{}) error {
+	ctx, cancel := database.DBReqContext(60)
+	defer cancel()
+	cursor, err := or.Collection.Aggregate(ctx, pipeline, options.Aggregate().SetAllowDiskUse(true))
+	if err != nil {
+		return err
+	}
+	return cursor.All(ctx, result)
+}
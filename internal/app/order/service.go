@@ -1 +1,336 @@
 package order
+
+import (
+	"context"
+	"time"
+
+	"github.com/ayo-ajayi/ecommerce/internal/app/cart"
+	"github.com/ayo-ajayi/ecommerce/internal/app/item"
+	"github.com/ayo-ajayi/ecommerce/internal/app/user"
+	"github.com/ayo-ajayi/ecommerce/internal/errors"
+	"github.com/ayo-ajayi/ecommerce/internal/types"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type OrderService struct {
+	orderRepo      OrderRepository
+	cartRepo       CartRepository
+	itemRepo       ItemRepository
+	userRepo       UserRepository
+	priceResolver  PriceResolver
+	deliverer      Deliverer
+	licenseKeyRepo LicenseKeyRepository
+	transactor     Transactor
+}
+
+type OrderRepository interface {
+	CreateOrderTx(ctx context.Context, order *Order) error
+	FindOneAndUpdateOrder(filter interface{}, update interface{}, opts ...*options.FindOneAndUpdateOptions) (*Order, error)
+	FindOneAndUpdateOrderTx(ctx context.Context, filter interface{}, update interface{}) (*Order, error)
+	GetOrder(filter interface{}, opts ...*options.FindOneOptions) (*Order, error)
+	GetOrders(filter interface{}, opts ...*options.FindOptions) ([]*Order, error)
+	IsExists(filter interface{}, opts ...*options.FindOneOptions) (bool, error)
+}
+
+type CartRepository interface {
+	GetCart(filter interface{}, opts ...*options.FindOneOptions) (*cart.Cart, error)
+	DeleteCartTx(ctx context.Context, filter interface{}) error
+}
+
+type ItemRepository interface {
+	GetItems(filter interface{}, opts ...*options.FindOptions) ([]*item.Item, error)
+	UpdateItemTx(ctx context.Context, filter interface{}, update interface{}) error
+}
+
+// LicenseKeyRepository returns licence keys of cancelled orders to their pool
+type LicenseKeyRepository interface {
+	UpdateLicenseKeysTx(ctx context.Context, filter interface{}, update interface{}) error
+}
+
+// Transactor runs fn in a database transaction
+type Transactor interface {
+	WithTransaction(fn func(ctx context.Context) error) error
+}
+
+type UserRepository interface {
+	GetUser(filter interface{}) (*user.User, error)
+}
+
+type PriceResolver interface {
+	ResolvePrices(items ...*item.Item) *errors.AppError
+}
+
+// Deliverer hands over the digital lines of a paid order
+type Deliverer interface {
+	Deliver(order *Order) *errors.AppError
+}
+
+func NewOrderService(orderRepo OrderRepository, cartRepo CartRepository, itemRepo ItemRepository, userRepo UserRepository, priceResolver PriceResolver, deliverer Deliverer, licenseKeyRepo LicenseKeyRepository, transactor Transactor) *OrderService {
+	return &OrderService{
+		orderRepo:      orderRepo,
+		cartRepo:       cartRepo,
+		itemRepo:       itemRepo,
+		userRepo:       userRepo,
+		priceResolver:  priceResolver,
+		deliverer:      deliverer,
+		licenseKeyRepo: licenseKeyRepo,
+		transactor:     transactor,
+	}
+}
+
+// Checkout turns the user's cart into a pending order. Stock was already reserved when
+// the items were added to the cart. A shipping address is only needed for physical items.
+func (ors *OrderService) Checkout(userid, addressid primitive.ObjectID) (*Order, *errors.AppError) {
+	ct, err := ors.cartRepo.GetCart(bson.M{"user_id": userid})
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, errors.NewError("cart is empty", 400)
+		}
+		return nil, errors.ErrInternalServer
+	}
+	if len(ct.CartItems) == 0 {
+		return nil, errors.NewError("cart is empty", 400)
+	}
+	itemIDs := make([]primitive.ObjectID, 0, len(ct.CartItems))
+	for _, v := range ct.CartItems {
+		itemIDs = append(itemIDs, v.ItemID)
+	}
+	items, err := ors.itemRepo.GetItems(bson.M{"_id": bson.M{"$in": itemIDs}})
+	if err != nil {
+		return nil, errors.ErrInternalServer
+	}
+	if err := ors.priceResolver.ResolvePrices(items...); err != nil {
+		return nil, err
+	}
+	itemsByID := make(map[primitive.ObjectID]*item.Item, len(items))
+	var componentIDs []primitive.ObjectID
+	for _, v := range items {
+		itemsByID[v.ID] = v
+		for _, c := range v.Components {
+			componentIDs = append(componentIDs, c.ItemID)
+		}
+	}
+	for _, v := range ct.CartItems {
+		for _, c := range v.Reserved {
+			componentIDs = append(componentIDs, c.ItemID)
+		}
+	}
+	componentNames := make(map[primitive.ObjectID]string, len(componentIDs))
+	if len(componentIDs) > 0 {
+		components, err := ors.itemRepo.GetItems(bson.M{"_id": bson.M{"$in": componentIDs}})
+		if err != nil {
+			return nil, errors.ErrInternalServer
+		}
+		for _, v := range components {
+			componentNames[v.ID] = v.Name
+		}
+	}
+
+	now := time.Now()
+	order := &Order{
+		ID:            primitive.NewObjectID(),
+		UserID:        userid,
+		OrderDate:     now.Format(time.RFC3339),
+		PaymentStatus: PaymentStatusPending,
+		OrderStatus:   OrderStatusPending,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+	for _, v := range ct.CartItems {
+		it, ok := itemsByID[v.ItemID]
+		if !ok || !it.IsPublished() {
+			return nil, errors.NewError("item is no longer available: "+v.ItemID.Hex(), 400)
+		}
+		itemType := it.Type
+		if itemType == "" {
+			itemType = item.Physical
+		}
+		order.OrderItems = append(order.OrderItems, OrderItem{
+			ItemID:     it.ID,
+			Name:       it.Name,
+			Type:       itemType,
+			VendorID:   it.VendorID,
+			Quantity:   v.Quantity,
+			Price:      it.EffectivePrice,
+			Components: bundleComponents(it, v, componentNames),
+		})
+		order.TotalPrice += it.EffectivePrice * float64(v.Quantity)
+	}
+
+	if order.RequiresShipping() {
+		if addressid.IsZero() {
+			return nil, errors.NewError("a shipping address is required for physical items", 400)
+		}
+		address, appErr := ors.getAddress(userid, addressid)
+		if appErr != nil {
+			return nil, appErr
+		}
+		order.ShippingAddress = address
+	}
+
+	// the cart is cleared in the same transaction, so an order is never placed with its cart left behind
+	err = ors.transactor.WithTransaction(func(ctx context.Context) error {
+		if err := ors.orderRepo.CreateOrderTx(ctx, order); err != nil {
+			return err
+		}
+		return ors.cartRepo.DeleteCartTx(ctx, bson.M{"_id": ct.ID})
+	})
+	if err != nil {
+		return nil, errors.NewError("internal error: "+err.Error(), 500)
+	}
+	return order, nil
+}
+
+func (ors *OrderService) getAddress(userid, addressid primitive.ObjectID) (*types.Address, *errors.AppError) {
+	u, err := ors.userRepo.GetUser(bson.M{"_id": userid})
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			err := errors.ErrNotFound
+			return nil, errors.NewError("user not found: "+err.Error(), err.StatusCode)
+		}
+		return nil, errors.ErrInternalServer
+	}
+	for _, v := range u.Addresses {
+		if v.ID == addressid {
+			return &v, nil
+		}
+	}
+	return nil, errors.NewError("address not found", 404)
+}
+
+// ConfirmPayment marks an order as paid and delivers its digital lines. It is safe to call
+// again on a paid order, in which case only lines that were not yet delivered are retried.
+func (ors *OrderService) ConfirmPayment(orderId string) (*Order, *errors.AppError) {
+	orderID, err := primitive.ObjectIDFromHex(orderId)
+	if err != nil {
+		return nil, errors.ErrInvalidObjectID
+	}
+	order, err := ors.orderRepo.GetOrder(bson.M{"_id": orderID})
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			err := errors.ErrNotFound
+			return nil, errors.NewError("order not found: "+err.Error(), err.StatusCode)
+		}
+		return nil, errors.ErrInternalServer
+	}
+	if order.OrderStatus == OrderStatusCancelled {
+		return nil, errors.NewError("order is cancelled", 409)
+	}
+	if order.PaymentStatus != PaymentStatusPaid {
+		// an order cancelled since it was read must not be paid for or delivered
+		order, err = ors.orderRepo.FindOneAndUpdateOrder(bson.M{"_id": order.ID, "order_status": bson.M{"$ne": OrderStatusCancelled}}, bson.M{"$set": bson.M{
+			"payment_status": PaymentStatusPaid,
+			"order_status":   OrderStatusProcessing,
+			"updated_at":     time.Now(),
+		}}, options.FindOneAndUpdate().SetReturnDocument(options.After))
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				return nil, errors.NewError("order is cancelled", 409)
+			}
+			return nil, errors.NewError("internal error: "+err.Error(), 500)
+		}
+	}
+	if err := ors.deliverer.Deliver(order); err != nil {
+		return nil, errors.NewError("payment confirmed but delivery failed: "+err.Error(), err.StatusCode)
+	}
+	if !order.RequiresShipping() && order.OrderStatus != OrderStatusDelivered {
+		return ors.setOrderStatus(order.ID, OrderStatusDelivered)
+	}
+	return order, nil
+}
+
+// UpdateOrderStatus moves an order to status. Cancelling an order releases what it reserved, and
+// cancelled orders cannot be moved out of cancelled.
+func (ors *OrderService) UpdateOrderStatus(orderId string, status OrderStatus) (*Order, *errors.AppError) {
+	orderID, err := primitive.ObjectIDFromHex(orderId)
+	if err != nil {
+		return nil, errors.ErrInvalidObjectID
+	}
+	switch status {
+	case OrderStatusPending, OrderStatusProcessing, OrderStatusShipped, OrderStatusDelivered:
+	case OrderStatusCancelled:
+		return ors.cancelOrder(orderID)
+	default:
+		return nil, errors.NewError("invalid order status", 400)
+	}
+	return ors.setOrderStatus(orderID, status)
+}
+
+func (ors *OrderService) setOrderStatus(orderID primitive.ObjectID, status OrderStatus) (*Order, *errors.AppError) {
+	order, err := ors.orderRepo.FindOneAndUpdateOrder(bson.M{"_id": orderID, "order_status": bson.M{"$ne": OrderStatusCancelled}}, bson.M{"$set": bson.M{
+		"order_status": status,
+		"updated_at":   time.Now(),
+	}}, options.FindOneAndUpdate().SetReturnDocument(options.After))
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			if exists, err := ors.orderRepo.IsExists(bson.M{"_id": orderID}); err != nil {
+				return nil, errors.ErrInternalServer
+			} else if exists {
+				return nil, errors.NewError("order is cancelled", 409)
+			}
+			err := errors.ErrNotFound
+			return nil, errors.NewError("order not found: "+err.Error(), err.StatusCode)
+		}
+		return nil, errors.ErrInternalServer
+	}
+	return order, nil
+}
+
+func (ors *OrderService) GetOrder(userid primitive.ObjectID, orderId string) (*Order, *errors.AppError) {
+	orderID, err := primitive.ObjectIDFromHex(orderId)
+	if err != nil {
+		return nil, errors.ErrInvalidObjectID
+	}
+	order, err := ors.orderRepo.GetOrder(bson.M{"_id": orderID, "user_id": userid})
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			err := errors.ErrNotFound
+			return nil, errors.NewError("order not found: "+err.Error(), err.StatusCode)
+		}
+		return nil, errors.ErrInternalServer
+	}
+	return order, nil
+}
+
+func (ors *OrderService) GetOrders(userid primitive.ObjectID) ([]*Order, *errors.AppError) {
+	orders, err := ors.orderRepo.GetOrders(bson.M{"user_id": userid}, options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}))
+	if err != nil {
+		return nil, errors.ErrInternalServer
+	}
+	return orders, nil
+}
+
+func (ors *OrderService) GetAllOrders() ([]*Order, *errors.AppError) {
+	orders, err := ors.orderRepo.GetOrders(bson.M{}, options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}))
+	if err != nil {
+		return nil, errors.ErrInternalServer
+	}
+	return orders, nil
+}
+
+// bundleComponents lists what a bundle line is made of so the order shows each component. They are
+// the components reserved when the bundle was added to the cart, which the bundle may have changed since.
+func bundleComponents(it *item.Item, line cart.CartItem, names map[primitive.ObjectID]string) []OrderItemComponent {
+	if !it.IsBundle() {
+		return nil
+	}
+	reserved := line.Reserved
+	if reserved == nil {
+		reserved = make([]item.BundleComponent, 0, len(it.Components))
+		for _, v := range it.Components {
+			reserved = append(reserved, item.BundleComponent{ItemID: v.ItemID, Quantity: v.Quantity * line.Quantity})
+		}
+	}
+	components := make([]OrderItemComponent, 0, len(reserved))
+	for _, v := range reserved {
+		components = append(components, OrderItemComponent{
+			ItemID:   v.ItemID,
+			Name:     names[v.ItemID],
+			Quantity: v.Quantity,
+		})
+	}
+	return components
+}
@@ -0,0 +1,166 @@
+package question
+
+import (
+	"net/http"
+
+	"github.com/ayo-ajayi/ecommerce/internal/errors"
+	"github.com/ayo-ajayi/ecommerce/internal/types"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type QuestionController struct {
+	questionServices QuestionServices
+}
+
+type QuestionServices interface {
+	AskQuestion(question *Question) *errors.AppError
+	AnswerQuestion(answer *Answer) *errors.AppError
+	UpvoteAnswer(answerId string, userId primitive.ObjectID) *errors.AppError
+	GetQuestions(itemId string, pagination *types.Pagination) ([]*Question, *errors.AppError)
+	GetAnswers(questionId string, pagination *types.Pagination) ([]*Answer, *errors.AppError)
+	GetAllQuestions(status Status, pagination *types.Pagination) ([]*Question, *errors.AppError)
+	ModerateQuestion(questionId string, status Status, adminId primitive.ObjectID) *errors.AppError
+	ModerateAnswer(answerId string, status Status, adminId primitive.ObjectID) *errors.AppError
+}
+
+func NewQuestionController(questionServices QuestionServices) *QuestionController {
+	return &QuestionController{
+		questionServices: questionServices,
+	}
+}
+
+func (qc *QuestionController) AskQuestion(c *gin.Context) {
+	userid := c.MustGet("userId").(primitive.ObjectID)
+	if userid.IsZero() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": "invalid user"}})
+		return
+	}
+	itemID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": "invalid item id"}})
+		return
+	}
+	req := struct {
+		Content string `json:"content" binding:"required"`
+	}{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	question := &Question{ItemID: itemID, AuthorID: userid, Content: req.Content}
+	if err := qc.questionServices.AskQuestion(question); err != nil {
+		c.JSON(err.StatusCode, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	c.JSON(201, gin.H{"message": "question posted successfully", "data": gin.H{"question": question}})
+}
+
+func (qc *QuestionController) AnswerQuestion(c *gin.Context) {
+	userid := c.MustGet("userId").(primitive.ObjectID)
+	if userid.IsZero() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": "invalid user"}})
+		return
+	}
+	questionID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": "invalid question id"}})
+		return
+	}
+	req := struct {
+		Content string `json:"content" binding:"required"`
+	}{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	answer := &Answer{QuestionID: questionID, AuthorID: userid, Content: req.Content}
+	if err := qc.questionServices.AnswerQuestion(answer); err != nil {
+		c.JSON(err.StatusCode, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	c.JSON(201, gin.H{"message": "answer posted successfully", "data": gin.H{"answer": answer}})
+}
+
+func (qc *QuestionController) UpvoteAnswer(c *gin.Context) {
+	userid := c.MustGet("userId").(primitive.ObjectID)
+	if userid.IsZero() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": "invalid user"}})
+		return
+	}
+	if err := qc.questionServices.UpvoteAnswer(c.Param("id"), userid); err != nil {
+		c.JSON(err.StatusCode, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	c.JSON(200, gin.H{"message": "answer upvoted successfully"})
+}
+
+func (qc *QuestionController) GetQuestions(c *gin.Context) {
+	pagination, err := types.NewPagination(c.Query("page"), c.Query("limit"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	questions, appErr := qc.questionServices.GetQuestions(c.Param("id"), pagination)
+	if appErr != nil {
+		c.JSON(appErr.StatusCode, gin.H{"error": gin.H{"message": appErr.Error()}})
+		return
+	}
+	c.JSON(200, gin.H{"data": gin.H{"questions": questions, "pagination": pagination}})
+}
+
+func (qc *QuestionController) GetAnswers(c *gin.Context) {
+	pagination, err := types.NewPagination(c.Query("page"), c.Query("limit"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	answers, appErr := qc.questionServices.GetAnswers(c.Param("id"), pagination)
+	if appErr != nil {
+		c.JSON(appErr.StatusCode, gin.H{"error": gin.H{"message": appErr.Error()}})
+		return
+	}
+	c.JSON(200, gin.H{"data": gin.H{"answers": answers, "pagination": pagination}})
+}
+
+func (qc *QuestionController) GetAllQuestions(c *gin.Context) {
+	pagination, err := types.NewPagination(c.Query("page"), c.Query("limit"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	questions, appErr := qc.questionServices.GetAllQuestions(Status(c.Query("status")), pagination)
+	if appErr != nil {
+		c.JSON(appErr.StatusCode, gin.H{"error": gin.H{"message": appErr.Error()}})
+		return
+	}
+	c.JSON(200, gin.H{"data": gin.H{"questions": questions, "pagination": pagination}})
+}
+
+func (qc *QuestionController) ModerateQuestion(c *gin.Context) {
+	qc.moderate(c, qc.questionServices.ModerateQuestion, "question")
+}
+
+func (qc *QuestionController) ModerateAnswer(c *gin.Context) {
+	qc.moderate(c, qc.questionServices.ModerateAnswer, "answer")
+}
+
+func (qc *QuestionController) moderate(c *gin.Context, moderate func(id string, status Status, adminId primitive.ObjectID) *errors.AppError, name string) {
+	userid := c.MustGet("userId").(primitive.ObjectID)
+	if userid.IsZero() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": "invalid user"}})
+		return
+	}
+	req := struct {
+		Status Status `json:"status" binding:"required"`
+	}{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	if err := moderate(c.Param("id"), req.Status, userid); err != nil {
+		c.JSON(err.StatusCode, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	c.JSON(200, gin.H{"message": name + " moderated successfully"})
+}
@@ -0,0 +1,59 @@
+package question
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type Question struct {
+	ID          primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	ItemID      primitive.ObjectID `json:"item_id" bson:"item_id"`
+	AuthorID    primitive.ObjectID `json:"author_id" bson:"author_id"`
+	AuthorName  string             `json:"author_name" bson:"author_name"`
+	Content     string             `json:"content" bson:"content"`
+	Status      Status             `json:"status" bson:"status"`
+	AnswerCount int                `json:"answer_count" bson:"answer_count"`
+	Answers     []*Answer          `json:"answers,omitempty" bson:"-"`
+	ModeratedBy primitive.ObjectID `json:"-" bson:"moderated_by,omitempty"`
+	CreatedAt   time.Time          `json:"created_at" bson:"created_at"`
+	UpdatedAt   time.Time          `json:"updated_at" bson:"updated_at"`
+}
+
+type Answer struct {
+	ID          primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	QuestionID  primitive.ObjectID `json:"question_id" bson:"question_id"`
+	ItemID      primitive.ObjectID `json:"item_id" bson:"item_id"`
+	AuthorID    primitive.ObjectID `json:"author_id" bson:"author_id"`
+	AuthorName  string             `json:"author_name" bson:"author_name"`
+	AuthorRole  AuthorRole         `json:"author_role" bson:"author_role"`
+	Content     string             `json:"content" bson:"content"`
+	Status      Status             `json:"status" bson:"status"`
+	Upvotes     int                `json:"upvotes" bson:"upvotes"`
+	ModeratedBy primitive.ObjectID `json:"-" bson:"moderated_by,omitempty"`
+	CreatedAt   time.Time          `json:"created_at" bson:"created_at"`
+	UpdatedAt   time.Time          `json:"updated_at" bson:"updated_at"`
+}
+
+type AnswerVote struct {
+	ID        primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	AnswerID  primitive.ObjectID `json:"answer_id" bson:"answer_id"`
+	UserID    primitive.ObjectID `json:"user_id" bson:"user_id"`
+	CreatedAt time.Time          `json:"created_at" bson:"created_at"`
+}
+
+// Status is set by admins moderating questions and answers. Only visible ones are listed publicly.
+type Status string
+
+const (
+	Visible Status = "visible"
+	Hidden  Status = "hidden"
+)
+
+// AuthorRole tells readers why an answerer can be trusted
+type AuthorRole string
+
+const (
+	VendorAnswer AuthorRole = "vendor"
+	BuyerAnswer  AuthorRole = "buyer"
+)
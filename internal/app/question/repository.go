@@ -0,0 +1,206 @@
+package question
+
+import (
+	"context"
+	"errors"
+
+	"github.com/ayo-ajayi/ecommerce/internal/database"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type QuestionRepo struct {
+	Collection *mongo.Collection
+}
+
+func NewQuestionRepo(collection *mongo.Collection) *QuestionRepo {
+	return &QuestionRepo{
+		Collection: collection,
+	}
+}
+
+func (qr *QuestionRepo) CreateQuestion(question *Question) error {
+	ctx, cancel := database.DBReqContext(5)
+	defer cancel()
+	res, err := qr.Collection.InsertOne(ctx, question)
+	if err != nil {
+		return err
+	}
+	question.ID = res.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+// UpdateQuestion returns whether a question matched the filter
+func (qr *QuestionRepo) UpdateQuestion(filter interface{}, update interface{}, opts ...*options.UpdateOptions) (bool, error) {
+	ctx, cancel := database.DBReqContext(5)
+	defer cancel()
+	res, err := qr.Collection.UpdateOne(ctx, filter, update, opts...)
+	if err != nil {
+		return false, err
+	}
+	return res.MatchedCount > 0, nil
+}
+
+func (qr *QuestionRepo) GetQuestion(filter interface{}, opts ...*options.FindOneOptions) (*Question, error) {
+	ctx, cancel := database.DBReqContext(5)
+	defer cancel()
+	var question Question
+	err := qr.Collection.FindOne(ctx, filter, opts...).Decode(&question)
+	if err != nil {
+		return nil, err
+	}
+	return &question, nil
+}
+
+func (qr *QuestionRepo) GetQuestions(filter interface{}, opts ...*options.FindOptions) ([]*Question, error) {
+	ctx, cancel := database.DBReqContext(5)
+	defer cancel()
+	questions := []*Question{}
+	cursor, err := qr.Collection.Find(ctx, filter, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if err := cursor.All(ctx, &questions); err != nil {
+		return nil, err
+	}
+	return questions, nil
+}
+
+func (qr *QuestionRepo) CountQuestions(filter interface{}) (int64, error) {
+	ctx, cancel := database.DBReqContext(5)
+	defer cancel()
+	return qr.Collection.CountDocuments(ctx, filter)
+}
+
+// The methods below are part of the transaction ctx belongs to
+
+// UpdateQuestionTx reports whether a question matched the filter
+func (qr *QuestionRepo) UpdateQuestionTx(ctx context.Context, filter interface{}, update interface{}) (bool, error) {
+	res, err := qr.Collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, err
+	}
+	return res.MatchedCount > 0, nil
+}
+
+type AnswerRepo struct {
+	Collection *mongo.Collection
+}
+
+func NewAnswerRepo(collection *mongo.Collection) *AnswerRepo {
+	return &AnswerRepo{
+		Collection: collection,
+	}
+}
+
+func (ar *AnswerRepo) CreateAnswer(answer *Answer) error {
+	ctx, cancel := database.DBReqContext(5)
+	defer cancel()
+	res, err := ar.Collection.InsertOne(ctx, answer)
+	if err != nil {
+		return err
+	}
+	answer.ID = res.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+// UpdateAnswer returns whether an answer matched the filter
+func (ar *AnswerRepo) UpdateAnswer(filter interface{}, update interface{}, opts ...*options.UpdateOptions) (bool, error) {
+	ctx, cancel := database.DBReqContext(5)
+	defer cancel()
+	res, err := ar.Collection.UpdateOne(ctx, filter, update, opts...)
+	if err != nil {
+		return false, err
+	}
+	return res.MatchedCount > 0, nil
+}
+
+func (ar *AnswerRepo) GetAnswer(filter interface{}, opts ...*options.FindOneOptions) (*Answer, error) {
+	ctx, cancel := database.DBReqContext(5)
+	defer cancel()
+	var answer Answer
+	err := ar.Collection.FindOne(ctx, filter, opts...).Decode(&answer)
+	if err != nil {
+		return nil, err
+	}
+	return &answer, nil
+}
+
+func (ar *AnswerRepo) GetAnswers(filter interface{}, opts ...*options.FindOptions) ([]*Answer, error) {
+	ctx, cancel := database.DBReqContext(5)
+	defer cancel()
+	answers := []*Answer{}
+	cursor, err := ar.Collection.Find(ctx, filter, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if err := cursor.All(ctx, &answers); err != nil {
+		return nil, err
+	}
+	return answers, nil
+}
+
+func (ar *AnswerRepo) CountAnswers(filter interface{}) (int64, error) {
+	ctx, cancel := database.DBReqContext(5)
+	defer cancel()
+	return ar.Collection.CountDocuments(ctx, filter)
+}
+
+// The methods below are part of the transaction ctx belongs to
+
+func (ar *AnswerRepo) CreateAnswerTx(ctx context.Context, answer *Answer) error {
+	res, err := ar.Collection.InsertOne(ctx, answer)
+	if err != nil {
+		return err
+	}
+	answer.ID = res.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+// UpdateAnswerTx reports whether an answer matched the filter
+func (ar *AnswerRepo) UpdateAnswerTx(ctx context.Context, filter interface{}, update interface{}) (bool, error) {
+	res, err := ar.Collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, err
+	}
+	return res.MatchedCount > 0, nil
+}
+
+type AnswerVoteRepo struct {
+	Collection *mongo.Collection
+}
+
+func NewAnswerVoteRepo(collection *mongo.Collection) *AnswerVoteRepo {
+	return &AnswerVoteRepo{
+		Collection: collection,
+	}
+}
+
+// InitAnswerVoteIndex makes sure a user can upvote an answer only once
+func InitAnswerVoteIndex(collection *mongo.Collection) error {
+	ctx, cancel := database.DBReqContext(5)
+	defer cancel()
+	_, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "answer_id", Value: 1}, {Key: "user_id", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return errors.New("Error creating unique index for answer vote collection:" + err.Error())
+	}
+	return nil
+}
+
+func (vr *AnswerVoteRepo) CreateAnswerVote(vote *AnswerVote) error {
+	ctx, cancel := database.DBReqContext(5)
+	defer cancel()
+	_, err := vr.Collection.InsertOne(ctx, vote)
+	return err
+}
+
+// CreateAnswerVoteTx is CreateAnswerVote as part of the transaction ctx belongs to
+func (vr *AnswerVoteRepo) CreateAnswerVoteTx(ctx context.Context, vote *AnswerVote) error {
+	_, err := vr.Collection.InsertOne(ctx, vote)
+	return err
+}
@@ -0,0 +1,372 @@
+package question
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ayo-ajayi/ecommerce/internal/app/item"
+	"github.com/ayo-ajayi/ecommerce/internal/app/order"
+	"github.com/ayo-ajayi/ecommerce/internal/app/user"
+	"github.com/ayo-ajayi/ecommerce/internal/constants"
+	"github.com/ayo-ajayi/ecommerce/internal/errors"
+	"github.com/ayo-ajayi/ecommerce/internal/types"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type QuestionService struct {
+	questionRepo   QuestionRepository
+	answerRepo     AnswerRepository
+	answerVoteRepo AnswerVoteRepository
+	itemRepo       ItemRepository
+	orderRepo      OrderRepository
+	userRepo       UserRepository
+	transactor     Transactor
+}
+
+type QuestionRepository interface {
+	CreateQuestion(question *Question) error
+	UpdateQuestion(filter interface{}, update interface{}, opts ...*options.UpdateOptions) (bool, error)
+	GetQuestion(filter interface{}, opts ...*options.FindOneOptions) (*Question, error)
+	GetQuestions(filter interface{}, opts ...*options.FindOptions) ([]*Question, error)
+	CountQuestions(filter interface{}) (int64, error)
+	UpdateQuestionTx(ctx context.Context, filter interface{}, update interface{}) (bool, error)
+}
+
+type AnswerRepository interface {
+	GetAnswer(filter interface{}, opts ...*options.FindOneOptions) (*Answer, error)
+	GetAnswers(filter interface{}, opts ...*options.FindOptions) ([]*Answer, error)
+	CountAnswers(filter interface{}) (int64, error)
+	CreateAnswerTx(ctx context.Context, answer *Answer) error
+	UpdateAnswerTx(ctx context.Context, filter interface{}, update interface{}) (bool, error)
+}
+
+type AnswerVoteRepository interface {
+	CreateAnswerVoteTx(ctx context.Context, vote *AnswerVote) error
+}
+
+type ItemRepository interface {
+	GetItem(filter interface{}, opts ...*options.FindOneOptions) (*item.Item, error)
+}
+
+type OrderRepository interface {
+	IsExists(filter interface{}, opts ...*options.FindOneOptions) (bool, error)
+}
+
+type UserRepository interface {
+	GetUser(filter interface{}) (*user.User, error)
+}
+
+type Transactor interface {
+	WithTransaction(fn func(ctx context.Context) error) error
+}
+
+func NewQuestionService(questionRepo QuestionRepository, answerRepo AnswerRepository, answerVoteRepo AnswerVoteRepository, itemRepo ItemRepository, orderRepo OrderRepository, userRepo UserRepository, transactor Transactor) *QuestionService {
+	return &QuestionService{
+		questionRepo:   questionRepo,
+		answerRepo:     answerRepo,
+		answerVoteRepo: answerVoteRepo,
+		itemRepo:       itemRepo,
+		orderRepo:      orderRepo,
+		userRepo:       userRepo,
+		transactor:     transactor,
+	}
+}
+
+func (qs *QuestionService) AskQuestion(question *Question) *errors.AppError {
+	content, appErr := validateContent(question.Content)
+	if appErr != nil {
+		return appErr
+	}
+	if _, appErr := qs.getItem(question.ItemID); appErr != nil {
+		return appErr
+	}
+	authorName, appErr := qs.getAuthorName(question.AuthorID)
+	if appErr != nil {
+		return appErr
+	}
+	question.Content = content
+	question.AuthorName = authorName
+	question.Status = Visible
+	question.AnswerCount = 0
+	question.CreatedAt = time.Now()
+	question.UpdatedAt = question.CreatedAt
+	if err := qs.questionRepo.CreateQuestion(question); err != nil {
+		return errors.ErrInternalServer
+	}
+	return nil
+}
+
+// AnswerQuestion adds an answer from the item's vendor or from a customer who paid for the item
+func (qs *QuestionService) AnswerQuestion(answer *Answer) *errors.AppError {
+	content, appErr := validateContent(answer.Content)
+	if appErr != nil {
+		return appErr
+	}
+	question, err := qs.questionRepo.GetQuestion(bson.M{"_id": answer.QuestionID, "status": Visible})
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			err := errors.ErrNotFound
+			return errors.NewError("question not found: "+err.Error(), err.StatusCode)
+		}
+		return errors.ErrInternalServer
+	}
+	it, appErr := qs.getItem(question.ItemID)
+	if appErr != nil {
+		return appErr
+	}
+	if it.VendorID == answer.AuthorID {
+		answer.AuthorRole = VendorAnswer
+	} else {
+		bought, err := qs.orderRepo.IsExists(bson.M{
+			"user_id":        answer.AuthorID,
+			"payment_status": order.PaymentStatusPaid,
+			"$or": []bson.M{
+				{"order_items.item_id": it.ID},
+				{"order_items.components.item_id": it.ID},
+			},
+		})
+		if err != nil {
+			return errors.ErrInternalServer
+		}
+		if !bought {
+			err := errors.ErrForbidden
+			return errors.NewError(err.Error()+": only the vendor or customers who bought this item can answer", err.StatusCode)
+		}
+		answer.AuthorRole = BuyerAnswer
+	}
+	authorName, appErr := qs.getAuthorName(answer.AuthorID)
+	if appErr != nil {
+		return appErr
+	}
+	answer.ItemID = question.ItemID
+	answer.Content = content
+	answer.AuthorName = authorName
+	answer.Status = Visible
+	answer.Upvotes = 0
+	answer.CreatedAt = time.Now()
+	answer.UpdatedAt = answer.CreatedAt
+	err = qs.transactor.WithTransaction(func(ctx context.Context) error {
+		if err := qs.answerRepo.CreateAnswerTx(ctx, answer); err != nil {
+			return err
+		}
+		_, err := qs.questionRepo.UpdateQuestionTx(ctx, bson.M{"_id": question.ID}, bson.M{"$inc": bson.M{"answer_count": 1}})
+		return err
+	})
+	if err != nil {
+		return errors.ErrInternalServer
+	}
+	return nil
+}
+
+// UpvoteAnswer counts one upvote per user. Users cannot upvote their own answers.
+func (qs *QuestionService) UpvoteAnswer(answerId string, userId primitive.ObjectID) *errors.AppError {
+	answerID, err := primitive.ObjectIDFromHex(answerId)
+	if err != nil {
+		return errors.ErrInvalidObjectID
+	}
+	answer, err := qs.answerRepo.GetAnswer(bson.M{"_id": answerID, "status": Visible})
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			err := errors.ErrNotFound
+			return errors.NewError("answer not found: "+err.Error(), err.StatusCode)
+		}
+		return errors.ErrInternalServer
+	}
+	if answer.AuthorID == userId {
+		return errors.NewError("you cannot upvote your own answer", 400)
+	}
+	err = qs.transactor.WithTransaction(func(ctx context.Context) error {
+		if err := qs.answerVoteRepo.CreateAnswerVoteTx(ctx, &AnswerVote{AnswerID: answerID, UserID: userId, CreatedAt: time.Now()}); err != nil {
+			return err
+		}
+		_, err := qs.answerRepo.UpdateAnswerTx(ctx, bson.M{"_id": answerID}, bson.M{"$inc": bson.M{"upvotes": 1}})
+		return err
+	})
+	if mongo.IsDuplicateKeyError(err) {
+		return errors.NewError("you have already upvoted this answer", 409)
+	}
+	if err != nil {
+		return errors.ErrInternalServer
+	}
+	return nil
+}
+
+// GetQuestions returns a page of the item's visible questions, newest first, each with its
+// most upvoted answers
+func (qs *QuestionService) GetQuestions(itemId string, pagination *types.Pagination) ([]*Question, *errors.AppError) {
+	itemID, err := primitive.ObjectIDFromHex(itemId)
+	if err != nil {
+		return nil, errors.ErrInvalidObjectID
+	}
+	filter := bson.M{"item_id": itemID, "status": Visible}
+	questions, appErr := qs.getQuestions(filter, pagination)
+	if appErr != nil {
+		return nil, appErr
+	}
+	if len(questions) == 0 {
+		return questions, nil
+	}
+	questionIDs := make([]primitive.ObjectID, 0, len(questions))
+	questionsByID := make(map[primitive.ObjectID]*Question, len(questions))
+	for _, v := range questions {
+		questionIDs = append(questionIDs, v.ID)
+		questionsByID[v.ID] = v
+		v.Answers = []*Answer{}
+	}
+	answers, err := qs.answerRepo.GetAnswers(bson.M{"question_id": bson.M{"$in": questionIDs}, "status": Visible}, options.Find().SetSort(answerSort))
+	if err != nil {
+		return nil, errors.ErrInternalServer
+	}
+	for _, v := range answers {
+		if q := questionsByID[v.QuestionID]; len(q.Answers) < constants.AnswersPerQuestionPreview {
+			q.Answers = append(q.Answers, v)
+		}
+	}
+	return questions, nil
+}
+
+// answerSort ranks answers by upvotes, vendor answers first among equals, then oldest first
+var answerSort = bson.D{{Key: "upvotes", Value: -1}, {Key: "author_role", Value: -1}, {Key: "created_at", Value: 1}}
+
+// GetAnswers returns a page of a visible question's visible answers
+func (qs *QuestionService) GetAnswers(questionId string, pagination *types.Pagination) ([]*Answer, *errors.AppError) {
+	questionID, err := primitive.ObjectIDFromHex(questionId)
+	if err != nil {
+		return nil, errors.ErrInvalidObjectID
+	}
+	if _, err := qs.questionRepo.GetQuestion(bson.M{"_id": questionID, "status": Visible}); err != nil {
+		if err == mongo.ErrNoDocuments {
+			err := errors.ErrNotFound
+			return nil, errors.NewError("question not found: "+err.Error(), err.StatusCode)
+		}
+		return nil, errors.ErrInternalServer
+	}
+	filter := bson.M{"question_id": questionID, "status": Visible}
+	total, err := qs.answerRepo.CountAnswers(filter)
+	if err != nil {
+		return nil, errors.ErrInternalServer
+	}
+	pagination.Total = total
+	answers, err := qs.answerRepo.GetAnswers(filter, pagination.FindOptions().SetSort(answerSort))
+	if err != nil {
+		return nil, errors.ErrInternalServer
+	}
+	return answers, nil
+}
+
+// GetAllQuestions lists questions of any status for moderation, newest first
+func (qs *QuestionService) GetAllQuestions(status Status, pagination *types.Pagination) ([]*Question, *errors.AppError) {
+	filter := bson.M{}
+	if status != "" {
+		if !status.isValid() {
+			return nil, errors.NewError("invalid status", 400)
+		}
+		filter["status"] = status
+	}
+	return qs.getQuestions(filter, pagination)
+}
+
+func (qs *QuestionService) getQuestions(filter bson.M, pagination *types.Pagination) ([]*Question, *errors.AppError) {
+	total, err := qs.questionRepo.CountQuestions(filter)
+	if err != nil {
+		return nil, errors.ErrInternalServer
+	}
+	pagination.Total = total
+	questions, err := qs.questionRepo.GetQuestions(filter, pagination.FindOptions().SetSort(bson.D{{Key: "created_at", Value: -1}}))
+	if err != nil {
+		return nil, errors.ErrInternalServer
+	}
+	return questions, nil
+}
+
+func (qs *QuestionService) ModerateQuestion(questionId string, status Status, adminId primitive.ObjectID) *errors.AppError {
+	questionID, err := primitive.ObjectIDFromHex(questionId)
+	if err != nil {
+		return errors.ErrInvalidObjectID
+	}
+	if !status.isValid() {
+		return errors.NewError("invalid status", 400)
+	}
+	found, err := qs.questionRepo.UpdateQuestion(bson.M{"_id": questionID}, bson.M{"$set": bson.M{"status": status, "moderated_by": adminId, "updated_at": time.Now()}})
+	if err != nil {
+		return errors.ErrInternalServer
+	}
+	if !found {
+		err := errors.ErrNotFound
+		return errors.NewError("question not found: "+err.Error(), err.StatusCode)
+	}
+	return nil
+}
+
+// ModerateAnswer changes an answer's status and keeps its question's answer count to visible answers
+func (qs *QuestionService) ModerateAnswer(answerId string, status Status, adminId primitive.ObjectID) *errors.AppError {
+	answerID, err := primitive.ObjectIDFromHex(answerId)
+	if err != nil {
+		return errors.ErrInvalidObjectID
+	}
+	if !status.isValid() {
+		return errors.NewError("invalid status", 400)
+	}
+	answer, err := qs.answerRepo.GetAnswer(bson.M{"_id": answerID})
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			err := errors.ErrNotFound
+			return errors.NewError("answer not found: "+err.Error(), err.StatusCode)
+		}
+		return errors.ErrInternalServer
+	}
+	err = qs.transactor.WithTransaction(func(ctx context.Context) error {
+		// only the request that actually changes the status adjusts the count
+		changed, err := qs.answerRepo.UpdateAnswerTx(ctx, bson.M{"_id": answerID, "status": bson.M{"$ne": status}}, bson.M{"$set": bson.M{"status": status, "moderated_by": adminId, "updated_at": time.Now()}})
+		if err != nil || !changed {
+			return err
+		}
+		change := 1
+		if status == Hidden {
+			change = -1
+		}
+		_, err = qs.questionRepo.UpdateQuestionTx(ctx, bson.M{"_id": answer.QuestionID}, bson.M{"$inc": bson.M{"answer_count": change}})
+		return err
+	})
+	if err != nil {
+		return errors.ErrInternalServer
+	}
+	return nil
+}
+
+func (s Status) isValid() bool {
+	return s == Visible || s == Hidden
+}
+
+func (qs *QuestionService) getItem(itemID primitive.ObjectID) (*item.Item, *errors.AppError) {
+	it, err := qs.itemRepo.GetItem(bson.M{"_id": itemID, "status": bson.M{"$ne": item.Draft}})
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			err := errors.ErrNotFound
+			return nil, errors.NewError("item not found: "+err.Error(), err.StatusCode)
+		}
+		return nil, errors.ErrInternalServer
+	}
+	return it, nil
+}
+
+func (qs *QuestionService) getAuthorName(userId primitive.ObjectID) (string, *errors.AppError) {
+	user, err := qs.userRepo.GetUser(bson.M{"_id": userId})
+	if err != nil {
+		return "", errors.ErrInternalServer
+	}
+	return user.FirstName + " " + user.LastName, nil
+}
+
+func validateContent(content string) (string, *errors.AppError) {
+	content = strings.TrimSpace(content)
+	if content == "" || len(content) > constants.MaxQuestionLength {
+		return "", errors.NewError("content must be between 1 and "+strconv.Itoa(constants.MaxQuestionLength)+" characters", 400)
+	}
+	return content, nil
+}
@@ -0,0 +1,29 @@
+package recommendation
+
+import (
+	"github.com/ayo-ajayi/ecommerce/internal/errors"
+	"github.com/gin-gonic/gin"
+)
+
+type RecommendationController struct {
+	recommendationServices RecommendationServices
+}
+
+type RecommendationServices interface {
+	GetRecommendations(itemId string) (*Recommendations, *errors.AppError)
+}
+
+func NewRecommendationController(recommendationServices RecommendationServices) *RecommendationController {
+	return &RecommendationController{
+		recommendationServices: recommendationServices,
+	}
+}
+
+func (rc *RecommendationController) GetRelatedItems(c *gin.Context) {
+	recommendations, err := rc.recommendationServices.GetRecommendations(c.Param("id"))
+	if err != nil {
+		c.JSON(err.StatusCode, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	c.JSON(200, gin.H{"data": recommendations})
+}
@@ -0,0 +1,31 @@
+package recommendation
+
+import (
+	"time"
+
+	"github.com/ayo-ajayi/ecommerce/internal/app/item"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// CoPurchase holds the items most often bought in the same order as ItemID
+type CoPurchase struct {
+	ItemID    primitive.ObjectID `json:"item_id" bson:"_id"`
+	Related   []CoPurchaseCount  `json:"related" bson:"related"`
+	UpdatedAt time.Time          `json:"updated_at" bson:"updated_at"`
+}
+
+type CoPurchaseCount struct {
+	ItemID primitive.ObjectID `json:"item_id" bson:"item_id"`
+	Count  int                `json:"count" bson:"count"`
+}
+
+type Recommendations struct {
+	BoughtTogether []*item.Item `json:"bought_together"`
+	Related        []*item.Item `json:"related"`
+}
+
+// relatedIDs is what is cached per item: the ranked candidates, before stock and status are checked
+type relatedIDs struct {
+	BoughtTogether []primitive.ObjectID `json:"bought_together"`
+	Related        []primitive.ObjectID `json:"related"`
+}
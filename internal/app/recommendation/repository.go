@@ -0,0 +1,51 @@
+package recommendation
+
+import (
+	"github.com/ayo-ajayi/ecommerce/internal/database"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type CoPurchaseRepo struct {
+	Collection *mongo.Collection
+}
+
+func NewCoPurchaseRepo(collection *mongo.Collection) *CoPurchaseRepo {
+	return &CoPurchaseRepo{
+		Collection: collection,
+	}
+}
+
+// SaveCoPurchases replaces the stored co-purchases of every item in coPurchases
+func (cr *CoPurchaseRepo) SaveCoPurchases(coPurchases []*CoPurchase) error {
+	if len(coPurchases) == 0 {
+		return nil
+	}
+	ctx, cancel := database.DBReqContext(30)
+	defer cancel()
+	models := make([]mongo.WriteModel, 0, len(coPurchases))
+	for _, v := range coPurchases {
+		models = append(models, mongo.NewReplaceOneModel().SetFilter(bson.M{"_id": v.ItemID}).SetReplacement(v).SetUpsert(true))
+	}
+	_, err := cr.Collection.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+	return err
+}
+
+func (cr *CoPurchaseRepo) GetCoPurchase(filter interface{}, opts ...*options.FindOneOptions) (*CoPurchase, error) {
+	ctx, cancel := database.DBReqContext(5)
+	defer cancel()
+	var coPurchase CoPurchase
+	err := cr.Collection.FindOne(ctx, filter, opts...).Decode(&coPurchase)
+	if err != nil {
+		return nil, err
+	}
+	return &coPurchase, nil
+}
+
+func (cr *CoPurchaseRepo) DeleteCoPurchases(filter interface{}, opts ...*options.DeleteOptions) error {
+	ctx, cancel := database.DBReqContext(5)
+	defer cancel()
+	_, err := cr.Collection.DeleteMany(ctx, filter, opts...)
+	return err
+}
@@ -0,0 +1,210 @@
+package recommendation
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/ayo-ajayi/ecommerce/internal/app/item"
+	"github.com/ayo-ajayi/ecommerce/internal/app/order"
+	"github.com/ayo-ajayi/ecommerce/internal/constants"
+	"github.com/ayo-ajayi/ecommerce/internal/database"
+	"github.com/ayo-ajayi/ecommerce/internal/errors"
+	"github.com/redis/go-redis/v9"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type RecommendationService struct {
+	coPurchaseRepo CoPurchaseRepository
+	orderRepo      OrderRepository
+	itemRepo       ItemRepository
+	itemPreparer   ItemPreparer
+	redisClient    *redis.Client
+}
+
+type CoPurchaseRepository interface {
+	SaveCoPurchases(coPurchases []*CoPurchase) error
+	GetCoPurchase(filter interface{}, opts ...*options.FindOneOptions) (*CoPurchase, error)
+	DeleteCoPurchases(filter interface{}, opts ...*options.DeleteOptions) error
+}
+
+type OrderRepository interface {
+	Aggregate(pipeline interface{}, result interface{}) error
+}
+
+type ItemRepository interface {
+	GetItem(filter interface{}, opts ...*options.FindOneOptions) (*item.Item, error)
+	GetItems(filter interface{}, opts ...*options.FindOptions) ([]*item.Item, error)
+}
+
+// ItemPreparer fills in an item's effective price and computed stock
+type ItemPreparer interface {
+	PrepareItems(items ...*item.Item) *errors.AppError
+}
+
+func NewRecommendationService(coPurchaseRepo CoPurchaseRepository, orderRepo OrderRepository, itemRepo ItemRepository, itemPreparer ItemPreparer, redisClient *redis.Client) *RecommendationService {
+	return &RecommendationService{
+		coPurchaseRepo: coPurchaseRepo,
+		orderRepo:      orderRepo,
+		itemRepo:       itemRepo,
+		itemPreparer:   itemPreparer,
+		redisClient:    redisClient,
+	}
+}
+
+// RunCoPurchaseJob recomputes co-purchases now and then at every interval. It never returns.
+func (rs *RecommendationService) RunCoPurchaseJob(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := rs.ComputeCoPurchases(); err != nil {
+			log.Println("failed to compute co-purchases: " + err.Error())
+		}
+		<-ticker.C
+	}
+}
+
+// ComputeCoPurchases counts how often each pair of items was bought in the same paid
+// order and stores the most frequent partners of every item. The pairs are counted by the
+// database, so only the results are loaded.
+func (rs *RecommendationService) ComputeCoPurchases() error {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"payment_status": order.PaymentStatusPaid}}},
+		// each item counts once per order however many lines it is on
+		{{Key: "$project", Value: bson.M{"_id": 0, "items": bson.M{"$setUnion": bson.A{"$order_items.item_id", bson.A{}}}}}},
+		{{Key: "$match", Value: bson.M{"items.1": bson.M{"$exists": true}}}},
+		{{Key: "$project", Value: bson.M{"item": "$items", "related": "$items"}}},
+		{{Key: "$unwind", Value: "$item"}},
+		{{Key: "$unwind", Value: "$related"}},
+		{{Key: "$match", Value: bson.M{"$expr": bson.M{"$ne": bson.A{"$item", "$related"}}}}},
+		{{Key: "$group", Value: bson.M{"_id": bson.M{"item": "$item", "related": "$related"}, "count": bson.M{"$sum": 1}}}},
+		{{Key: "$sort", Value: bson.D{{Key: "_id.item", Value: 1}, {Key: "count", Value: -1}, {Key: "_id.related", Value: 1}}}},
+		{{Key: "$group", Value: bson.M{"_id": "$_id.item", "related": bson.M{"$push": bson.M{"item_id": "$_id.related", "count": "$count"}}}}},
+		{{Key: "$project", Value: bson.M{"related": bson.M{"$slice": bson.A{"$related", constants.MaxCoPurchasesPerItem}}}}},
+	}
+	coPurchases := []*CoPurchase{}
+	if err := rs.orderRepo.Aggregate(pipeline, &coPurchases); err != nil {
+		return err
+	}
+
+	runAt := time.Now()
+	for _, v := range coPurchases {
+		v.UpdatedAt = runAt
+	}
+	if err := rs.coPurchaseRepo.SaveCoPurchases(coPurchases); err != nil {
+		return err
+	}
+	return rs.coPurchaseRepo.DeleteCoPurchases(bson.M{"updated_at": bson.M{"$lt": runAt}})
+}
+
+// GetRecommendations returns the items most often bought with the item and, as a fallback,
+// items from the same categories and vendor. Drafts and out-of-stock items are left out.
+func (rs *RecommendationService) GetRecommendations(itemId string) (*Recommendations, *errors.AppError) {
+	objectID, err := primitive.ObjectIDFromHex(itemId)
+	if err != nil {
+		return nil, errors.ErrInvalidObjectID
+	}
+	ids, appErr := rs.getRelatedIDs(objectID)
+	if appErr != nil {
+		return nil, appErr
+	}
+	candidates := append(append([]primitive.ObjectID{}, ids.BoughtTogether...), ids.Related...)
+	recommendations := &Recommendations{BoughtTogether: []*item.Item{}, Related: []*item.Item{}}
+	if len(candidates) == 0 {
+		return recommendations, nil
+	}
+	items, err := rs.itemRepo.GetItems(bson.M{"_id": bson.M{"$in": candidates}, "status": bson.M{"$ne": item.Draft}})
+	if err != nil {
+		return nil, errors.ErrInternalServer
+	}
+	if err := rs.itemPreparer.PrepareItems(items...); err != nil {
+		return nil, err
+	}
+	itemsByID := make(map[primitive.ObjectID]*item.Item, len(items))
+	for _, v := range items {
+		if v.InStock() {
+			itemsByID[v.ID] = v
+		}
+	}
+	pick := func(ids []primitive.ObjectID) []*item.Item {
+		picked := []*item.Item{}
+		for _, id := range ids {
+			if it, ok := itemsByID[id]; ok && len(picked) < constants.RelatedItemsLimit {
+				picked = append(picked, it)
+				delete(itemsByID, id)
+			}
+		}
+		return picked
+	}
+	recommendations.BoughtTogether = pick(ids.BoughtTogether)
+	recommendations.Related = pick(ids.Related)
+	return recommendations, nil
+}
+
+// getRelatedIDs returns the ranked candidates for the item from the cache, computing them on a miss
+func (rs *RecommendationService) getRelatedIDs(itemID primitive.ObjectID) (*relatedIDs, *errors.AppError) {
+	key := "related:" + itemID.Hex()
+	ctx, cancel := database.DBReqContext(5)
+	defer cancel()
+	if cached, err := rs.redisClient.Get(ctx, key).Result(); err == nil {
+		ids := &relatedIDs{}
+		if err := json.Unmarshal([]byte(cached), ids); err == nil {
+			return ids, nil
+		}
+	} else if err != redis.Nil {
+		log.Println("failed to read related items cache: " + err.Error())
+	}
+
+	it, err := rs.itemRepo.GetItem(bson.M{"_id": itemID})
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			err := errors.ErrNotFound
+			return nil, errors.NewError("item not found: "+err.Error(), err.StatusCode)
+		}
+		return nil, errors.ErrInternalServer
+	}
+	ids := &relatedIDs{}
+	exclude := []primitive.ObjectID{itemID}
+	coPurchase, err := rs.coPurchaseRepo.GetCoPurchase(bson.M{"_id": itemID})
+	if err != nil && err != mongo.ErrNoDocuments {
+		return nil, errors.ErrInternalServer
+	}
+	if coPurchase != nil {
+		for _, v := range coPurchase.Related {
+			ids.BoughtTogether = append(ids.BoughtTogether, v.ItemID)
+		}
+		exclude = append(exclude, ids.BoughtTogether...)
+	}
+
+	// over-fetch so there are still enough once drafts and out-of-stock items are dropped
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}).SetLimit(int64(constants.RelatedItemsLimit * 2)).SetProjection(bson.M{"_id": 1})
+	var similar []bson.M
+	if len(it.CategoryID) > 0 {
+		similar = append(similar, bson.M{"category_id": bson.M{"$in": it.CategoryID}})
+	}
+	if !it.VendorID.IsZero() {
+		similar = append(similar, bson.M{"vendor_id": it.VendorID})
+	}
+	for _, filter := range similar {
+		filter["_id"] = bson.M{"$nin": exclude}
+		filter["status"] = bson.M{"$ne": item.Draft}
+		items, err := rs.itemRepo.GetItems(filter, opts)
+		if err != nil {
+			return nil, errors.ErrInternalServer
+		}
+		for _, v := range items {
+			ids.Related = append(ids.Related, v.ID)
+			exclude = append(exclude, v.ID)
+		}
+	}
+
+	if data, err := json.Marshal(ids); err == nil {
+		if err := rs.redisClient.Set(ctx, key, data, time.Minute*time.Duration(constants.RelatedItemsCacheValidityInMins)).Err(); err != nil {
+			log.Println("failed to cache related items: " + err.Error())
+		}
+	}
+	return ids, nil
+}
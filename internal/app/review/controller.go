@@ -1,9 +1,13 @@
 package review
 
 import (
+	"context"
+	"mime/multipart"
 	"net/http"
+	"strconv"
 
 	"github.com/ayo-ajayi/ecommerce/internal/errors"
+	"github.com/ayo-ajayi/ecommerce/internal/types"
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
@@ -13,9 +17,18 @@ type ReviewController struct {
 }
 
 type ReviewServices interface {
-	PostReview(review *Review) *errors.AppError
+	PostReview(ctx context.Context, review *Review, photos []*multipart.FileHeader) *errors.AppError
+	ReplyToReview(reviewId string, vendorId primitive.ObjectID, content string) (*Review, *errors.AppError)
 	GetReview(reviewId string) (*Review, *errors.AppError)
-	GetReviews(itemId string) ([]*Review, *errors.AppError)
+	GetReviews(itemId string, query *ReviewQuery) ([]*Review, *errors.AppError)
+	VoteReview(reviewId string, userId primitive.ObjectID, helpful bool) *errors.AppError
+	DeleteReview(reviewId string, authorId primitive.ObjectID) *errors.AppError
+	RecomputeRatings() *errors.AppError
+	ReportReview(reviewId string, report *Report) *errors.AppError
+	ModerateReview(reviewId string, action Action, note string, adminId primitive.ObjectID) *errors.AppError
+	GetModerationQueue(status Status, pagination *types.Pagination) ([]*Review, *errors.AppError)
+	GetReports(reviewId string, pagination *types.Pagination) ([]*Report, *errors.AppError)
+	GetModerationLog(reviewId string) ([]*ModerationLog, *errors.AppError)
 }
 
 func NewReviewController(reviewServices ReviewServices) *ReviewController {
@@ -24,6 +37,7 @@ func NewReviewController(reviewServices ReviewServices) *ReviewController {
 	}
 }
 
+// PostReview takes the review as JSON, or as a multipart form with its photos as images
 func (rc *ReviewController) PostReview(c *gin.Context) {
 	userid := c.MustGet("userId").(primitive.ObjectID)
 	if userid.IsZero() || userid.Hex() == "" {
@@ -36,7 +50,35 @@ func (rc *ReviewController) PostReview(c *gin.Context) {
 		Content   string             `json:"content" binding:"required"`
 		Anonymous bool               `json:"anonymous"`
 	}{}
-	if err := c.ShouldBindJSON(&req); err != nil {
+	var photos []*multipart.FileHeader
+	if c.ContentType() == "multipart/form-data" {
+		if err := c.Request.ParseMultipartForm(32 << 20); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": "file too large" + err.Error()}})
+			return
+		}
+		itemID, err := primitive.ObjectIDFromHex(c.PostForm("item_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": "invalid item id"}})
+			return
+		}
+		star, err := strconv.Atoi(c.PostForm("star"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": "invalid star"}})
+			return
+		}
+		req.ItemID, req.Star, req.Content = itemID, star, c.PostForm("content")
+		if req.Content == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": "invalid content"}})
+			return
+		}
+		if anonymous := c.PostForm("anonymous"); anonymous != "" {
+			if req.Anonymous, err = strconv.ParseBool(anonymous); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": "invalid anonymous"}})
+				return
+			}
+		}
+		photos = c.Request.MultipartForm.File["photos"]
+	} else if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": err.Error()}})
 		return
 	}
@@ -47,7 +89,7 @@ func (rc *ReviewController) PostReview(c *gin.Context) {
 		Content:   req.Content,
 		Anonymous: req.Anonymous,
 	}
-	if err := rc.reviewServices.PostReview(&review); err != nil {
+	if err := rc.reviewServices.PostReview(c.Request.Context(), &review, photos); err != nil {
 		c.JSON(err.StatusCode, gin.H{"error": gin.H{"message": err.Error()}})
 		return
 	}
@@ -64,18 +106,170 @@ func (rc *ReviewController) GetReview(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"data": gin.H{"review": review}})
 }
 
+// GetReviews lists an item's reviews. The item is given as ?item_id=, or in the JSON body as before.
 func (rc *ReviewController) GetReviews(c *gin.Context) {
+	itemId := c.Query("item_id")
+	if itemId == "" {
+		req := struct {
+			ItemID string `json:"item_id" binding:"required"`
+		}{}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": err.Error()}})
+			return
+		}
+		itemId = req.ItemID
+	}
+	query, err := ParseReviewQuery(c)
+	if err != nil {
+		c.JSON(err.StatusCode, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	reviews, err := rc.reviewServices.GetReviews(itemId, query)
+	if err != nil {
+		c.JSON(err.StatusCode, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": gin.H{"reviews": reviews, "pagination": query.Pagination}})
+}
+
+func (rc *ReviewController) VoteReview(c *gin.Context) {
+	userid := c.MustGet("userId").(primitive.ObjectID)
+	if userid.IsZero() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": "invalid user"}})
+		return
+	}
+	req := struct {
+		Helpful *bool `json:"helpful" binding:"required"`
+	}{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	if err := rc.reviewServices.VoteReview(c.Param("id"), userid, *req.Helpful); err != nil {
+		c.JSON(err.StatusCode, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "vote recorded successfully"})
+}
+
+func (rc *ReviewController) DeleteReview(c *gin.Context) {
+	userid := c.MustGet("userId").(primitive.ObjectID)
+	if userid.IsZero() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": "invalid user"}})
+		return
+	}
+	if err := rc.reviewServices.DeleteReview(c.Param("id"), userid); err != nil {
+		c.JSON(err.StatusCode, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "review deleted successfully"})
+}
+
+func (rc *ReviewController) RecomputeRatings(c *gin.Context) {
+	if err := rc.reviewServices.RecomputeRatings(); err != nil {
+		c.JSON(err.StatusCode, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"message": "rating recompute started"})
+}
+
+func (rc *ReviewController) ReportReview(c *gin.Context) {
+	userid := c.MustGet("userId").(primitive.ObjectID)
+	if userid.IsZero() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": "invalid user"}})
+		return
+	}
+	req := struct {
+		Reason  ReportReason `json:"reason" binding:"required"`
+		Details string       `json:"details"`
+	}{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	report := &Report{ReporterID: userid, Reason: req.Reason, Details: req.Details}
+	if err := rc.reviewServices.ReportReview(c.Param("id"), report); err != nil {
+		c.JSON(err.StatusCode, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	c.JSON(201, gin.H{"message": "review reported successfully"})
+}
+
+func (rc *ReviewController) ModerateReview(c *gin.Context) {
+	userid := c.MustGet("userId").(primitive.ObjectID)
+	if userid.IsZero() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": "invalid user"}})
+		return
+	}
+	req := struct {
+		Action Action `json:"action" binding:"required"`
+		Note   string `json:"note"`
+	}{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	if err := rc.reviewServices.ModerateReview(c.Param("id"), req.Action, req.Note, userid); err != nil {
+		c.JSON(err.StatusCode, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	c.JSON(200, gin.H{"message": "review moderated successfully"})
+}
+
+func (rc *ReviewController) GetModerationQueue(c *gin.Context) {
+	pagination, err := types.NewPagination(c.Query("page"), c.Query("limit"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	reviews, appErr := rc.reviewServices.GetModerationQueue(Status(c.Query("status")), pagination)
+	if appErr != nil {
+		c.JSON(appErr.StatusCode, gin.H{"error": gin.H{"message": appErr.Error()}})
+		return
+	}
+	c.JSON(200, gin.H{"data": gin.H{"reviews": reviews, "pagination": pagination}})
+}
+
+func (rc *ReviewController) GetReports(c *gin.Context) {
+	pagination, err := types.NewPagination(c.Query("page"), c.Query("limit"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	reports, appErr := rc.reviewServices.GetReports(c.Param("id"), pagination)
+	if appErr != nil {
+		c.JSON(appErr.StatusCode, gin.H{"error": gin.H{"message": appErr.Error()}})
+		return
+	}
+	c.JSON(200, gin.H{"data": gin.H{"reports": reports, "pagination": pagination}})
+}
+
+func (rc *ReviewController) GetModerationLog(c *gin.Context) {
+	logs, err := rc.reviewServices.GetModerationLog(c.Param("id"))
+	if err != nil {
+		c.JSON(err.StatusCode, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	c.JSON(200, gin.H{"data": gin.H{"moderation_log": logs}})
+}
+
+func (rc *ReviewController) ReplyToReview(c *gin.Context) {
+	vendorId := c.MustGet("userId").(primitive.ObjectID)
+	if vendorId.IsZero() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": "invalid user"}})
+		return
+	}
 	req := struct {
-		ItemID string `json:"item_id" binding:"required"`
+		Content string `json:"content" binding:"required"`
 	}{}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": err.Error()}})
 		return
 	}
-	reviews, err := rc.reviewServices.GetReviews(req.ItemID)
+	review, err := rc.reviewServices.ReplyToReview(c.Param("id"), vendorId, req.Content)
 	if err != nil {
 		c.JSON(err.StatusCode, gin.H{"error": gin.H{"message": err.Error()}})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"data": gin.H{"reviews": reviews}})
+	c.JSON(201, gin.H{"message": "reply posted successfully", "data": gin.H{"review": review}})
 }
@@ -0,0 +1,244 @@
+package review
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/ayo-ajayi/ecommerce/internal/app/user"
+	"github.com/ayo-ajayi/ecommerce/internal/constants"
+	"github.com/ayo-ajayi/ecommerce/internal/errors"
+	"github.com/ayo-ajayi/ecommerce/internal/types"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// words lowercases text and reduces it to words separated by single spaces, padded with a space
+// on each side so that phrases can be matched as whole words
+func words(text string) string {
+	return " " + strings.Join(strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}), " ") + " "
+}
+
+// holdReason returns why the moderation rules hold the review, or "" to publish it
+func (rs *ReviewSevice) holdReason(review *Review, author *user.User) string {
+	if rs.rules == nil {
+		return ""
+	}
+	if author != nil && rs.rules.MinAccountAgeDays > 0 && time.Since(author.CreatedAt) < time.Hour*24*time.Duration(rs.rules.MinAccountAgeDays) {
+		return "account is less than " + strconv.Itoa(rs.rules.MinAccountAgeDays) + " days old"
+	}
+	content := words(review.Content)
+	for _, v := range rs.rules.BannedWords {
+		if banned := words(v); banned != "  " && strings.Contains(content, banned) {
+			return "uses banned word: " + strings.TrimSpace(banned)
+		}
+	}
+	return ""
+}
+
+func (rs *ReviewSevice) logModeration(ctx context.Context, review *Review, action Action, from, to Status, moderatorID primitive.ObjectID, note string) error {
+	return rs.moderationLogs.CreateModerationLogTx(ctx, &ModerationLog{
+		ReviewID:    review.ID,
+		ItemID:      review.ItemID,
+		Action:      action,
+		FromStatus:  from,
+		ToStatus:    to,
+		ModeratorID: moderatorID,
+		Note:        note,
+		CreatedAt:   time.Now(),
+	})
+}
+
+func (r ReportReason) isValid() bool {
+	switch r {
+	case SpamReason, OffensiveReason, OffTopicReason, FakeReason, OtherReason:
+		return true
+	}
+	return false
+}
+
+// ReportReview records a user's report of a published review. Each user can report a review once.
+// A review reported as many times as the report threshold is held for moderation.
+func (rs *ReviewSevice) ReportReview(reviewId string, report *Report) *errors.AppError {
+	reviewID, err := primitive.ObjectIDFromHex(reviewId)
+	if err != nil {
+		return errors.ErrInvalidObjectID
+	}
+	if !report.Reason.isValid() {
+		return errors.NewError("invalid reason", 400)
+	}
+	report.Details = strings.TrimSpace(report.Details)
+	if len(report.Details) > constants.MaxReviewReportDetailsLength {
+		return errors.NewError("details must be at most "+strconv.Itoa(constants.MaxReviewReportDetailsLength)+" characters", 400)
+	}
+	review, err := rs.reviewRepository.GetReview(bson.M{"_id": reviewID, "status": bson.M{"$not": unapproved}})
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			err := errors.ErrNotFound
+			return errors.NewError("review not found: "+err.Error(), err.StatusCode)
+		}
+		return errors.ErrInternalServer
+	}
+	if review.AuthorID == report.ReporterID {
+		return errors.NewError("you cannot report your own review", 400)
+	}
+	report.ReviewID = reviewID
+	report.CreatedAt = time.Now()
+	err = rs.transactor.WithTransaction(func(ctx context.Context) error {
+		if err := rs.reportRepository.CreateReportTx(ctx, report); err != nil {
+			return err
+		}
+		if _, err := rs.reviewRepository.UpdateReviewTx(ctx, bson.M{"_id": reviewID}, bson.M{"$inc": bson.M{"report_count": 1}}); err != nil {
+			return err
+		}
+		if rs.rules == nil || rs.rules.ReportThreshold <= 0 {
+			return nil
+		}
+		reason := "reported " + strconv.Itoa(rs.rules.ReportThreshold) + " times"
+		held, err := rs.reviewRepository.UpdateReviewTx(ctx, bson.M{
+			"_id":          reviewID,
+			"status":       bson.M{"$not": unapproved},
+			"report_count": bson.M{"$gte": rs.rules.ReportThreshold},
+		}, bson.M{"$set": bson.M{"status": Pending, "hold_reason": reason}})
+		if err != nil || !held {
+			return err
+		}
+		if err := rs.logModeration(ctx, review, HoldAction, review.Status, Pending, primitive.NilObjectID, reason); err != nil {
+			return err
+		}
+		return rs.updateRating(ctx, review.ItemID)
+	})
+	if mongo.IsDuplicateKeyError(err) {
+		return errors.NewError("you have already reported this review", 409)
+	}
+	if err != nil {
+		return errors.ErrInternalServer
+	}
+	return nil
+}
+
+// ModerateReview approves, hides or deletes a review and records it in the review's audit trail.
+// Approving a review clears its reports, so it is only held again by new ones. Deleting a review
+// deletes its votes and reports too.
+func (rs *ReviewSevice) ModerateReview(reviewId string, action Action, note string, adminId primitive.ObjectID) *errors.AppError {
+	reviewID, err := primitive.ObjectIDFromHex(reviewId)
+	if err != nil {
+		return errors.ErrInvalidObjectID
+	}
+	var to Status
+	set := bson.M{"moderated_by": adminId, "hold_reason": ""}
+	switch action {
+	case ApproveAction:
+		to = Approved
+		set["report_count"] = 0
+	case HideAction:
+		to = Hidden
+	case DeleteAction:
+	default:
+		return errors.NewError("invalid action", 400)
+	}
+	set["status"] = to
+	review, err := rs.reviewRepository.GetReview(bson.M{"_id": reviewID})
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			err := errors.ErrNotFound
+			return errors.NewError("review not found: "+err.Error(), err.StatusCode)
+		}
+		return errors.ErrInternalServer
+	}
+
+	found := false
+	err = rs.transactor.WithTransaction(func(ctx context.Context) error {
+		var err error
+		if action == DeleteAction {
+			found, err = rs.deleteReviewTx(ctx, bson.M{"_id": reviewID}, reviewID)
+		} else {
+			found, err = rs.reviewRepository.UpdateReviewTx(ctx, bson.M{"_id": reviewID}, bson.M{"$set": set})
+		}
+		if err != nil || !found {
+			return err
+		}
+		if err := rs.logModeration(ctx, review, action, review.Status, to, adminId, strings.TrimSpace(note)); err != nil {
+			return err
+		}
+		return rs.updateRating(ctx, review.ItemID)
+	})
+	if err != nil {
+		return errors.ErrInternalServer
+	}
+	if !found {
+		err := errors.ErrNotFound
+		return errors.NewError("review not found: "+err.Error(), err.StatusCode)
+	}
+	if action == DeleteAction {
+		rs.deletePhotos(review.Photos)
+	}
+	return nil
+}
+
+// GetModerationQueue lists the reviews with the status, pending by default, most reported first
+// and then oldest first. Approved reviews are listed only when they have been reported.
+func (rs *ReviewSevice) GetModerationQueue(status Status, pagination *types.Pagination) ([]*Review, *errors.AppError) {
+	var filter bson.M
+	switch status {
+	case "", Pending:
+		filter = bson.M{"status": Pending}
+	case Hidden:
+		filter = bson.M{"status": Hidden}
+	case Approved:
+		filter = bson.M{"status": bson.M{"$not": unapproved}, "report_count": bson.M{"$gt": 0}}
+	default:
+		return nil, errors.NewError("invalid status", 400)
+	}
+	total, err := rs.reviewRepository.CountReviews(filter)
+	if err != nil {
+		return nil, errors.ErrInternalServer
+	}
+	pagination.Total = total
+	reviews, err := rs.reviewRepository.GetReviews(filter, pagination.FindOptions().SetSort(bson.D{{Key: "report_count", Value: -1}, {Key: "updated_at", Value: 1}}))
+	if err != nil {
+		return nil, errors.ErrInternalServer
+	}
+	if reviews == nil {
+		reviews = []*Review{}
+	}
+	return reviews, nil
+}
+
+// GetReports lists the reports of a review, most recent first
+func (rs *ReviewSevice) GetReports(reviewId string, pagination *types.Pagination) ([]*Report, *errors.AppError) {
+	reviewID, err := primitive.ObjectIDFromHex(reviewId)
+	if err != nil {
+		return nil, errors.ErrInvalidObjectID
+	}
+	filter := bson.M{"review_id": reviewID}
+	total, err := rs.reportRepository.CountReports(filter)
+	if err != nil {
+		return nil, errors.ErrInternalServer
+	}
+	pagination.Total = total
+	reports, err := rs.reportRepository.GetReports(filter, pagination.FindOptions().SetSort(bson.D{{Key: "created_at", Value: -1}}))
+	if err != nil {
+		return nil, errors.ErrInternalServer
+	}
+	return reports, nil
+}
+
+// GetModerationLog returns the audit trail of a review, oldest first. It outlives deleted reviews.
+func (rs *ReviewSevice) GetModerationLog(reviewId string) ([]*ModerationLog, *errors.AppError) {
+	reviewID, err := primitive.ObjectIDFromHex(reviewId)
+	if err != nil {
+		return nil, errors.ErrInvalidObjectID
+	}
+	logs, err := rs.moderationLogs.GetModerationLogs(bson.M{"review_id": reviewID}, options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+	if err != nil {
+		return nil, errors.ErrInternalServer
+	}
+	return logs, nil
+}
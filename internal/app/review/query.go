@@ -0,0 +1,80 @@
+package review
+
+import (
+	"strconv"
+
+	"github.com/ayo-ajayi/ecommerce/internal/errors"
+	"github.com/ayo-ajayi/ecommerce/internal/types"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ReviewQuery is a page of an item's reviews, optionally narrowed to some star ratings
+type ReviewQuery struct {
+	Stars      []int
+	Sort       ReviewSort
+	Pagination *types.Pagination
+}
+
+// ReviewSort orders an item's reviews. Ties are broken by the most recently posted or edited review first.
+type ReviewSort string
+
+const (
+	// SortByHelpful lists the reviews most voted helpful first. It is the default.
+	SortByHelpful ReviewSort = "helpful"
+	SortByNewest  ReviewSort = "newest"
+	SortByHighest ReviewSort = "highest"
+	SortByLowest  ReviewSort = "lowest"
+)
+
+// ParseReviewQuery reads ?sort=helpful&star=4&star=5&page=1&limit=10
+func ParseReviewQuery(c *gin.Context) (*ReviewQuery, *errors.AppError) {
+	query := &ReviewQuery{Sort: ReviewSort(c.Query("sort"))}
+	switch query.Sort {
+	case "":
+		query.Sort = SortByHelpful
+	case SortByHelpful, SortByNewest, SortByHighest, SortByLowest:
+	default:
+		return nil, errors.NewError("invalid sort", 400)
+	}
+	for _, v := range c.QueryArray("star") {
+		star, err := strconv.Atoi(v)
+		if err != nil || star < 1 || star > 5 {
+			return nil, errors.NewError("invalid star", 400)
+		}
+		query.Stars = append(query.Stars, star)
+	}
+	pagination, err := types.NewPagination(c.Query("page"), c.Query("limit"))
+	if err != nil {
+		return nil, errors.NewError(err.Error(), 400)
+	}
+	query.Pagination = pagination
+	return query, nil
+}
+
+// Filter narrows the approved reviews of an item to the queried star ratings
+func (q *ReviewQuery) Filter(filter bson.M) bson.M {
+	if len(q.Stars) > 0 {
+		filter["star"] = bson.M{"$in": q.Stars}
+	}
+	return filter
+}
+
+// FindOptions selects the queried page in the queried order. Reviews are newest by when they were
+// last posted or edited, and the id keeps the order of reviews saved at the same time stable.
+func (q *ReviewQuery) FindOptions() *options.FindOptions {
+	newest := bson.D{{Key: "updated_at", Value: -1}, {Key: "_id", Value: -1}}
+	opts := q.Pagination.FindOptions()
+	switch q.Sort {
+	case SortByNewest:
+		opts.SetSort(newest)
+	case SortByHighest:
+		opts.SetSort(append(bson.D{{Key: "star", Value: -1}}, newest...))
+	case SortByLowest:
+		opts.SetSort(append(bson.D{{Key: "star", Value: 1}}, newest...))
+	default:
+		opts.SetSort(append(bson.D{{Key: "helpful_count", Value: -1}, {Key: "unhelpful_count", Value: 1}}, newest...))
+	}
+	return opts
+}
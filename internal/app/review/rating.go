@@ -0,0 +1,104 @@
+package review
+
+import (
+	"context"
+	"log"
+
+	"github.com/ayo-ajayi/ecommerce/internal/app/item"
+	"github.com/ayo-ajayi/ecommerce/internal/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// starCount is the number of an item's reviews with one star rating
+type starCount struct {
+	ID struct {
+		ItemID primitive.ObjectID `bson:"item_id"`
+		Star   int                `bson:"star"`
+	} `bson:"_id"`
+	Count int `bson:"count"`
+}
+
+// starCountPipeline counts the matching approved reviews by item and star. Reviews without a valid star are left out.
+func starCountPipeline(match bson.M) bson.A {
+	match["star"] = bson.M{"$gte": 1, "$lte": 5}
+	match["status"] = bson.M{"$not": unapproved}
+	return bson.A{
+		bson.M{"$match": match},
+		bson.M{"$group": bson.M{"_id": bson.M{"item_id": "$item_id", "star": "$star"}, "count": bson.M{"$sum": 1}}},
+	}
+}
+
+// ratings turns star counts into the rating of each item
+func ratings(counts []*starCount) map[primitive.ObjectID]*item.Rating {
+	histograms := make(map[primitive.ObjectID][5]int)
+	for _, v := range counts {
+		histogram := histograms[v.ID.ItemID]
+		histogram[v.ID.Star-1] += v.Count
+		histograms[v.ID.ItemID] = histogram
+	}
+	result := make(map[primitive.ObjectID]*item.Rating, len(histograms))
+	for itemID, histogram := range histograms {
+		result[itemID] = item.NewRating(histogram)
+	}
+	return result
+}
+
+// updateRating recomputes the item's rating from its reviews, as part of the transaction ctx belongs to
+func (rs *ReviewSevice) updateRating(ctx context.Context, itemID primitive.ObjectID) error {
+	var counts []*starCount
+	if err := rs.reviewRepository.AggregateTx(ctx, starCountPipeline(bson.M{"item_id": itemID}), &counts); err != nil {
+		return err
+	}
+	rating, ok := ratings(counts)[itemID]
+	if !ok {
+		rating = item.NewRating([5]int{})
+	}
+	return rs.itemRepository.UpdateItemTx(ctx, bson.M{"_id": itemID}, bson.M{"$set": bson.M{"rating": rating}})
+}
+
+// RecomputeRatings starts recomputing the rating of every reviewed or rated item in the background.
+// It repairs ratings of items reviewed before ratings were kept. Only one recompute runs at a time.
+func (rs *ReviewSevice) RecomputeRatings() *errors.AppError {
+	if !rs.recomputing.CompareAndSwap(false, true) {
+		return errors.NewError("ratings are already being recomputed", 409)
+	}
+	go func() {
+		defer rs.recomputing.Store(false)
+		updated, err := rs.recomputeRatings()
+		if err != nil {
+			log.Println("failed to recompute ratings: " + err.Error())
+			return
+		}
+		log.Printf("recomputed the ratings of %d items\n", updated)
+	}()
+	return nil
+}
+
+func (rs *ReviewSevice) recomputeRatings() (int, error) {
+	var counts []*starCount
+	if err := rs.reviewRepository.Aggregate(starCountPipeline(bson.M{}), &counts); err != nil {
+		return 0, err
+	}
+	rated, err := rs.itemRepository.GetItems(bson.M{"rating": bson.M{"$exists": true}}, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return 0, err
+	}
+	itemIDs := make(map[primitive.ObjectID]bool)
+	for _, v := range counts {
+		itemIDs[v.ID.ItemID] = true
+	}
+	for _, v := range rated {
+		itemIDs[v.ID] = true
+	}
+	// each item is recomputed in its own transaction so reviews posted meanwhile are not lost
+	for itemID := range itemIDs {
+		if err := rs.transactor.WithTransaction(func(ctx context.Context) error {
+			return rs.updateRating(ctx, itemID)
+		}); err != nil {
+			return 0, err
+		}
+	}
+	return len(itemIDs), nil
+}
@@ -0,0 +1,77 @@
+package review
+
+import (
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ayo-ajayi/ecommerce/internal/constants"
+	"github.com/ayo-ajayi/ecommerce/internal/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ReplyToReview posts the item vendor's public reply to a published review and emails the review's
+// author about it. Each review can have one reply.
+func (rs *ReviewSevice) ReplyToReview(reviewId string, vendorId primitive.ObjectID, content string) (*Review, *errors.AppError) {
+	reviewID, err := primitive.ObjectIDFromHex(reviewId)
+	if err != nil {
+		return nil, errors.ErrInvalidObjectID
+	}
+	content = strings.TrimSpace(content)
+	if content == "" {
+		return nil, errors.NewError("invalid content", 400)
+	}
+	if len(content) > constants.MaxReviewReplyLength {
+		return nil, errors.NewError("content must be at most "+strconv.Itoa(constants.MaxReviewReplyLength)+" characters", 400)
+	}
+	review, err := rs.reviewRepository.GetReview(bson.M{"_id": reviewID, "status": bson.M{"$not": unapproved}})
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			err := errors.ErrNotFound
+			return nil, errors.NewError("review not found: "+err.Error(), err.StatusCode)
+		}
+		return nil, errors.ErrInternalServer
+	}
+	it, err := rs.itemRepository.GetItem(bson.M{"_id": review.ItemID})
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			err := errors.ErrNotFound
+			return nil, errors.NewError("item not found: "+err.Error(), err.StatusCode)
+		}
+		return nil, errors.ErrInternalServer
+	}
+	if it.VendorID != vendorId {
+		err := errors.ErrForbidden
+		return nil, errors.NewError(err.Error()+": vendors can only reply to reviews of their own items", err.StatusCode)
+	}
+	if review.Reply != nil {
+		return nil, errors.NewError("this review already has a reply", 409)
+	}
+
+	reply := &Reply{VendorID: vendorId, Content: content, CreatedAt: time.Now()}
+	review, err = rs.reviewRepository.FindOneAndUpdateReview(
+		bson.M{"_id": reviewID, "reply": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"reply": reply}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, errors.NewError("this review already has a reply", 409)
+		}
+		return nil, errors.ErrInternalServer
+	}
+
+	author, err := rs.userRepository.GetUser(bson.M{"_id": review.AuthorID})
+	if err == nil {
+		err = rs.emailRepository.SendReviewReplyEmail(author.Email, author.FirstName, it.Name, content)
+	}
+	if err != nil {
+		// the reply is saved on the review, so the author still sees it there
+		log.Println("failed to email reply to review " + review.ID.Hex() + ": " + err.Error())
+	}
+	return review, nil
+}
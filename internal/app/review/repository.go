@@ -1,8 +1,12 @@
 package review
 
 import (
+	"context"
+	"errors"
+
 	"github.com/ayo-ajayi/ecommerce/internal/database"
 
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
@@ -17,6 +21,28 @@ func NewReviewRepo(collection *mongo.Collection) *ReviewRepo {
 	}
 }
 
+// InitReviewIndex indexes reviews by item, for computing item ratings and for listing an item's
+// published reviews most helpful or newest first
+func InitReviewIndex(collection *mongo.Collection) error {
+	ctx, cancel := database.DBReqContext(5)
+	defer cancel()
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "item_id", Value: 1}, {Key: "star", Value: 1}},
+		},
+		{
+			Keys: bson.D{{Key: "item_id", Value: 1}, {Key: "status", Value: 1}, {Key: "helpful_count", Value: -1}},
+		},
+		{
+			Keys: bson.D{{Key: "item_id", Value: 1}, {Key: "status", Value: 1}, {Key: "updated_at", Value: -1}},
+		},
+	})
+	if err != nil {
+		return errors.New("Error creating index for review collection:" + err.Error())
+	}
+	return nil
+}
+
 func (rr *ReviewRepo) IsExists(filter interface{}, opts ...*options.FindOneOptions) (bool, error) {
 	ctx, cancel := database.DBReqContext(5)
 	defer cancel()
@@ -44,6 +70,19 @@ func (rr *ReviewRepo) UpdateReview(filter interface{}, update interface{}, opts
 	return err
 }
 
+// FindOneAndUpdateReview applies update to the first matching review and returns it.
+// It returns mongo.ErrNoDocuments when nothing matched, which makes it usable for guarded updates.
+func (rr *ReviewRepo) FindOneAndUpdateReview(filter interface{}, update interface{}, opts ...*options.FindOneAndUpdateOptions) (*Review, error) {
+	ctx, cancel := database.DBReqContext(5)
+	defer cancel()
+	review := &Review{}
+	err := rr.Collection.FindOneAndUpdate(ctx, filter, update, opts...).Decode(review)
+	if err != nil {
+		return nil, err
+	}
+	return review, nil
+}
+
 func (rr *ReviewRepo) GetReview(filter interface{}, opts ...*options.FindOneOptions) (*Review, error) {
 	ctx, cancel := database.DBReqContext(5)
 	defer cancel()
@@ -64,3 +103,190 @@ func (rr *ReviewRepo) GetReviews(filter interface{}, opts ...*options.FindOption
 	}
 	return reviews, nil
 }
+
+func (rr *ReviewRepo) CountReviews(filter interface{}) (int64, error) {
+	ctx, cancel := database.DBReqContext(5)
+	defer cancel()
+	return rr.Collection.CountDocuments(ctx, filter)
+}
+
+func (rr *ReviewRepo) Aggregate(pipeline interface{}, result interface{}) error {
+	ctx, cancel := database.DBReqContext(10)
+	defer cancel()
+	cursor, err := rr.Collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return err
+	}
+	return cursor.All(ctx, result)
+}
+
+// The methods below are part of the transaction ctx belongs to
+
+func (rr *ReviewRepo) CreateReviewTx(ctx context.Context, review *Review) error {
+	_, err := rr.Collection.InsertOne(ctx, review)
+	return err
+}
+
+// UpdateReviewTx reports whether a review matched the filter
+func (rr *ReviewRepo) UpdateReviewTx(ctx context.Context, filter interface{}, update interface{}) (bool, error) {
+	result, err := rr.Collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, err
+	}
+	return result.MatchedCount > 0, nil
+}
+
+// DeleteReviewTx reports whether a review matched the filter
+func (rr *ReviewRepo) DeleteReviewTx(ctx context.Context, filter interface{}) (bool, error) {
+	result, err := rr.Collection.DeleteOne(ctx, filter)
+	if err != nil {
+		return false, err
+	}
+	return result.DeletedCount > 0, nil
+}
+
+func (rr *ReviewRepo) AggregateTx(ctx context.Context, pipeline interface{}, result interface{}) error {
+	cursor, err := rr.Collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return err
+	}
+	return cursor.All(ctx, result)
+}
+
+type ReportRepo struct {
+	Collection *mongo.Collection
+}
+
+func NewReportRepo(collection *mongo.Collection) *ReportRepo {
+	return &ReportRepo{
+		Collection: collection,
+	}
+}
+
+// InitReportIndex allows one report of a review per user
+func InitReportIndex(collection *mongo.Collection) error {
+	ctx, cancel := database.DBReqContext(5)
+	defer cancel()
+	_, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "review_id", Value: 1}, {Key: "reporter_id", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return errors.New("Error creating unique index for review report collection:" + err.Error())
+	}
+	return nil
+}
+
+func (rr *ReportRepo) CreateReport(report *Report) error {
+	ctx, cancel := database.DBReqContext(5)
+	defer cancel()
+	_, err := rr.Collection.InsertOne(ctx, report)
+	return err
+}
+
+// CreateReportTx is CreateReport as part of the transaction ctx belongs to
+func (rr *ReportRepo) CreateReportTx(ctx context.Context, report *Report) error {
+	_, err := rr.Collection.InsertOne(ctx, report)
+	return err
+}
+
+// DeleteReportsTx is part of the transaction ctx belongs to
+func (rr *ReportRepo) DeleteReportsTx(ctx context.Context, filter interface{}) error {
+	_, err := rr.Collection.DeleteMany(ctx, filter)
+	return err
+}
+
+func (rr *ReportRepo) GetReports(filter interface{}, opts ...*options.FindOptions) ([]*Report, error) {
+	ctx, cancel := database.DBReqContext(5)
+	defer cancel()
+	reports := []*Report{}
+	cursor, err := rr.Collection.Find(ctx, filter, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if err = cursor.All(ctx, &reports); err != nil {
+		return nil, err
+	}
+	return reports, nil
+}
+
+func (rr *ReportRepo) CountReports(filter interface{}) (int64, error) {
+	ctx, cancel := database.DBReqContext(5)
+	defer cancel()
+	return rr.Collection.CountDocuments(ctx, filter)
+}
+
+type ModerationLogRepo struct {
+	Collection *mongo.Collection
+}
+
+func NewModerationLogRepo(collection *mongo.Collection) *ModerationLogRepo {
+	return &ModerationLogRepo{
+		Collection: collection,
+	}
+}
+
+func (mr *ModerationLogRepo) GetModerationLogs(filter interface{}, opts ...*options.FindOptions) ([]*ModerationLog, error) {
+	ctx, cancel := database.DBReqContext(5)
+	defer cancel()
+	logs := []*ModerationLog{}
+	cursor, err := mr.Collection.Find(ctx, filter, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if err = cursor.All(ctx, &logs); err != nil {
+		return nil, err
+	}
+	return logs, nil
+}
+
+// CreateModerationLogTx is part of the transaction ctx belongs to
+func (mr *ModerationLogRepo) CreateModerationLogTx(ctx context.Context, log *ModerationLog) error {
+	_, err := mr.Collection.InsertOne(ctx, log)
+	return err
+}
+
+type VoteRepo struct {
+	Collection *mongo.Collection
+}
+
+func NewVoteRepo(collection *mongo.Collection) *VoteRepo {
+	return &VoteRepo{
+		Collection: collection,
+	}
+}
+
+// InitVoteIndex allows one vote on a review per user
+func InitVoteIndex(collection *mongo.Collection) error {
+	ctx, cancel := database.DBReqContext(5)
+	defer cancel()
+	_, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "review_id", Value: 1}, {Key: "user_id", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return errors.New("Error creating unique index for review vote collection:" + err.Error())
+	}
+	return nil
+}
+
+// The methods below are part of the transaction ctx belongs to
+
+func (vr *VoteRepo) CreateVoteTx(ctx context.Context, vote *Vote) error {
+	_, err := vr.Collection.InsertOne(ctx, vote)
+	return err
+}
+
+func (vr *VoteRepo) DeleteVotesTx(ctx context.Context, filter interface{}) error {
+	_, err := vr.Collection.DeleteMany(ctx, filter)
+	return err
+}
+
+// UpdateVoteTx reports whether a vote matched the filter
+func (vr *VoteRepo) UpdateVoteTx(ctx context.Context, filter interface{}, update interface{}) (bool, error) {
+	result, err := vr.Collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, err
+	}
+	return result.MatchedCount > 0, nil
+}
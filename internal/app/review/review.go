@@ -3,16 +3,112 @@ package review
 import (
 	"time"
 
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// Review is a customer's review of an item. VerifiedPurchase is set when the author
+// received the item in a delivered order. HoldReason explains why a review is pending.
+// HelpfulCount and UnhelpfulCount are the votes shoppers cast on the review. Photos are the URLs
+// of the author's uploaded photos, and Reply is the item vendor's public reply.
 type Review struct {
+	ID               primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	ItemID           primitive.ObjectID `json:"item_id" bson:"item_id"`
+	AuthorID         primitive.ObjectID `json:"author_id" bson:"author_id"`
+	AuthorName       string             `json:"author_name" bson:"author_name"`
+	Star             int                `json:"star" bson:"star"`
+	Content          string             `json:"content" bson:"content"`
+	Photos           []string           `json:"photos,omitempty" bson:"photos,omitempty"`
+	Reply            *Reply             `json:"reply,omitempty" bson:"reply,omitempty"`
+	UpdatedAt        time.Time          `json:"updated_at" bson:"updated_at"`
+	Anonymous        bool               `json:"anonymous" bson:"anonymous"`
+	VerifiedPurchase bool               `json:"verified_purchase" bson:"verified_purchase"`
+	Status           Status             `json:"status" bson:"status,omitempty"`
+	HoldReason       string             `json:"hold_reason,omitempty" bson:"hold_reason,omitempty"`
+	ReportCount      int                `json:"report_count" bson:"report_count"`
+	HelpfulCount     int                `json:"helpful_count" bson:"helpful_count"`
+	UnhelpfulCount   int                `json:"unhelpful_count" bson:"unhelpful_count"`
+	ModeratedBy      primitive.ObjectID `json:"-" bson:"moderated_by,omitempty"`
+}
+
+// Reply is a vendor's reply to a review of their item. Each review can have one reply.
+type Reply struct {
+	VendorID  primitive.ObjectID `json:"vendor_id" bson:"vendor_id"`
+	Content   string             `json:"content" bson:"content"`
+	CreatedAt time.Time          `json:"created_at" bson:"created_at"`
+}
+
+// Status is where a review is in moderation. Only approved reviews are shown publicly and count
+// towards the item's rating. Reviews saved before moderation existed have none and are approved.
+type Status string
+
+const (
+	Pending  Status = "pending"
+	Approved Status = "approved"
+	Hidden   Status = "hidden"
+)
+
+// unapproved matches the statuses of reviews that are not shown publicly
+var unapproved = bson.M{"$in": []Status{Pending, Hidden}}
+
+// Action is a change to a review's moderation status. Admins approve, hide and delete reviews;
+// reviews are held automatically when posted or reported.
+type Action string
+
+const (
+	ApproveAction Action = "approve"
+	HideAction    Action = "hide"
+	DeleteAction  Action = "delete"
+	HoldAction    Action = "hold"
+)
+
+// ReportReason is why a user reported a review
+type ReportReason string
+
+const (
+	SpamReason      ReportReason = "spam"
+	OffensiveReason ReportReason = "offensive"
+	OffTopicReason  ReportReason = "off_topic"
+	FakeReason      ReportReason = "fake"
+	OtherReason     ReportReason = "other"
+)
+
+type Report struct {
 	ID         primitive.ObjectID `json:"id" bson:"_id,omitempty"`
-	ItemID     primitive.ObjectID `json:"item_id" bson:"item_id"`
-	AuthorID   primitive.ObjectID `json:"author_id" bson:"author_id"`
-	AuthorName string             `json:"author_name" bson:"author_name"`
-	Star       int                `json:"star" bson:"star"`
-	Content    string             `json:"content" bson:"content"`
-	UpdatedAt  time.Time          `json:"updated_at" bson:"updated_at"`
-	Anonymous  bool               `json:"anonymous" bson:"anonymous"`
+	ReviewID   primitive.ObjectID `json:"review_id" bson:"review_id"`
+	ReporterID primitive.ObjectID `json:"reporter_id" bson:"reporter_id"`
+	Reason     ReportReason       `json:"reason" bson:"reason"`
+	Details    string             `json:"details,omitempty" bson:"details,omitempty"`
+	CreatedAt  time.Time          `json:"created_at" bson:"created_at"`
+}
+
+// Vote is a user's vote on whether a review was helpful. Users have one vote per review.
+type Vote struct {
+	ID        primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	ReviewID  primitive.ObjectID `json:"review_id" bson:"review_id"`
+	UserID    primitive.ObjectID `json:"user_id" bson:"user_id"`
+	Helpful   bool               `json:"helpful" bson:"helpful"`
+	CreatedAt time.Time          `json:"created_at" bson:"created_at"`
+}
+
+// ModerationLog is the audit trail of a review's moderation. ModeratorID is empty for automatic holds.
+type ModerationLog struct {
+	ID          primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	ReviewID    primitive.ObjectID `json:"review_id" bson:"review_id"`
+	ItemID      primitive.ObjectID `json:"item_id" bson:"item_id"`
+	Action      Action             `json:"action" bson:"action"`
+	FromStatus  Status             `json:"from_status,omitempty" bson:"from_status,omitempty"`
+	ToStatus    Status             `json:"to_status,omitempty" bson:"to_status,omitempty"`
+	ModeratorID primitive.ObjectID `json:"moderator_id,omitempty" bson:"moderator_id,omitempty"`
+	Note        string             `json:"note,omitempty" bson:"note,omitempty"`
+	CreatedAt   time.Time          `json:"created_at" bson:"created_at"`
+}
+
+// ModerationRules hold reviews for moderation instead of publishing them: reviews using a banned
+// word or phrase, reviews by accounts younger than MinAccountAgeDays, and approved reviews
+// reported ReportThreshold times. A zero value turns its rule off.
+type ModerationRules struct {
+	BannedWords       []string
+	MinAccountAgeDays int
+	ReportThreshold   int
 }
@@ -1,11 +1,17 @@
 package review
 
 import (
+	"context"
 	"log"
+	"mime/multipart"
+	"sync/atomic"
 	"time"
 
+	"github.com/ayo-ajayi/ecommerce/internal/app/item"
+	"github.com/ayo-ajayi/ecommerce/internal/app/order"
 	"github.com/ayo-ajayi/ecommerce/internal/app/user"
 	"github.com/ayo-ajayi/ecommerce/internal/errors"
+	"github.com/ayo-ajayi/ecommerce/internal/utils"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -15,63 +21,307 @@ import (
 type ReviewSevice struct {
 	reviewRepository ReviewRepository
 	userRepository   UserRepository
+	itemRepository   ItemRepository
+	orderRepository  OrderRepository
+	reportRepository ReportRepository
+	moderationLogs   ModerationLogRepository
+	voteRepository   VoteRepository
+	uploader         Uploader
+	emailRepository  EmailRepository
+	transactor       Transactor
+	rules            *ModerationRules
+	recomputing      atomic.Bool
 }
 type UserRepository interface {
 	GetUser(filter interface{}) (*user.User, error)
 }
 
+type ItemRepository interface {
+	GetItem(filter interface{}, opts ...*options.FindOneOptions) (*item.Item, error)
+	GetItems(filter interface{}, opts ...*options.FindOptions) ([]*item.Item, error)
+	UpdateItemTx(ctx context.Context, filter interface{}, update interface{}) error
+}
+
+type OrderRepository interface {
+	IsExists(filter interface{}, opts ...*options.FindOneOptions) (bool, error)
+}
+
+type ReportRepository interface {
+	CreateReportTx(ctx context.Context, report *Report) error
+	DeleteReportsTx(ctx context.Context, filter interface{}) error
+	GetReports(filter interface{}, opts ...*options.FindOptions) ([]*Report, error)
+	CountReports(filter interface{}) (int64, error)
+}
+
+type ModerationLogRepository interface {
+	GetModerationLogs(filter interface{}, opts ...*options.FindOptions) ([]*ModerationLog, error)
+	CreateModerationLogTx(ctx context.Context, log *ModerationLog) error
+}
+
+type VoteRepository interface {
+	CreateVoteTx(ctx context.Context, vote *Vote) error
+	UpdateVoteTx(ctx context.Context, filter interface{}, update interface{}) (bool, error)
+	DeleteVotesTx(ctx context.Context, filter interface{}) error
+}
+
+type Uploader interface {
+	UploadImage(ctx context.Context, files []*multipart.FileHeader, collection string) ([]string, *errors.AppError)
+	DeleteImageBySecureURL(ctx context.Context, secureUrl string) *errors.AppError
+}
+
+type EmailRepository interface {
+	SendReviewReplyEmail(email, firstname, itemName, reply string) error
+}
+
+// Transactor runs fn in a database transaction
+type Transactor interface {
+	WithTransaction(fn func(ctx context.Context) error) error
+}
+
 type ReviewRepository interface {
 	CreateReview(review *Review) error
 	UpdateReview(filter interface{}, update interface{}, opts ...*options.UpdateOptions) error
 	GetReview(filter interface{}, opts ...*options.FindOneOptions) (*Review, error)
+	FindOneAndUpdateReview(filter interface{}, update interface{}, opts ...*options.FindOneAndUpdateOptions) (*Review, error)
 	GetReviews(filter interface{}, opts ...*options.FindOptions) ([]*Review, error)
 	IsExists(filter interface{}, opts ...*options.FindOneOptions) (bool, error)
+	Aggregate(pipeline interface{}, result interface{}) error
+	CreateReviewTx(ctx context.Context, review *Review) error
+	UpdateReviewTx(ctx context.Context, filter interface{}, update interface{}) (bool, error)
+	CountReviews(filter interface{}) (int64, error)
+	DeleteReviewTx(ctx context.Context, filter interface{}) (bool, error)
+	AggregateTx(ctx context.Context, pipeline interface{}, result interface{}) error
 }
 
-func NewReviewService(reviewRepository ReviewRepository, userRepository UserRepository) *ReviewSevice {
+func NewReviewService(reviewRepository ReviewRepository, userRepository UserRepository, itemRepository ItemRepository, orderRepository OrderRepository, reportRepository ReportRepository, moderationLogs ModerationLogRepository, voteRepository VoteRepository, uploader Uploader, emailRepository EmailRepository, transactor Transactor, rules *ModerationRules) *ReviewSevice {
 	return &ReviewSevice{
 		reviewRepository: reviewRepository,
 		userRepository:   userRepository,
+		itemRepository:   itemRepository,
+		orderRepository:  orderRepository,
+		reportRepository: reportRepository,
+		moderationLogs:   moderationLogs,
+		voteRepository:   voteRepository,
+		uploader:         uploader,
+		emailRepository:  emailRepository,
+		transactor:       transactor,
+		rules:            rules,
 	}
 }
 
-func (rs *ReviewSevice) PostReview(review *Review) *errors.AppError {
-	//check if item to create review exists in user's order
-
+// PostReview creates or updates the author's review of an item. Only customers who received the
+// item, on its own or in a bundle, can review it, and vendors cannot review their own items.
+// New reviews that pass the moderation rules are approved and the rest are held as pending. An
+// updated review is held if it no longer passes the rules, and a pending or hidden review stays
+// that way until an admin acts on it.
+// Photos replace the review's photos; updating a review without photos keeps its photos.
+func (rs *ReviewSevice) PostReview(ctx context.Context, review *Review, photos []*multipart.FileHeader) *errors.AppError {
 	review.UpdatedAt = time.Now()
 	if review.Star < 1 || review.Star > 5 {
 		return errors.NewError("invalid star", 400)
 	}
+	if err := utils.CheckImages(photos); err != nil {
+		return err
+	}
+	if err := rs.checkPurchase(review.ItemID, review.AuthorID); err != nil {
+		return err
+	}
+	review.VerifiedPurchase = true
 
-	if !review.Anonymous {
-		user, err := rs.userRepository.GetUser(bson.M{"_id": review.AuthorID})
-		if err != nil {
-			return errors.ErrInternalServer
-		}
-		if user != nil {
-			review.AuthorName = user.FirstName + " " + user.LastName
+	author, err := rs.userRepository.GetUser(bson.M{"_id": review.AuthorID})
+	if err != nil {
+		return errors.ErrInternalServer
+	}
+	if !review.Anonymous && author != nil {
+		review.AuthorName = author.FirstName + " " + author.LastName
+	}
+	review.Status = Approved
+	if reason := rs.holdReason(review, author); reason != "" {
+		review.Status, review.HoldReason = Pending, reason
+	}
+
+	review.Photos = nil
+	if len(photos) > 0 {
+		urls, appErr := rs.uploader.UploadImage(ctx, photos, "reviews")
+		if appErr != nil {
+			return errors.NewError("failed to upload photos: "+appErr.Error(), appErr.StatusCode)
 		}
+		review.Photos = urls
 	}
+	uploaded := review.Photos
+	if appErr := rs.saveReview(review); appErr != nil {
+		rs.deletePhotos(uploaded)
+		return appErr
+	}
+	return nil
+}
 
+// saveReview creates or updates the author's review of the item, with its moderation log entry and the item's rating
+func (rs *ReviewSevice) saveReview(review *Review) *errors.AppError {
 	revExists, err := rs.reviewRepository.IsExists(bson.M{"author_id": review.AuthorID, "item_id": review.ItemID})
 	if err != nil {
 		return errors.ErrInternalServer
 	}
+	var fromStatus Status
+	var oldPhotos []string
+	// save reports false when the review was moderated after its status was worked out
+	var save func(ctx context.Context) (bool, error)
 	if revExists {
 		log.Println("review exists")
 		rev, err := rs.reviewRepository.GetReview(bson.M{"author_id": review.AuthorID, "item_id": review.ItemID})
 		if err != nil {
 			return errors.ErrInternalServer
 		}
-		if err := rs.reviewRepository.UpdateReview(bson.M{"_id": rev.ID}, bson.M{"$set": review}); err != nil {
-			return errors.ErrInternalServer
+		fromStatus = rev.Status
+		switch {
+		case rev.Status == Hidden:
+			review.Status, review.HoldReason = Hidden, ""
+		case rev.Status == Pending && review.Status != Pending:
+			review.Status, review.HoldReason = Pending, rev.HoldReason
+		}
+		review.ID = rev.ID
+		if review.Photos == nil {
+			review.Photos = rev.Photos
+		} else {
+			oldPhotos = rev.Photos
+		}
+		var status interface{} = rev.Status
+		if rev.Status == "" {
+			// saved before moderation, when every review was published
+			status = bson.M{"$in": bson.A{"", nil}}
+		}
+		save = func(ctx context.Context) (bool, error) {
+			return rs.reviewRepository.UpdateReviewTx(ctx, bson.M{"_id": rev.ID, "status": status}, bson.M{"$set": bson.M{
+				"author_name":       review.AuthorName,
+				"star":              review.Star,
+				"content":           review.Content,
+				"photos":            review.Photos,
+				"updated_at":        review.UpdatedAt,
+				"anonymous":         review.Anonymous,
+				"verified_purchase": review.VerifiedPurchase,
+				"status":            review.Status,
+				"hold_reason":       review.HoldReason,
+			}})
+		}
+	} else {
+		log.Println("review does not exist")
+		review.ID = primitive.NewObjectID()
+		save = func(ctx context.Context) (bool, error) {
+			return true, rs.reviewRepository.CreateReviewTx(ctx, review)
+		}
+	}
+	saved := false
+	err = rs.transactor.WithTransaction(func(ctx context.Context) error {
+		var err error
+		saved, err = save(ctx)
+		if err != nil || !saved {
+			return err
+		}
+		if review.Status == Pending && fromStatus != Pending {
+			if err := rs.logModeration(ctx, review, HoldAction, fromStatus, Pending, primitive.NilObjectID, review.HoldReason); err != nil {
+				return err
+			}
+		}
+		return rs.updateRating(ctx, review.ItemID)
+	})
+	if err != nil {
+		return errors.ErrInternalServer
+	}
+	if !saved {
+		return errors.NewError("the review was moderated while it was being updated, try again", 409)
+	}
+	rs.deletePhotos(oldPhotos)
+	return nil
+}
+
+// DeleteReview deletes the author's review, with its votes and reports, and updates the item's rating with it
+func (rs *ReviewSevice) DeleteReview(reviewId string, authorId primitive.ObjectID) *errors.AppError {
+	reviewID, err := primitive.ObjectIDFromHex(reviewId)
+	if err != nil {
+		return errors.ErrInvalidObjectID
+	}
+	review, err := rs.reviewRepository.GetReview(bson.M{"_id": reviewID, "author_id": authorId})
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			err := errors.ErrNotFound
+			return errors.NewError("review not found: "+err.Error(), err.StatusCode)
 		}
-		return nil
+		return errors.ErrInternalServer
 	}
-	log.Println("review does not exist")
-	if err := rs.reviewRepository.CreateReview(review); err != nil {
+	deleted := false
+	err = rs.transactor.WithTransaction(func(ctx context.Context) error {
+		deleted, err = rs.deleteReviewTx(ctx, bson.M{"_id": review.ID, "author_id": authorId}, review.ID)
+		if err != nil || !deleted {
+			return err
+		}
+		return rs.updateRating(ctx, review.ItemID)
+	})
+	if err != nil {
 		return errors.ErrInternalServer
 	}
+	if !deleted {
+		err := errors.ErrNotFound
+		return errors.NewError("review not found: "+err.Error(), err.StatusCode)
+	}
+	rs.deletePhotos(review.Photos)
+	return nil
+}
+
+// deleteReviewTx deletes the review matching the filter together with its votes and reports,
+// and reports whether it matched
+func (rs *ReviewSevice) deleteReviewTx(ctx context.Context, filter interface{}, reviewID primitive.ObjectID) (bool, error) {
+	deleted, err := rs.reviewRepository.DeleteReviewTx(ctx, filter)
+	if err != nil || !deleted {
+		return deleted, err
+	}
+	if err := rs.voteRepository.DeleteVotesTx(ctx, bson.M{"review_id": reviewID}); err != nil {
+		return false, err
+	}
+	if err := rs.reportRepository.DeleteReportsTx(ctx, bson.M{"review_id": reviewID}); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// deletePhotos removes photos that no review uses anymore from the media cloud
+func (rs *ReviewSevice) deletePhotos(photos []string) {
+	for _, v := range photos {
+		if err := rs.uploader.DeleteImageBySecureURL(context.Background(), v); err != nil {
+			log.Println("failed to delete review photo " + v + ": " + err.Error())
+		}
+	}
+}
+
+// checkPurchase explains why the author cannot review the item, if they cannot
+func (rs *ReviewSevice) checkPurchase(itemID, authorID primitive.ObjectID) *errors.AppError {
+	it, err := rs.itemRepository.GetItem(bson.M{"_id": itemID})
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			err := errors.ErrNotFound
+			return errors.NewError("item not found: "+err.Error(), err.StatusCode)
+		}
+		return errors.ErrInternalServer
+	}
+	if it.VendorID == authorID {
+		err := errors.ErrForbidden
+		return errors.NewError(err.Error()+": vendors cannot review their own items", err.StatusCode)
+	}
+	received, err := rs.orderRepository.IsExists(bson.M{
+		"user_id":        authorID,
+		"order_status":   order.OrderStatusDelivered,
+		"payment_status": bson.M{"$ne": order.PaymentStatusRefunded},
+		"$or": []bson.M{
+			{"order_items.item_id": itemID},
+			{"order_items.components.item_id": itemID},
+		},
+	})
+	if err != nil {
+		return errors.ErrInternalServer
+	}
+	if !received {
+		err := errors.ErrForbidden
+		return errors.NewError(err.Error()+": only customers who have received this item in a delivered order can review it", err.StatusCode)
+	}
 	return nil
 }
 
@@ -80,7 +330,7 @@ func (rs *ReviewSevice) GetReview(reviewId string) (*Review, *errors.AppError) {
 	if err != nil {
 		return nil, errors.ErrInvalidObjectID
 	}
-	review, err := rs.reviewRepository.GetReview(bson.M{"_id": review_id})
+	review, err := rs.reviewRepository.GetReview(bson.M{"_id": review_id, "status": bson.M{"$not": unapproved}})
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
 			return nil, errors.ErrNotFound
@@ -90,14 +340,24 @@ func (rs *ReviewSevice) GetReview(reviewId string) (*Review, *errors.AppError) {
 	return review, nil
 }
 
-func (rs *ReviewSevice) GetReviews(itemId string) ([]*Review, *errors.AppError) {
+// GetReviews returns a page of an item's published reviews and counts them into the query's pagination
+func (rs *ReviewSevice) GetReviews(itemId string, query *ReviewQuery) ([]*Review, *errors.AppError) {
 	itemid, err := primitive.ObjectIDFromHex(itemId)
 	if err != nil {
 		return nil, errors.NewError(errors.ErrInvalidObjectID.Error()+err.Error(), 400)
 	}
-	reviews, err := rs.reviewRepository.GetReviews(bson.M{"item_id": itemid})
+	filter := query.Filter(bson.M{"item_id": itemid, "status": bson.M{"$not": unapproved}})
+	total, err := rs.reviewRepository.CountReviews(filter)
 	if err != nil {
 		return nil, errors.ErrInternalServer
 	}
+	query.Pagination.Total = total
+	reviews, err := rs.reviewRepository.GetReviews(filter, query.FindOptions())
+	if err != nil {
+		return nil, errors.ErrInternalServer
+	}
+	if reviews == nil {
+		reviews = []*Review{}
+	}
 	return reviews, nil
 }
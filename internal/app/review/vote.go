@@ -0,0 +1,64 @@
+package review
+
+import (
+	"context"
+	"time"
+
+	"github.com/ayo-ajayi/ecommerce/internal/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// VoteReview records whether a user found a published review helpful. Users have one vote per
+// review and can change it, which moves their vote between the review's counts.
+func (rs *ReviewSevice) VoteReview(reviewId string, userId primitive.ObjectID, helpful bool) *errors.AppError {
+	reviewID, err := primitive.ObjectIDFromHex(reviewId)
+	if err != nil {
+		return errors.ErrInvalidObjectID
+	}
+	review, err := rs.reviewRepository.GetReview(bson.M{"_id": reviewID, "status": bson.M{"$not": unapproved}})
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			err := errors.ErrNotFound
+			return errors.NewError("review not found: "+err.Error(), err.StatusCode)
+		}
+		return errors.ErrInternalServer
+	}
+	if review.AuthorID == userId {
+		return errors.NewError("you cannot vote on your own review", 400)
+	}
+
+	count, other := "helpful_count", "unhelpful_count"
+	if !helpful {
+		count, other = other, count
+	}
+	alreadyVoted := false
+	err = rs.transactor.WithTransaction(func(ctx context.Context) error {
+		changed, err := rs.voteRepository.UpdateVoteTx(ctx, bson.M{"review_id": reviewID, "user_id": userId, "helpful": !helpful}, bson.M{"$set": bson.M{"helpful": helpful}})
+		if err != nil {
+			return err
+		}
+		inc := bson.M{count: 1}
+		if changed {
+			inc[other] = -1
+		} else {
+			err := rs.voteRepository.CreateVoteTx(ctx, &Vote{ReviewID: reviewID, UserID: userId, Helpful: helpful, CreatedAt: time.Now()})
+			if mongo.IsDuplicateKeyError(err) {
+				alreadyVoted = true
+			}
+			if err != nil {
+				return err
+			}
+		}
+		_, err = rs.reviewRepository.UpdateReviewTx(ctx, bson.M{"_id": reviewID}, bson.M{"$inc": inc})
+		return err
+	})
+	if alreadyVoted {
+		return errors.NewError("you have already voted on this review", 409)
+	}
+	if err != nil {
+		return errors.ErrInternalServer
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package sale
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/ayo-ajayi/ecommerce/internal/errors"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type SaleController struct {
+	saleServices SaleServices
+}
+
+type SaleServices interface {
+	CreateSale(sale *Sale) *errors.AppError
+	UpdateSale(sale *Sale) *errors.AppError
+	DeleteSale(id string) *errors.AppError
+	GetSale(id string) (*Sale, *errors.AppError)
+	GetSales(activeOnly bool) ([]*Sale, *errors.AppError)
+}
+
+func NewSaleController(saleServices SaleServices) *SaleController {
+	return &SaleController{
+		saleServices: saleServices,
+	}
+}
+
+type saleRequest struct {
+	Name            string               `json:"name" binding:"required"`
+	ItemID          []primitive.ObjectID `json:"item_id"`
+	CategoryID      []primitive.ObjectID `json:"category_id"`
+	VendorID        []primitive.ObjectID `json:"vendor_id"`
+	DiscountPercent float64              `json:"discount_percent"`
+	SalePrice       float64              `json:"sale_price"`
+	StartsAt        time.Time            `json:"starts_at" binding:"required"`
+	EndsAt          time.Time            `json:"ends_at" binding:"required"`
+}
+
+func (req *saleRequest) toSale() *Sale {
+	return &Sale{
+		Name:            req.Name,
+		ItemID:          req.ItemID,
+		CategoryID:      req.CategoryID,
+		VendorID:        req.VendorID,
+		DiscountPercent: req.DiscountPercent,
+		SalePrice:       req.SalePrice,
+		StartsAt:        req.StartsAt,
+		EndsAt:          req.EndsAt,
+	}
+}
+
+func (sc *SaleController) CreateSale(c *gin.Context) {
+	userid := c.MustGet("userId").(primitive.ObjectID)
+	if userid.IsZero() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": "invalid user"}})
+		return
+	}
+	req := saleRequest{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	sale := req.toSale()
+	sale.CreatedBy = userid
+	sale.UpdatedBy = userid
+	if err := sc.saleServices.CreateSale(sale); err != nil {
+		c.JSON(err.StatusCode, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	c.JSON(201, gin.H{"message": "sale created successfully", "data": gin.H{"sale": sale}})
+}
+
+func (sc *SaleController) UpdateSale(c *gin.Context) {
+	saleID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": "invalid sale id"}})
+		return
+	}
+	userid := c.MustGet("userId").(primitive.ObjectID)
+	if userid.IsZero() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": "invalid user"}})
+		return
+	}
+	req := saleRequest{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	sale := req.toSale()
+	sale.ID = saleID
+	sale.UpdatedBy = userid
+	if err := sc.saleServices.UpdateSale(sale); err != nil {
+		c.JSON(err.StatusCode, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	c.JSON(200, gin.H{"message": "sale updated successfully", "data": gin.H{"sale": sale}})
+}
+
+func (sc *SaleController) DeleteSale(c *gin.Context) {
+	if err := sc.saleServices.DeleteSale(c.Param("id")); err != nil {
+		c.JSON(err.StatusCode, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	c.JSON(200, gin.H{"message": "sale deleted successfully"})
+}
+
+func (sc *SaleController) GetSale(c *gin.Context) {
+	sale, err := sc.saleServices.GetSale(c.Param("id"))
+	if err != nil {
+		c.JSON(err.StatusCode, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	c.JSON(200, gin.H{"data": gin.H{"sale": sale}})
+}
+
+func (sc *SaleController) GetActiveSales(c *gin.Context) {
+	sales, err := sc.saleServices.GetSales(true)
+	if err != nil {
+		c.JSON(err.StatusCode, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	c.JSON(200, gin.H{"data": gin.H{"sales": sales}})
+}
+
+func (sc *SaleController) GetSales(c *gin.Context) {
+	sales, err := sc.saleServices.GetSales(false)
+	if err != nil {
+		c.JSON(err.StatusCode, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	c.JSON(200, gin.H{"data": gin.H{"sales": sales}})
+}
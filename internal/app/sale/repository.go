@@ -0,0 +1,63 @@
+package sale
+
+import (
+	"github.com/ayo-ajayi/ecommerce/internal/database"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type SaleRepo struct {
+	Collection *mongo.Collection
+}
+
+func NewSaleRepo(collection *mongo.Collection) *SaleRepo {
+	return &SaleRepo{
+		Collection: collection,
+	}
+}
+
+func (sr *SaleRepo) CreateSale(sale *Sale) error {
+	ctx, cancel := database.DBReqContext(5)
+	defer cancel()
+	_, err := sr.Collection.InsertOne(ctx, sale)
+	return err
+}
+
+func (sr *SaleRepo) UpdateSale(filter interface{}, update interface{}, opts ...*options.UpdateOptions) error {
+	ctx, cancel := database.DBReqContext(5)
+	defer cancel()
+	_, err := sr.Collection.UpdateOne(ctx, filter, update, opts...)
+	return err
+}
+
+func (sr *SaleRepo) GetSale(filter interface{}, opts ...*options.FindOneOptions) (*Sale, error) {
+	ctx, cancel := database.DBReqContext(5)
+	defer cancel()
+	var sale Sale
+	err := sr.Collection.FindOne(ctx, filter, opts...).Decode(&sale)
+	if err != nil {
+		return nil, err
+	}
+	return &sale, nil
+}
+
+func (sr *SaleRepo) GetSales(filter interface{}, opts ...*options.FindOptions) ([]*Sale, error) {
+	ctx, cancel := database.DBReqContext(5)
+	defer cancel()
+	var sales []*Sale
+	cursor, err := sr.Collection.Find(ctx, filter, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if err := cursor.All(ctx, &sales); err != nil {
+		return nil, err
+	}
+	return sales, nil
+}
+
+func (sr *SaleRepo) DeleteSale(filter interface{}, opts ...*options.DeleteOptions) error {
+	ctx, cancel := database.DBReqContext(5)
+	defer cancel()
+	_, err := sr.Collection.DeleteOne(ctx, filter, opts...)
+	return err
+}
@@ -0,0 +1,37 @@
+package sale
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Sale is a time-boxed price change. It applies to every item matched by
+// ItemID, CategoryID or VendorID between StartsAt and EndsAt.
+type Sale struct {
+	ID              primitive.ObjectID   `json:"id" bson:"_id,omitempty"`
+	Name            string               `json:"name" bson:"name"`
+	ItemID          []primitive.ObjectID `json:"item_id" bson:"item_id,omitempty"`
+	CategoryID      []primitive.ObjectID `json:"category_id" bson:"category_id,omitempty"`
+	VendorID        []primitive.ObjectID `json:"vendor_id" bson:"vendor_id,omitempty"`
+	DiscountPercent float64              `json:"discount_percent" bson:"discount_percent,omitempty"`
+	SalePrice       float64              `json:"sale_price" bson:"sale_price,omitempty"`
+	StartsAt        time.Time            `json:"starts_at" bson:"starts_at"`
+	EndsAt          time.Time            `json:"ends_at" bson:"ends_at"`
+	CreatedBy       primitive.ObjectID   `json:"created_by" bson:"created_by,omitempty"`
+	UpdatedBy       primitive.ObjectID   `json:"updated_by" bson:"updated_by,omitempty"`
+	CreatedAt       time.Time            `json:"created_at" bson:"created_at"`
+	UpdatedAt       time.Time            `json:"updated_at" bson:"updated_at"`
+}
+
+func (s *Sale) IsActive(at time.Time) bool {
+	return !at.Before(s.StartsAt) && at.Before(s.EndsAt)
+}
+
+// PriceFor returns the price of an item with the given list price during the sale
+func (s *Sale) PriceFor(price float64) float64 {
+	if s.SalePrice > 0 {
+		return s.SalePrice
+	}
+	return price - price*s.DiscountPercent/100
+}
@@ -0,0 +1,198 @@
+package sale
+
+import (
+	"time"
+
+	"github.com/ayo-ajayi/ecommerce/internal/app/item"
+	"github.com/ayo-ajayi/ecommerce/internal/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type SaleService struct {
+	saleRepo SaleRepository
+}
+
+type SaleRepository interface {
+	CreateSale(sale *Sale) error
+	UpdateSale(filter interface{}, update interface{}, opts ...*options.UpdateOptions) error
+	GetSale(filter interface{}, opts ...*options.FindOneOptions) (*Sale, error)
+	GetSales(filter interface{}, opts ...*options.FindOptions) ([]*Sale, error)
+	DeleteSale(filter interface{}, opts ...*options.DeleteOptions) error
+}
+
+func NewSaleService(saleRepo SaleRepository) *SaleService {
+	return &SaleService{
+		saleRepo: saleRepo,
+	}
+}
+
+func (ss *SaleService) CreateSale(sale *Sale) *errors.AppError {
+	if err := validateSale(sale); err != nil {
+		return err
+	}
+	sale.CreatedAt = time.Now()
+	sale.UpdatedAt = time.Now()
+	if err := ss.saleRepo.CreateSale(sale); err != nil {
+		return errors.NewError("internal error: "+err.Error(), 500)
+	}
+	return nil
+}
+
+func (ss *SaleService) UpdateSale(sale *Sale) *errors.AppError {
+	oldSale, err := ss.saleRepo.GetSale(bson.M{"_id": sale.ID})
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			err := errors.ErrNotFound
+			return errors.NewError("sale not found: "+err.Error(), err.StatusCode)
+		}
+		return errors.ErrInternalServer
+	}
+	if err := validateSale(sale); err != nil {
+		return err
+	}
+	sale.CreatedBy = oldSale.CreatedBy
+	sale.CreatedAt = oldSale.CreatedAt
+	sale.UpdatedAt = time.Now()
+	if err := ss.saleRepo.UpdateSale(bson.M{"_id": sale.ID}, bson.M{"$set": sale}); err != nil {
+		return errors.NewError("internal error: "+err.Error(), 500)
+	}
+	return nil
+}
+
+func (ss *SaleService) DeleteSale(id string) *errors.AppError {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return errors.ErrInvalidObjectID
+	}
+	if _, err := ss.saleRepo.GetSale(bson.M{"_id": objectID}); err != nil {
+		if err == mongo.ErrNoDocuments {
+			err := errors.ErrNotFound
+			return errors.NewError("sale not found: "+err.Error(), err.StatusCode)
+		}
+		return errors.ErrInternalServer
+	}
+	if err := ss.saleRepo.DeleteSale(bson.M{"_id": objectID}); err != nil {
+		return errors.NewError("internal error: "+err.Error(), 500)
+	}
+	return nil
+}
+
+func (ss *SaleService) GetSale(id string) (*Sale, *errors.AppError) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, errors.ErrInvalidObjectID
+	}
+	sale, err := ss.saleRepo.GetSale(bson.M{"_id": objectID})
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			err := errors.ErrNotFound
+			return nil, errors.NewError("sale not found: "+err.Error(), err.StatusCode)
+		}
+		return nil, errors.ErrInternalServer
+	}
+	return sale, nil
+}
+
+// GetSales returns every sale, or only the ones running right now when activeOnly is set
+func (ss *SaleService) GetSales(activeOnly bool) ([]*Sale, *errors.AppError) {
+	filter := bson.M{}
+	if activeOnly {
+		now := time.Now()
+		filter = bson.M{"starts_at": bson.M{"$lte": now}, "ends_at": bson.M{"$gt": now}}
+	}
+	sales, err := ss.saleRepo.GetSales(filter, options.Find().SetSort(bson.D{{Key: "starts_at", Value: -1}}))
+	if err != nil {
+		return nil, errors.ErrInternalServer
+	}
+	return sales, nil
+}
+
+// ResolvePrices sets the effective price of each item from its permanent discount
+// and any sale running at the time of the call. Expired sales simply stop matching.
+func (ss *SaleService) ResolvePrices(items ...*item.Item) *errors.AppError {
+	if len(items) == 0 {
+		return nil
+	}
+	var itemIDs, categoryIDs, vendorIDs []primitive.ObjectID
+	for _, v := range items {
+		v.EffectivePrice = v.BasePrice()
+		v.SaleEndsAt = nil
+		itemIDs = append(itemIDs, v.ID)
+		categoryIDs = append(categoryIDs, v.CategoryID...)
+		if !v.VendorID.IsZero() {
+			vendorIDs = append(vendorIDs, v.VendorID)
+		}
+	}
+	now := time.Now()
+	scope := []bson.M{{"item_id": bson.M{"$in": itemIDs}}}
+	if len(categoryIDs) > 0 {
+		scope = append(scope, bson.M{"category_id": bson.M{"$in": categoryIDs}})
+	}
+	if len(vendorIDs) > 0 {
+		scope = append(scope, bson.M{"vendor_id": bson.M{"$in": vendorIDs}})
+	}
+	sales, err := ss.saleRepo.GetSales(bson.M{
+		"starts_at": bson.M{"$lte": now},
+		"ends_at":   bson.M{"$gt": now},
+		"$or":       scope,
+	})
+	if err != nil {
+		return errors.NewError("failed to resolve prices: "+err.Error(), 500)
+	}
+	for _, v := range items {
+		for _, s := range sales {
+			if !s.appliesTo(v) {
+				continue
+			}
+			if price := s.PriceFor(v.Price); price < v.EffectivePrice {
+				endsAt := s.EndsAt
+				v.EffectivePrice = price
+				v.SaleEndsAt = &endsAt
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Sale) appliesTo(it *item.Item) bool {
+	if containsID(s.ItemID, it.ID) || containsID(s.VendorID, it.VendorID) {
+		return true
+	}
+	for _, v := range it.CategoryID {
+		if containsID(s.CategoryID, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsID(ids []primitive.ObjectID, id primitive.ObjectID) bool {
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
+
+func validateSale(sale *Sale) *errors.AppError {
+	if sale.Name == "" {
+		return errors.NewError("invalid name", 400)
+	}
+	if len(sale.ItemID) == 0 && len(sale.CategoryID) == 0 && len(sale.VendorID) == 0 {
+		return errors.NewError("sale must target at least one item, category or vendor", 400)
+	}
+	if (sale.DiscountPercent > 0) == (sale.SalePrice > 0) {
+		return errors.NewError("sale must have either a discount percent or a sale price", 400)
+	}
+	if sale.DiscountPercent < 0 || sale.DiscountPercent > 100 || sale.SalePrice < 0 {
+		return errors.NewError("invalid discount", 400)
+	}
+	if sale.StartsAt.IsZero() || !sale.EndsAt.After(sale.StartsAt) {
+		return errors.NewError("sale must end after it starts", 400)
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package search
+
+import (
+	"log"
+
+	"github.com/ayo-ajayi/ecommerce/internal/app/category"
+	"github.com/ayo-ajayi/ecommerce/internal/app/item"
+	"github.com/ayo-ajayi/ecommerce/internal/types"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// SearchEngine finds the items and categories matching a search and counts the facets of the
+// matching items. Engines that keep their own index are kept current through IndexHook.
+type SearchEngine interface {
+	IndexItem(it *item.Item) error
+	IndexCategory(c *category.Category) error
+	DeleteItem(id primitive.ObjectID) error
+	DeleteCategory(id primitive.ObjectID) error
+	Query(q *Query) (*Result, error)
+	Facets(q *Query) (*Facets, error)
+}
+
+// Query is a search for any of the words in Terms, narrowed by item listing filters and facets
+type Query struct {
+	Terms      string
+	Filter     bson.M
+	Facets     *FacetFilters
+	Pagination *types.Pagination
+}
+
+// Result is a page of matching items, ranked by relevance, and the best matching categories.
+// Approximate tells that the engine only filtered its best ranked items, so Total and the
+// facets may count fewer items than match.
+type Result struct {
+	Items       []*item.Item
+	Total       int64
+	Categories  []*category.Category
+	Approximate bool
+}
+
+// withMatch copies the listing filter with the engine's match added
+func withMatch(filter bson.M, key string, value interface{}) bson.M {
+	match := bson.M{key: value}
+	for k, v := range filter {
+		match[k] = v
+	}
+	return match
+}
+
+// IndexHook keeps a search engine's index current with item and category changes.
+// Only published items are indexed.
+type IndexHook struct {
+	engine SearchEngine
+}
+
+func NewIndexHook(engine SearchEngine) *IndexHook {
+	return &IndexHook{engine: engine}
+}
+
+func (ih *IndexHook) ItemChanged(old, it *item.Item) {
+	var err error
+	switch {
+	case it != nil && it.IsPublished():
+		err = ih.engine.IndexItem(it)
+	case it != nil:
+		err = ih.engine.DeleteItem(it.ID)
+	case old != nil:
+		err = ih.engine.DeleteItem(old.ID)
+	}
+	if err != nil {
+		log.Println("failed to update search index: " + err.Error())
+	}
+}
+
+func (ih *IndexHook) CategoryChanged(old, c *category.Category) {
+	var err error
+	switch {
+	case c != nil:
+		err = ih.engine.IndexCategory(c)
+	case old != nil:
+		err = ih.engine.DeleteCategory(old.ID)
+	}
+	if err != nil {
+		log.Println("failed to update search index: " + err.Error())
+	}
+}
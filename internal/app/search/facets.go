@@ -0,0 +1,415 @@
+package search
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/ayo-ajayi/ecommerce/internal/app/item"
+	"github.com/ayo-ajayi/ecommerce/internal/constants"
+	"github.com/ayo-ajayi/ecommerce/internal/errors"
+	"github.com/ayo-ajayi/ecommerce/internal/types"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// the collection joined to compute bundle stock
+const itemCollection = "items"
+
+// priceBoundaries are the lower bounds of the price facet's buckets. The last bucket is open ended.
+var priceBoundaries = []float64{0, 25, 50, 100, 250, 500, 1000}
+
+// ratingThresholds and discountThresholds are the "or more" options of the rating and discount facets
+var ratingThresholds = []float64{4, 3, 2, 1}
+var discountThresholds = []float64{50, 25, 10}
+
+// FacetFilters are the facets applied to a search. Prices are after the item's permanent
+// discount. The category and rating facets are applied by the item query, like in item listings.
+type FacetFilters struct {
+	MinPrice    float64
+	MaxPrice    float64
+	VendorID    []primitive.ObjectID
+	MinDiscount float64
+	InStock     bool
+}
+
+type Facets struct {
+	Price    []RangeCount     `json:"price"`
+	Category []FacetCount     `json:"category"`
+	Vendor   []FacetCount     `json:"vendor"`
+	Rating   []ThresholdCount `json:"rating"`
+	Discount []ThresholdCount `json:"discount"`
+	InStock  int64            `json:"in_stock"`
+}
+
+// RangeCount counts the results priced from Min up to, but not including, Max. The last range has no Max.
+type RangeCount struct {
+	Min   float64  `json:"min"`
+	Max   *float64 `json:"max,omitempty"`
+	Count int64    `json:"count"`
+}
+
+type FacetCount struct {
+	ID    primitive.ObjectID `json:"id"`
+	Name  string             `json:"name"`
+	Count int64              `json:"count"`
+}
+
+// ThresholdCount counts the results rated or discounted at least Min
+type ThresholdCount struct {
+	Min   float64 `json:"min"`
+	Count int64   `json:"count"`
+}
+
+// hitsResult is the output of the hits stage
+type hitsResult struct {
+	Hits  []*item.Item `bson:"hits"`
+	Total []struct {
+		Count int64 `bson:"count"`
+	} `bson:"total"`
+}
+
+// facetResult is the output of the facet stage
+type facetResult struct {
+	Price []struct {
+		Min   float64 `bson:"_id"`
+		Count int64   `bson:"count"`
+	} `bson:"price"`
+	Category []struct {
+		ID    primitive.ObjectID `bson:"_id"`
+		Count int64              `bson:"count"`
+	} `bson:"category"`
+	Vendor []struct {
+		ID    primitive.ObjectID `bson:"_id"`
+		Count int64              `bson:"count"`
+	} `bson:"vendor"`
+	Rating   []bson.M `bson:"rating"`
+	Discount []bson.M `bson:"discount"`
+	InStock  []bson.M `bson:"in_stock"`
+}
+
+func parseFacetFilters(c *gin.Context) (*FacetFilters, *errors.AppError) {
+	filters := &FacetFilters{}
+	for field, value := range map[string]*float64{
+		"min_price":    &filters.MinPrice,
+		"max_price":    &filters.MaxPrice,
+		"min_discount": &filters.MinDiscount,
+	} {
+		if v := c.Query(field); v != "" {
+			n, err := strconv.ParseFloat(v, 64)
+			if err != nil || n < 0 {
+				return nil, errors.NewError("invalid "+field, 400)
+			}
+			*value = n
+		}
+	}
+	for _, v := range c.QueryArray("vendor_id") {
+		vendorID, err := primitive.ObjectIDFromHex(v)
+		if err != nil {
+			return nil, errors.NewError("invalid vendor id", 400)
+		}
+		filters.VendorID = append(filters.VendorID, vendorID)
+	}
+	if v := c.Query("in_stock"); v != "" {
+		inStock, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, errors.NewError("invalid in_stock", 400)
+		}
+		filters.InStock = inStock
+	}
+	return filters, nil
+}
+
+// facet names, used to leave a facet's own filter out when counting it
+const (
+	priceFacet    = "price"
+	categoryFacet = "category"
+	vendorFacet   = "vendor"
+	ratingFacet   = "rating"
+	discountFacet = "discount"
+	inStockFacet  = "in_stock"
+)
+
+// listingFacets are the item query filters that are facets too, by facet
+var listingFacets = map[string]string{
+	categoryFacet: "category_id",
+	ratingFacet:   "rating.average",
+}
+
+// match filters on the fields computed by facetFields
+func (f *FacetFilters) match() bson.M {
+	return f.matchExcept("")
+}
+
+// matchExcept is match without the filter of the facet
+func (f *FacetFilters) matchExcept(facet string) bson.M {
+	match := bson.M{}
+	price := bson.M{}
+	if f.MinPrice > 0 {
+		price["$gte"] = f.MinPrice
+	}
+	if f.MaxPrice > 0 {
+		price["$lte"] = f.MaxPrice
+	}
+	if len(price) > 0 && facet != priceFacet {
+		match["base_price"] = price
+	}
+	if len(f.VendorID) > 0 && facet != vendorFacet {
+		match["vendor_id"] = bson.M{"$in": f.VendorID}
+	}
+	if f.MinDiscount > 0 && facet != discountFacet {
+		match["discount"] = bson.M{"$gte": f.MinDiscount}
+	}
+	if f.InStock && facet != inStockFacet {
+		match["in_stock"] = true
+	}
+	return match
+}
+
+// facetFields computes the fields the facets group on: the price after the permanent discount,
+// the average rating, zero for unreviewed items, and whether the item can be bought. A bundle
+// is in stock when every component has enough stock for one bundle.
+var facetFields = bson.M{
+	"base_price":     bson.M{"$subtract": bson.A{"$price", bson.M{"$divide": bson.A{bson.M{"$multiply": bson.A{"$price", "$discount"}}, 100}}}},
+	"average_rating": bson.M{"$ifNull": bson.A{"$rating.average", 0}},
+	"in_stock": bson.M{"$switch": bson.M{
+		"branches": bson.A{
+			bson.M{
+				"case": bson.M{"$and": bson.A{bson.M{"$eq": bson.A{"$type", item.Digital}}, bson.M{"$eq": bson.A{"$digital.delivery", item.DownloadDelivery}}}},
+				"then": true,
+			},
+			bson.M{
+				"case": bson.M{"$eq": bson.A{"$type", item.Bundle}},
+				"then": bson.M{"$and": bson.A{
+					bson.M{"$gt": bson.A{bson.M{"$size": bson.M{"$ifNull": bson.A{"$components", bson.A{}}}}, 0}},
+					bson.M{"$allElementsTrue": bson.A{bson.M{"$map": bson.M{
+						"input": bson.M{"$ifNull": bson.A{"$components", bson.A{}}},
+						"as":    "component",
+						"in": bson.M{"$gte": bson.A{
+							bson.M{"$sum": bson.M{"$map": bson.M{
+								"input": bson.M{"$filter": bson.M{"input": "$component_items", "as": "stock", "cond": bson.M{"$eq": bson.A{"$$stock._id", "$$component.item_id"}}}},
+								"as":    "stock",
+								"in":    "$$stock.quantity",
+							}}},
+							"$$component.quantity",
+						}},
+					}}}},
+				}},
+			},
+		},
+		"default": bson.M{"$gt": bson.A{"$quantity", 0}},
+	}},
+}
+
+// matchStages match the search, compute the facet fields and apply the facet filters. Hits are
+// ranked by score, which is left out when nil.
+func matchStages(match bson.M, score interface{}, filters *FacetFilters) bson.A {
+	return append(fieldStages(match, score), bson.M{"$match": filters.match()})
+}
+
+// fieldStages match the search and compute the facet fields
+func fieldStages(match bson.M, score interface{}) bson.A {
+	fields := bson.M{}
+	for k, v := range facetFields {
+		fields[k] = v
+	}
+	if score != nil {
+		fields["score"] = score
+	}
+	return bson.A{
+		bson.M{"$match": match},
+		bson.M{"$lookup": bson.M{"from": itemCollection, "localField": "components.item_id", "foreignField": "_id", "as": "component_items"}},
+		bson.M{"$addFields": fields},
+		bson.M{"$project": bson.M{"component_items": 0}},
+	}
+}
+
+// hitsPipeline returns a page of the best scoring hits and the total in a single hitsResult
+func hitsPipeline(match bson.M, score interface{}, filters *FacetFilters, pagination *types.Pagination) bson.A {
+	return append(matchStages(match, score, filters), bson.M{"$facet": bson.M{
+		"hits": bson.A{
+			bson.M{"$sort": bson.D{{Key: "score", Value: -1}, {Key: "_id", Value: 1}}},
+			bson.M{"$skip": pagination.Skip()},
+			bson.M{"$limit": pagination.Limit},
+		},
+		"total": bson.A{bson.M{"$count": "count"}},
+	}})
+}
+
+// facetPipeline returns the facet counts of every hit in a single facetResult. Facets are
+// disjunctive: each one is counted with every filter except its own, so picking a value does
+// not hide the other values of the same facet.
+func facetPipeline(match bson.M, filters *FacetFilters) bson.A {
+	search := bson.M{}
+	listing := bson.M{}
+	for k, v := range match {
+		search[k] = v
+	}
+	for _, key := range listingFacets {
+		if v, ok := search[key]; ok {
+			listing[key] = v
+			delete(search, key)
+		}
+	}
+	branch := func(facet string, stages ...bson.M) bson.A {
+		facetMatch := filters.matchExcept(facet)
+		for name, key := range listingFacets {
+			if v, ok := listing[key]; ok && name != facet {
+				facetMatch[key] = v
+			}
+		}
+		pipeline := bson.A{bson.M{"$match": facetMatch}}
+		for _, v := range stages {
+			pipeline = append(pipeline, v)
+		}
+		return pipeline
+	}
+
+	rating := bson.M{"_id": nil}
+	for _, v := range ratingThresholds {
+		rating[thresholdKey(v)] = bson.M{"$sum": bson.M{"$cond": bson.A{bson.M{"$gte": bson.A{"$average_rating", v}}, 1, 0}}}
+	}
+	discount := bson.M{"_id": nil}
+	for _, v := range discountThresholds {
+		discount[thresholdKey(v)] = bson.M{"$sum": bson.M{"$cond": bson.A{bson.M{"$gte": bson.A{"$discount", v}}, 1, 0}}}
+	}
+	return append(fieldStages(search, nil), bson.M{"$facet": bson.M{
+		priceFacet: branch(priceFacet, bson.M{"$bucket": bson.M{
+			"groupBy":    "$base_price",
+			"boundaries": priceBoundaries,
+			"default":    priceBoundaries[len(priceBoundaries)-1],
+			"output":     bson.M{"count": bson.M{"$sum": 1}},
+		}}),
+		categoryFacet: branch(categoryFacet,
+			bson.M{"$unwind": "$category_id"},
+			bson.M{"$group": bson.M{"_id": "$category_id", "count": bson.M{"$sum": 1}}},
+			bson.M{"$sort": bson.D{{Key: "count", Value: -1}, {Key: "_id", Value: 1}}},
+			bson.M{"$limit": constants.SearchFacetLimit},
+		),
+		vendorFacet: branch(vendorFacet,
+			bson.M{"$group": bson.M{"_id": "$vendor_id", "count": bson.M{"$sum": 1}}},
+			bson.M{"$sort": bson.D{{Key: "count", Value: -1}, {Key: "_id", Value: 1}}},
+			bson.M{"$limit": constants.SearchFacetLimit},
+		),
+		ratingFacet:   branch(ratingFacet, bson.M{"$group": rating}),
+		discountFacet: branch(discountFacet, bson.M{"$group": discount}),
+		inStockFacet:  branch(inStockFacet, bson.M{"$group": bson.M{"_id": nil, "count": bson.M{"$sum": bson.M{"$cond": bson.A{"$in_stock", 1, 0}}}}}),
+	}})
+}
+
+// thresholdKey names the count of a rating or discount threshold in the facet stage output
+func thresholdKey(min float64) string {
+	return "min_" + strings.ReplaceAll(strconv.FormatFloat(min, 'f', -1, 64), ".", "_")
+}
+
+// queryItems returns a page of the matched items, ranked by score, and how many there are
+func queryItems(itemRepo ItemRepository, match bson.M, score interface{}, q *Query) ([]*item.Item, int64, error) {
+	var results []*hitsResult
+	if err := itemRepo.Aggregate(hitsPipeline(match, score, q.Facets, q.Pagination), &results); err != nil {
+		return nil, 0, err
+	}
+	if len(results) == 0 || len(results[0].Total) == 0 {
+		return []*item.Item{}, 0, nil
+	}
+	return results[0].Hits, results[0].Total[0].Count, nil
+}
+
+// facetItems counts the facets of the matched items
+func facetItems(itemRepo ItemRepository, match bson.M, q *Query) (*Facets, error) {
+	var results []*facetResult
+	if err := itemRepo.Aggregate(facetPipeline(match, q.Facets), &results); err != nil {
+		return nil, err
+	}
+	result := &facetResult{}
+	if len(results) > 0 {
+		result = results[0]
+	}
+	return result.facets(), nil
+}
+
+// facets turns the facet stage output into facets. Categories and vendors are named by the controller.
+func (result *facetResult) facets() *Facets {
+	facets := &Facets{
+		Price:    make([]RangeCount, 0, len(result.Price)),
+		Category: make([]FacetCount, 0, len(result.Category)),
+		Vendor:   make([]FacetCount, 0, len(result.Vendor)),
+		Rating:   make([]ThresholdCount, 0, len(ratingThresholds)),
+		Discount: make([]ThresholdCount, 0, len(discountThresholds)),
+	}
+	for _, v := range result.Price {
+		bucket := RangeCount{Min: v.Min, Count: v.Count}
+		for _, b := range priceBoundaries {
+			if b > v.Min {
+				max := b
+				bucket.Max = &max
+				break
+			}
+		}
+		facets.Price = append(facets.Price, bucket)
+	}
+	for _, v := range result.Category {
+		facets.Category = append(facets.Category, FacetCount{ID: v.ID, Count: v.Count})
+	}
+	for _, v := range result.Vendor {
+		facets.Vendor = append(facets.Vendor, FacetCount{ID: v.ID, Count: v.Count})
+	}
+
+	count := func(docs []bson.M, key string) int64 {
+		if len(docs) == 0 {
+			return 0
+		}
+		switch n := docs[0][key].(type) {
+		case int32:
+			return int64(n)
+		case int64:
+			return n
+		}
+		return 0
+	}
+	facets.InStock = count(result.InStock, "count")
+	for _, v := range ratingThresholds {
+		facets.Rating = append(facets.Rating, ThresholdCount{Min: v, Count: count(result.Rating, thresholdKey(v))})
+	}
+	for _, v := range discountThresholds {
+		facets.Discount = append(facets.Discount, ThresholdCount{Min: v, Count: count(result.Discount, thresholdKey(v))})
+	}
+	return facets
+}
+
+// nameFacets names the categories and vendors of the facets
+func (sc *SearchController) nameFacets(facets *Facets) *errors.AppError {
+	categoryIDs := make([]primitive.ObjectID, 0, len(facets.Category))
+	for _, v := range facets.Category {
+		categoryIDs = append(categoryIDs, v.ID)
+	}
+	vendorIDs := make([]primitive.ObjectID, 0, len(facets.Vendor))
+	for _, v := range facets.Vendor {
+		vendorIDs = append(vendorIDs, v.ID)
+	}
+	names := make(map[primitive.ObjectID]string, len(categoryIDs)+len(vendorIDs))
+	if len(categoryIDs) > 0 {
+		categories, err := sc.categoryRepo.GetCategories(bson.M{"_id": bson.M{"$in": categoryIDs}})
+		if err != nil {
+			return errors.ErrInternalServer
+		}
+		for _, v := range categories {
+			names[v.ID] = v.Name
+		}
+	}
+	if len(vendorIDs) > 0 {
+		vendors, err := sc.userRepo.GetUsers(bson.M{"_id": bson.M{"$in": vendorIDs}})
+		if err != nil {
+			return errors.ErrInternalServer
+		}
+		for _, v := range vendors {
+			names[v.ID] = v.FirstName + " " + v.LastName
+		}
+	}
+	for i, v := range facets.Category {
+		facets.Category[i].Name = names[v.ID]
+	}
+	for i, v := range facets.Vendor {
+		facets.Vendor[i].Name = names[v.ID]
+	}
+	return nil
+}
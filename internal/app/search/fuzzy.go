@@ -0,0 +1,211 @@
+package search
+
+import (
+	"log"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/ayo-ajayi/ecommerce/internal/app/item"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Vocabulary holds the words of published item names and tags and of category names, with how
+// often each is used. Search corrects query words that are not in it.
+type Vocabulary struct {
+	itemRepo     VocabularyItemRepository
+	categoryRepo CategoryRepository
+	mu           sync.RWMutex
+	words        map[string]int
+	stems        map[string]bool
+}
+
+type VocabularyItemRepository interface {
+	GetItems(filter interface{}, opts ...*options.FindOptions) ([]*item.Item, error)
+}
+
+func NewVocabulary(itemRepo VocabularyItemRepository, categoryRepo CategoryRepository) *Vocabulary {
+	return &Vocabulary{
+		itemRepo:     itemRepo,
+		categoryRepo: categoryRepo,
+		words:        map[string]int{},
+		stems:        map[string]bool{},
+	}
+}
+
+// RunVocabularyJob rebuilds the vocabulary now and then at every interval. It never returns.
+func (v *Vocabulary) RunVocabularyJob(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := v.Build(); err != nil {
+			log.Println("failed to build search vocabulary: " + err.Error())
+		}
+		<-ticker.C
+	}
+}
+
+func (v *Vocabulary) Build() error {
+	items, err := v.itemRepo.GetItems(bson.M{"status": bson.M{"$ne": item.Draft}}, options.Find().SetProjection(bson.M{"name": 1, "tags": 1}))
+	if err != nil {
+		return err
+	}
+	categories, err := v.categoryRepo.GetCategories(bson.M{}, options.Find().SetProjection(bson.M{"name": 1}))
+	if err != nil {
+		return err
+	}
+	words := make(map[string]int)
+	for _, it := range items {
+		for _, w := range queryWords(it.Name + " " + strings.Join(it.Tags, " ")) {
+			words[w]++
+		}
+	}
+	for _, c := range categories {
+		for _, w := range queryWords(c.Name) {
+			words[w]++
+		}
+	}
+	stems := make(map[string]bool, len(words))
+	for w := range words {
+		stems[stem(w)] = true
+	}
+	v.mu.Lock()
+	v.words, v.stems = words, stems
+	v.mu.Unlock()
+	return nil
+}
+
+// Correct replaces each word that is not in the vocabulary, even after stemming, with the most
+// used word within the allowed edit distance. It reports whether anything was replaced.
+func (v *Vocabulary) Correct(words []string) ([]string, bool) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	corrected := make([]string, len(words))
+	changed := false
+	for i, w := range words {
+		corrected[i] = w
+		if v.words[w] > 0 || v.stems[stem(w)] {
+			continue
+		}
+		maxDistance := maxEdits(w)
+		best, bestDistance, bestCount := "", maxDistance+1, 0
+		for candidate, count := range v.words {
+			if abs(len([]rune(candidate))-len([]rune(w))) > maxDistance {
+				continue
+			}
+			d := levenshtein(w, candidate, maxDistance)
+			if d < bestDistance || (d == bestDistance && (count > bestCount || (count == bestCount && candidate < best))) {
+				best, bestDistance, bestCount = candidate, d, count
+			}
+		}
+		if best != "" && bestDistance <= maxDistance {
+			corrected[i] = best
+			changed = true
+		}
+	}
+	return corrected, changed
+}
+
+// maxEdits is how many typos a word of this length may have: none for very short words
+func maxEdits(word string) int {
+	switch n := len([]rune(word)); {
+	case n < 4:
+		return 0
+	case n < 8:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// queryWords lowercases text and splits it into words of letters and digits
+func queryWords(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// levenshtein is the optimal string alignment distance between a and b, counting a swap of two
+// neighbouring letters as one edit. It stops early once the distance is known to exceed max.
+func levenshtein(a, b string, max int) int {
+	ra, rb := []rune(a), []rune(b)
+	prev2 := make([]int, len(rb)+1)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		rowMin := curr[0]
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min3(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] && prev2[j-2]+1 < curr[j] {
+				curr[j] = prev2[j-2] + 1
+			}
+			if curr[j] < rowMin {
+				rowMin = curr[j]
+			}
+		}
+		if rowMin > max {
+			return max + 1
+		}
+		prev2, prev, curr = prev, curr, prev2
+	}
+	return prev[len(rb)]
+}
+
+// stem strips common English suffixes so that "headphones" and "headphone" or "running" and
+// "run" compare equal. It is deliberately light; the text index does its own stemming.
+func stem(word string) string {
+	if len(word) <= 3 {
+		return word
+	}
+	switch {
+	case strings.HasSuffix(word, "ies") && len(word) > 4:
+		return word[:len(word)-3] + "y"
+	case strings.HasSuffix(word, "sses"):
+		return word[:len(word)-2]
+	case strings.HasSuffix(word, "ing") && len(word) > 5:
+		return undouble(word[:len(word)-3])
+	case strings.HasSuffix(word, "ed") && len(word) > 4:
+		return undouble(word[:len(word)-2])
+	case strings.HasSuffix(word, "es") && (strings.HasSuffix(word, "ches") || strings.HasSuffix(word, "shes") || strings.HasSuffix(word, "xes")):
+		return word[:len(word)-2]
+	case strings.HasSuffix(word, "s") && !strings.HasSuffix(word, "ss") && !strings.HasSuffix(word, "us"):
+		return word[:len(word)-1]
+	}
+	return word
+}
+
+// undouble drops a doubled final consonant left by suffix stripping, as in "runn" from "running"
+func undouble(word string) string {
+	n := len(word)
+	if n > 2 && word[n-1] == word[n-2] && !strings.ContainsRune("aeiousl", rune(word[n-1])) {
+		return word[:n-1]
+	}
+	return word
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
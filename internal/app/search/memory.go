@@ -0,0 +1,309 @@
+package search
+
+import (
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ayo-ajayi/ecommerce/internal/app/category"
+	"github.com/ayo-ajayi/ecommerce/internal/app/item"
+	"github.com/ayo-ajayi/ecommerce/internal/constants"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MemoryEngine ranks items and categories with an inverted index held in memory, so search
+// needs no text index. The index is loaded by Rebuild and kept current through IndexHook.
+// Each server has its own index, which only sees its own changes until the next Rebuild.
+// Listing filters and facets are still applied by the database, to the best ranked items.
+type MemoryEngine struct {
+	itemRepo     MemoryItemRepository
+	categoryRepo CategoryRepository
+	mu           sync.RWMutex
+	items        *invertedIndex
+	categories   *invertedIndex
+	// changes made while a rebuild is loading, replayed on the new index before it is swapped in
+	rebuildMu  sync.Mutex
+	rebuilding bool
+	changes    []indexChange
+}
+
+// indexChange adds a document to, or with no fields removes it from, the item or category index
+type indexChange struct {
+	category bool
+	id       primitive.ObjectID
+	fields   []weightedText
+}
+
+type MemoryItemRepository interface {
+	ItemRepository
+	GetItems(filter interface{}, opts ...*options.FindOptions) ([]*item.Item, error)
+}
+
+func NewMemoryEngine(itemRepo MemoryItemRepository, categoryRepo CategoryRepository) *MemoryEngine {
+	return &MemoryEngine{
+		itemRepo:     itemRepo,
+		categoryRepo: categoryRepo,
+		items:        newInvertedIndex(),
+		categories:   newInvertedIndex(),
+	}
+}
+
+// weightedText is a field's text and how much a match in it counts
+type weightedText struct {
+	text   string
+	weight float64
+}
+
+func itemFields(it *item.Item) []weightedText {
+	return []weightedText{
+		{text: it.Name, weight: constants.SearchNameWeight},
+		{text: strings.Join(it.Tags, " "), weight: constants.SearchTagsWeight},
+		{text: it.Description, weight: constants.SearchDescriptionWeight},
+	}
+}
+
+func categoryFields(c *category.Category) []weightedText {
+	return []weightedText{
+		{text: c.Name, weight: constants.SearchNameWeight},
+		{text: c.Description, weight: constants.SearchDescriptionWeight},
+	}
+}
+
+// invertedIndex maps each stemmed word to the documents using it, weighted by where and how
+// often they use it. It is not safe for concurrent use.
+type invertedIndex struct {
+	postings map[string]map[primitive.ObjectID]float64
+	terms    map[primitive.ObjectID][]string
+}
+
+func newInvertedIndex() *invertedIndex {
+	return &invertedIndex{
+		postings: map[string]map[primitive.ObjectID]float64{},
+		terms:    map[primitive.ObjectID][]string{},
+	}
+}
+
+func (ix *invertedIndex) add(id primitive.ObjectID, fields []weightedText) {
+	ix.remove(id)
+	weights := make(map[string]float64)
+	for _, f := range fields {
+		for _, w := range queryWords(f.text) {
+			weights[stem(w)] += f.weight
+		}
+	}
+	terms := make([]string, 0, len(weights))
+	for term, weight := range weights {
+		if ix.postings[term] == nil {
+			ix.postings[term] = make(map[primitive.ObjectID]float64)
+		}
+		ix.postings[term][id] = weight
+		terms = append(terms, term)
+	}
+	ix.terms[id] = terms
+}
+
+func (ix *invertedIndex) remove(id primitive.ObjectID) {
+	for _, term := range ix.terms[id] {
+		delete(ix.postings[term], id)
+		if len(ix.postings[term]) == 0 {
+			delete(ix.postings, term)
+		}
+	}
+	delete(ix.terms, id)
+}
+
+// search returns up to limit documents using any of the words, best first, with their scores,
+// and how many documents use them. Rarer words count for more.
+func (ix *invertedIndex) search(words []string, limit int) ([]primitive.ObjectID, []float64, int) {
+	scores := make(map[primitive.ObjectID]float64)
+	seen := make(map[string]bool)
+	for _, w := range words {
+		term := stem(w)
+		if seen[term] {
+			continue
+		}
+		seen[term] = true
+		docs := ix.postings[term]
+		if len(docs) == 0 {
+			continue
+		}
+		idf := math.Log(1 + float64(len(ix.terms))/float64(len(docs)))
+		for id, weight := range docs {
+			scores[id] += weight * idf
+		}
+	}
+	ids := make([]primitive.ObjectID, 0, len(scores))
+	for id := range scores {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		if scores[ids[i]] != scores[ids[j]] {
+			return scores[ids[i]] > scores[ids[j]]
+		}
+		return ids[i].Hex() < ids[j].Hex()
+	})
+	matched := len(ids)
+	if len(ids) > limit {
+		ids = ids[:limit]
+	}
+	ranked := make([]float64, len(ids))
+	for i, id := range ids {
+		ranked[i] = scores[id]
+	}
+	return ids, ranked, matched
+}
+
+// RunRebuildJob rebuilds the index every interval, to pick up changes made through other servers
+func (me *MemoryEngine) RunRebuildJob(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := me.Rebuild(); err != nil {
+			log.Println("failed to build search index: " + err.Error())
+		}
+		<-ticker.C
+	}
+}
+
+// Rebuild indexes every published item and every category into a new index and swaps it in.
+// Changes indexed while it loads are replayed on the new index first, so none are lost.
+func (me *MemoryEngine) Rebuild() error {
+	me.rebuildMu.Lock()
+	defer me.rebuildMu.Unlock()
+	me.mu.Lock()
+	me.rebuilding, me.changes = true, nil
+	me.mu.Unlock()
+	defer func() {
+		me.mu.Lock()
+		me.rebuilding, me.changes = false, nil
+		me.mu.Unlock()
+	}()
+
+	items, err := me.itemRepo.GetItems(bson.M{"status": bson.M{"$ne": item.Draft}}, options.Find().SetProjection(bson.M{"name": 1, "tags": 1, "description": 1}))
+	if err != nil {
+		return err
+	}
+	categories, err := me.categoryRepo.GetCategories(bson.M{}, options.Find().SetProjection(bson.M{"name": 1, "description": 1}))
+	if err != nil {
+		return err
+	}
+	itemIndex, categoryIndex := newInvertedIndex(), newInvertedIndex()
+	for _, v := range items {
+		itemIndex.add(v.ID, itemFields(v))
+	}
+	for _, v := range categories {
+		categoryIndex.add(v.ID, categoryFields(v))
+	}
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	for _, v := range me.changes {
+		ix := itemIndex
+		if v.category {
+			ix = categoryIndex
+		}
+		if v.fields == nil {
+			ix.remove(v.id)
+		} else {
+			ix.add(v.id, v.fields)
+		}
+	}
+	me.items, me.categories = itemIndex, categoryIndex
+	return nil
+}
+
+// apply makes the change to the live index, and remembers it for the new index while a rebuild loads
+func (me *MemoryEngine) apply(change indexChange) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	ix := me.items
+	if change.category {
+		ix = me.categories
+	}
+	if change.fields == nil {
+		ix.remove(change.id)
+	} else {
+		ix.add(change.id, change.fields)
+	}
+	if me.rebuilding {
+		me.changes = append(me.changes, change)
+	}
+}
+
+func (me *MemoryEngine) IndexItem(it *item.Item) error {
+	me.apply(indexChange{id: it.ID, fields: itemFields(it)})
+	return nil
+}
+
+func (me *MemoryEngine) IndexCategory(c *category.Category) error {
+	me.apply(indexChange{category: true, id: c.ID, fields: categoryFields(c)})
+	return nil
+}
+
+func (me *MemoryEngine) DeleteItem(id primitive.ObjectID) error {
+	me.apply(indexChange{id: id})
+	return nil
+}
+
+func (me *MemoryEngine) DeleteCategory(id primitive.ObjectID) error {
+	me.apply(indexChange{category: true, id: id})
+	return nil
+}
+
+// rankItems returns the match and score of the best ranked items, or a nil match when nothing
+// matches. approximate tells that more items matched than are ranked, so filters and facets only
+// see the best of them.
+func (me *MemoryEngine) rankItems(terms string) (match bson.M, score interface{}, approximate bool) {
+	me.mu.RLock()
+	ids, scores, matched := me.items.search(queryWords(terms), constants.MaxSearchCandidates)
+	me.mu.RUnlock()
+	if len(ids) == 0 {
+		return nil, nil, false
+	}
+	score = bson.M{"$arrayElemAt": bson.A{scores, bson.M{"$indexOfArray": bson.A{ids, "$_id"}}}}
+	return bson.M{"$in": ids}, score, matched > len(ids)
+}
+
+func (me *MemoryEngine) Query(q *Query) (*Result, error) {
+	result := &Result{Items: []*item.Item{}, Categories: []*category.Category{}}
+	if match, score, approximate := me.rankItems(q.Terms); match != nil {
+		items, total, err := queryItems(me.itemRepo, withMatch(q.Filter, "_id", match), score, q)
+		if err != nil {
+			return nil, err
+		}
+		result.Items, result.Total, result.Approximate = items, total, approximate
+	}
+
+	me.mu.RLock()
+	ids, scores, _ := me.categories.search(queryWords(q.Terms), int(constants.SearchCategoriesLimit))
+	me.mu.RUnlock()
+	if len(ids) == 0 {
+		return result, nil
+	}
+	categories, err := me.categoryRepo.GetCategories(bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return nil, err
+	}
+	rank := make(map[primitive.ObjectID]int, len(ids))
+	for i, id := range ids {
+		rank[id] = i
+	}
+	for _, v := range categories {
+		v.Score = scores[rank[v.ID]]
+	}
+	sort.Slice(categories, func(i, j int) bool { return rank[categories[i].ID] < rank[categories[j].ID] })
+	result.Categories = categories
+	return result, nil
+}
+
+func (me *MemoryEngine) Facets(q *Query) (*Facets, error) {
+	match, _, _ := me.rankItems(q.Terms)
+	if match == nil {
+		return (&facetResult{}).facets(), nil
+	}
+	return facetItems(me.itemRepo, withMatch(q.Filter, "_id", match), q)
+}
@@ -0,0 +1,113 @@
+package search
+
+import (
+	"sync"
+
+	"github.com/ayo-ajayi/ecommerce/internal/app/category"
+	"github.com/ayo-ajayi/ecommerce/internal/app/item"
+	"github.com/ayo-ajayi/ecommerce/internal/constants"
+	"github.com/ayo-ajayi/ecommerce/internal/database"
+	"github.com/ayo-ajayi/ecommerce/internal/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoEngine searches the weighted text indexes created by InitSearchIndex
+type MongoEngine struct {
+	itemRepo     ItemRepository
+	categoryRepo CategoryRepository
+}
+
+func NewMongoEngine(itemRepo ItemRepository, categoryRepo CategoryRepository) *MongoEngine {
+	return &MongoEngine{
+		itemRepo:     itemRepo,
+		categoryRepo: categoryRepo,
+	}
+}
+
+const textIndexName = "weighted_text_index"
+
+// InitSearchIndex creates the weighted text indexes searched by MongoEngine. A collection can only have
+// one text index, so the unweighted index created by earlier versions is dropped first.
+func InitSearchIndex(itemCollection, categoryCollection *mongo.Collection) *errors.AppError {
+	ctx, cancel := database.DBReqContext(5)
+	defer cancel()
+	indexes := map[*mongo.Collection]mongo.IndexModel{
+		itemCollection: {
+			Keys: bson.D{{Key: "name", Value: "text"}, {Key: "tags", Value: "text"}, {Key: "description", Value: "text"}},
+			Options: options.Index().SetName(textIndexName).SetWeights(bson.D{
+				{Key: "name", Value: constants.SearchNameWeight},
+				{Key: "tags", Value: constants.SearchTagsWeight},
+				{Key: "description", Value: constants.SearchDescriptionWeight},
+			}),
+		},
+		categoryCollection: {
+			Keys: bson.D{{Key: "name", Value: "text"}, {Key: "description", Value: "text"}},
+			Options: options.Index().SetName(textIndexName).SetWeights(bson.D{
+				{Key: "name", Value: constants.SearchNameWeight},
+				{Key: "description", Value: constants.SearchDescriptionWeight},
+			}),
+		},
+	}
+	for collection, index := range indexes {
+		if _, err := collection.Indexes().DropOne(ctx, "text_index"); err != nil {
+			if cmdErr, ok := err.(mongo.CommandError); !ok || cmdErr.Code != 27 { // 27: IndexNotFound
+				return errors.NewError("failed to drop old text index: "+err.Error(), 500)
+			}
+		}
+		if _, err := collection.Indexes().CreateOne(ctx, index); err != nil {
+			return errors.NewError("failed to create index: "+err.Error(), 500)
+		}
+	}
+	return nil
+}
+
+var textScore = bson.M{"$meta": "textScore"}
+
+// IndexItem, IndexCategory, DeleteItem and DeleteCategory do nothing: MongoDB keeps the text indexes current
+func (me *MongoEngine) IndexItem(it *item.Item) error {
+	return nil
+}
+
+func (me *MongoEngine) IndexCategory(c *category.Category) error {
+	return nil
+}
+
+func (me *MongoEngine) DeleteItem(id primitive.ObjectID) error {
+	return nil
+}
+
+func (me *MongoEngine) DeleteCategory(id primitive.ObjectID) error {
+	return nil
+}
+
+func (me *MongoEngine) Query(q *Query) (*Result, error) {
+	text := bson.M{"$search": q.Terms}
+	result := &Result{}
+	var itemErr, categoryErr error
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		result.Items, result.Total, itemErr = queryItems(me.itemRepo, withMatch(q.Filter, "$text", text), textScore, q)
+	}()
+	go func() {
+		defer wg.Done()
+		opts := options.Find().SetProjection(bson.M{"score": textScore}).SetSort(bson.D{{Key: "score", Value: textScore}}).SetLimit(constants.SearchCategoriesLimit)
+		result.Categories, categoryErr = me.categoryRepo.GetCategories(bson.M{"$text": text}, opts)
+	}()
+	wg.Wait()
+	if itemErr != nil {
+		return nil, itemErr
+	}
+	if categoryErr != nil {
+		return nil, categoryErr
+	}
+	return result, nil
+}
+
+func (me *MongoEngine) Facets(q *Query) (*Facets, error) {
+	return facetItems(me.itemRepo, withMatch(q.Filter, "$text", bson.M{"$search": q.Terms}), q)
+}
@@ -1,104 +1,213 @@
 package search
 
 import (
-	"sync"
+	"strings"
+	"time"
 
 	"github.com/ayo-ajayi/ecommerce/internal/app/category"
 	"github.com/ayo-ajayi/ecommerce/internal/app/item"
-	"github.com/ayo-ajayi/ecommerce/internal/database"
+	"github.com/ayo-ajayi/ecommerce/internal/app/searchlog"
+	"github.com/ayo-ajayi/ecommerce/internal/app/user"
+	"github.com/ayo-ajayi/ecommerce/internal/constants"
 	"github.com/ayo-ajayi/ecommerce/internal/errors"
+	"github.com/ayo-ajayi/ecommerce/internal/types"
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type SearchController struct {
-	itemRepo     ItemRepository
-	categoryRepo CategoryRepository
+	engine          SearchEngine
+	categoryRepo    CategoryRepository
+	userRepo        UserRepository
+	categoryTree    item.CategoryTree
+	itemPreparer    ItemPreparer
+	queryRecorder   QueryRecorder
+	synonymExpander SynonymExpander
+	vocabulary      *Vocabulary
+	searchLogger    SearchLogger
 }
 
-func NewSearchController(itemRepo ItemRepository, categoryRepo CategoryRepository) *SearchController {
+func NewSearchController(engine SearchEngine, categoryRepo CategoryRepository, userRepo UserRepository, categoryTree item.CategoryTree, itemPreparer ItemPreparer, queryRecorder QueryRecorder, synonymExpander SynonymExpander, vocabulary *Vocabulary, searchLogger SearchLogger) *SearchController {
 	return &SearchController{
-		itemRepo:     itemRepo,
-		categoryRepo: categoryRepo,
+		engine:          engine,
+		categoryRepo:    categoryRepo,
+		userRepo:        userRepo,
+		categoryTree:    categoryTree,
+		itemPreparer:    itemPreparer,
+		queryRecorder:   queryRecorder,
+		synonymExpander: synonymExpander,
+		vocabulary:      vocabulary,
+		searchLogger:    searchLogger,
 	}
 }
 
 type ItemRepository interface {
-	GetItems(filter interface{}, opts ...*options.FindOptions) ([]*item.Item, error)
+	Aggregate(pipeline interface{}, result interface{}) error
 }
 type CategoryRepository interface {
 	GetCategories(filter interface{}, opts ...*options.FindOptions) ([]*category.Category, error)
 }
+type UserRepository interface {
+	GetUsers(filter interface{}) ([]*user.User, error)
+}
 
-func InitSearchIndex(coll ...*mongo.Collection) *errors.AppError {
-	ctx, cancel := database.DBReqContext(5)
-	defer cancel()
-	var errSlice []error
-	for _, collection := range coll {
-		_, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{
-			Keys: bson.D{
-				{Key: "name", Value: "text"}, {Key: "description", Value: "text"},
-			},
-			Options: options.Index().SetName("text_index"),
-		})
-		errSlice = append(errSlice, err)
-	}
-	for _, err := range errSlice {
-		if err != nil {
-			return errors.NewError("failed to create index: "+err.Error(), 500)
-		}
-	}
-	return nil
+// QueryRecorder counts searches that found results, for suggesting popular queries. client
+// identifies who searched, so no one client can fill the suggestions.
+type QueryRecorder interface {
+	RecordQuery(client, query string)
 }
 
+// SynonymExpander returns the synonyms of the terms in a query
+type SynonymExpander interface {
+	Expand(query string) ([]string, *errors.AppError)
+}
+
+// SearchLogger records searches for the search reports
+type SearchLogger interface {
+	LogSearch(searchLog *searchlog.SearchLog)
+}
+
+// ItemPreparer fills in an item's effective price and computed stock
+type ItemPreparer interface {
+	PrepareItems(items ...*item.Item) *errors.AppError
+}
+
+// Search ranks items and categories by relevance with the configured search engine. Items are returned a page at a time with
+// facet counts over every matching item, and can be narrowed by the same filters as item
+// listings and by facets. Searches also find the synonyms of their terms, and a search that
+// finds nothing is retried with its typos corrected, returning the correction as did_you_mean.
+// Every search is logged with a search_id that clicks on its results are recorded against.
 func (sc *SearchController) Search(ctx *gin.Context) {
-	query := ctx.Query("q")
+	start := time.Now()
+	// only words are searched, so input cannot form phrase, negation or regex queries
+	words := queryWords(ctx.Query("q"))
+	query := strings.Join(words, " ")
 	if query == "" {
 		ctx.JSON(400, gin.H{"error": "query not found"})
 		return
 	}
+	if len(query) > constants.MaxSearchQueryLength {
+		ctx.JSON(400, gin.H{"error": "query too long"})
+		return
+	}
+	pagination, err := types.NewPagination(ctx.Query("page"), ctx.Query("limit"))
+	if err != nil {
+		ctx.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
 
-	var itemErr, categoryErr error
-	var items []*item.Item
-	filter := bson.M{
-		"$or": []bson.M{
-			{"name": primitive.Regex{
-				Pattern: query,
-				Options: "i",
-			}},
-			{"description": primitive.Regex{
-				Pattern: query,
-				Options: "i",
-			},
-			},
-		}}
-	var wg sync.WaitGroup
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		items, itemErr = sc.itemRepo.GetItems(filter)
-
-	}()
-
-	var categories []*category.Category
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		categories, categoryErr = sc.categoryRepo.GetCategories(filter)
-	}()
-	wg.Wait()
-
-	if itemErr != nil {
-		ctx.JSON(500, gin.H{"error": itemErr.Error()})
+	itemQuery, appErr := item.ParseItemQuery(ctx)
+	if appErr != nil {
+		ctx.JSON(appErr.StatusCode, gin.H{"error": appErr.Error()})
+		return
+	}
+	if appErr := itemQuery.ExpandCategories(sc.categoryTree); appErr != nil {
+		ctx.JSON(appErr.StatusCode, gin.H{"error": appErr.Error()})
+		return
+	}
+	itemFilter, appErr := itemQuery.Filter()
+	if appErr != nil {
+		ctx.JSON(appErr.StatusCode, gin.H{"error": appErr.Error()})
 		return
 	}
-	if categoryErr != nil {
-		ctx.JSON(500, gin.H{"error": categoryErr.Error()})
+	facetFilters, appErr := parseFacetFilters(ctx)
+	if appErr != nil {
+		ctx.JSON(appErr.StatusCode, gin.H{"error": appErr.Error()})
 		return
 	}
 
-	ctx.JSON(200, gin.H{"message": "searching for " + query, "data": gin.H{"items": items, "categories": categories}})
+	q, result, appErr := sc.search(query, itemFilter, facetFilters, pagination)
+	if appErr != nil {
+		ctx.JSON(appErr.StatusCode, gin.H{"error": appErr.Error()})
+		return
+	}
+	didYouMean := ""
+	if result.Total == 0 {
+		if corrected, ok := sc.vocabulary.Correct(words); ok {
+			correctedQuery := strings.Join(corrected, " ")
+			correctedQ, correctedResult, appErr := sc.search(correctedQuery, itemFilter, facetFilters, pagination)
+			if appErr != nil {
+				ctx.JSON(appErr.StatusCode, gin.H{"error": appErr.Error()})
+				return
+			}
+			if correctedResult.Total > 0 || len(correctedResult.Categories) > 0 {
+				q, result, didYouMean = correctedQ, correctedResult, correctedQuery
+			}
+		}
+	}
+	pagination.Total = result.Total
+	userid, _ := ctx.Get("userId")
+	userId, _ := userid.(primitive.ObjectID)
+	if result.Total > 0 {
+		recorded := query
+		if didYouMean != "" {
+			recorded = didYouMean
+		}
+		client := "ip:" + ctx.ClientIP()
+		if !userId.IsZero() {
+			client = "user:" + userId.Hex()
+		}
+		go sc.queryRecorder.RecordQuery(client, recorded)
+	}
+
+	if appErr := sc.itemPreparer.PrepareItems(result.Items...); appErr != nil {
+		ctx.JSON(appErr.StatusCode, gin.H{"error": appErr.Error()})
+		return
+	}
+	facets, err := sc.engine.Facets(q)
+	if err != nil {
+		ctx.JSON(500, gin.H{"error": "internal error: " + err.Error()})
+		return
+	}
+	if appErr := sc.nameFacets(facets); appErr != nil {
+		ctx.JSON(appErr.StatusCode, gin.H{"error": appErr.Error()})
+		return
+	}
+
+	searchLog := &searchlog.SearchLog{
+		ID:         primitive.NewObjectID(),
+		Query:      query,
+		DidYouMean: didYouMean,
+		Results:    result.Total,
+		UserID:     userId,
+		VisitorID:  ctx.GetString("visitorId"),
+		LatencyMs:  time.Since(start).Milliseconds(),
+	}
+	sc.searchLogger.LogSearch(searchLog)
+
+	data := gin.H{"search_id": searchLog.ID, "items": result.Items, "categories": result.Categories, "facets": facets, "pagination": pagination}
+	if didYouMean != "" {
+		data["did_you_mean"] = didYouMean
+	}
+	if result.Approximate {
+		data["approximate"] = true
+	}
+	ctx.JSON(200, gin.H{"message": "searching for " + query, "data": data})
+}
+
+// search queries the engine for the query and the synonyms of its terms
+func (sc *SearchController) search(query string, itemFilter bson.M, facetFilters *FacetFilters, pagination *types.Pagination) (*Query, *Result, *errors.AppError) {
+	synonyms, appErr := sc.synonymExpander.Expand(query)
+	if appErr != nil {
+		return nil, nil, appErr
+	}
+	q := &Query{
+		Terms:      strings.Join(append([]string{query}, synonyms...), " "),
+		Filter:     itemFilter,
+		Facets:     facetFilters,
+		Pagination: pagination,
+	}
+	result, err := sc.engine.Query(q)
+	if err != nil {
+		return nil, nil, errors.NewError("internal error: "+err.Error(), 500)
+	}
+	if result.Items == nil {
+		result.Items = []*item.Item{}
+	}
+	if result.Categories == nil {
+		result.Categories = []*category.Category{}
+	}
+	return q, result, nil
 }
@@ -0,0 +1,85 @@
+package searchlog
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ayo-ajayi/ecommerce/internal/constants"
+	"github.com/ayo-ajayi/ecommerce/internal/errors"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type SearchLogController struct {
+	searchLogServices SearchLogServices
+}
+
+type SearchLogServices interface {
+	RecordClick(searchId, itemId string, position int, userId primitive.ObjectID, visitorId string) *errors.AppError
+	GetReport(report Report, dates *DateRange, limit int) ([]*QueryReport, *errors.AppError)
+}
+
+func NewSearchLogController(searchLogServices SearchLogServices) *SearchLogController {
+	return &SearchLogController{
+		searchLogServices: searchLogServices,
+	}
+}
+
+func (sc *SearchLogController) RecordClick(c *gin.Context) {
+	userid, _ := c.Get("userId")
+	userId, _ := userid.(primitive.ObjectID)
+	req := struct {
+		SearchID string `json:"search_id" binding:"required"`
+		ItemID   string `json:"item_id" binding:"required"`
+		Position int    `json:"position"`
+	}{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	if err := sc.searchLogServices.RecordClick(req.SearchID, req.ItemID, req.Position, userId, c.GetString("visitorId")); err != nil {
+		c.JSON(err.StatusCode, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	c.JSON(200, gin.H{"message": "click recorded"})
+}
+
+func (sc *SearchLogController) GetTopQueries(c *gin.Context) {
+	sc.getReport(c, TopQueries)
+}
+
+func (sc *SearchLogController) GetZeroResultQueries(c *gin.Context) {
+	sc.getReport(c, ZeroResultQueries)
+}
+
+func (sc *SearchLogController) GetLowClickThroughQueries(c *gin.Context) {
+	sc.getReport(c, LowClickThroughQueries)
+}
+
+// getReport reads ?from=2006-01-02&to=2006-01-02&limit=, defaulting to the last days up to today
+func (sc *SearchLogController) getReport(c *gin.Context, report Report) {
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	dates := &DateRange{From: today.AddDate(0, 0, 1-constants.SearchReportDefaultDays), To: today}
+	for field, value := range map[string]*time.Time{"from": &dates.From, "to": &dates.To} {
+		if v := c.Query(field); v != "" {
+			date, err := time.Parse("2006-01-02", v)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": "invalid " + field + " date"}})
+				return
+			}
+			*value = date
+		}
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(constants.SearchReportLimit)))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": "invalid limit"}})
+		return
+	}
+	reports, appErr := sc.searchLogServices.GetReport(report, dates, limit)
+	if appErr != nil {
+		c.JSON(appErr.StatusCode, gin.H{"error": gin.H{"message": appErr.Error()}})
+		return
+	}
+	c.JSON(200, gin.H{"data": gin.H{"queries": reports, "dates": dates}})
+}
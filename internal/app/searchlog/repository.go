@@ -0,0 +1,60 @@
+package searchlog
+
+import (
+	"errors"
+	"time"
+
+	"github.com/ayo-ajayi/ecommerce/internal/constants"
+	"github.com/ayo-ajayi/ecommerce/internal/database"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type SearchLogRepo struct {
+	Collection *mongo.Collection
+}
+
+func NewSearchLogRepo(collection *mongo.Collection) *SearchLogRepo {
+	return &SearchLogRepo{
+		Collection: collection,
+	}
+}
+
+// InitSearchLogIndex indexes logs by date for reports and expires them after the retention period
+func InitSearchLogIndex(collection *mongo.Collection) error {
+	ctx, cancel := database.DBReqContext(5)
+	defer cancel()
+	_, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "created_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(int32((time.Hour * 24 * time.Duration(constants.SearchLogValidityInDays)).Seconds())),
+	})
+	if err != nil {
+		return errors.New("Error creating expiry index for search log collection:" + err.Error())
+	}
+	return nil
+}
+
+func (sr *SearchLogRepo) CreateSearchLog(searchLog *SearchLog) error {
+	ctx, cancel := database.DBReqContext(5)
+	defer cancel()
+	_, err := sr.Collection.InsertOne(ctx, searchLog)
+	return err
+}
+
+func (sr *SearchLogRepo) UpdateSearchLog(filter interface{}, update interface{}) error {
+	ctx, cancel := database.DBReqContext(5)
+	defer cancel()
+	_, err := sr.Collection.UpdateOne(ctx, filter, update)
+	return err
+}
+
+func (sr *SearchLogRepo) Aggregate(pipeline interface{}, result interface{}) error {
+	ctx, cancel := database.DBReqContext(10)
+	defer cancel()
+	cursor, err := sr.Collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return err
+	}
+	return cursor.All(ctx, result)
+}
@@ -0,0 +1,56 @@
+package searchlog
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// SearchLog is one search, by a signed in user or an anonymous visitor, and the results
+// opened from it. Query is the search as typed; DidYouMean is set when a correction was searched instead.
+type SearchLog struct {
+	ID         primitive.ObjectID `json:"id" bson:"_id"`
+	Query      string             `json:"query" bson:"query"`
+	DidYouMean string             `json:"did_you_mean,omitempty" bson:"did_you_mean,omitempty"`
+	Results    int64              `json:"results" bson:"results"`
+	UserID     primitive.ObjectID `json:"user_id,omitempty" bson:"user_id,omitempty"`
+	VisitorID  string             `json:"visitor_id,omitempty" bson:"visitor_id,omitempty"`
+	LatencyMs  int64              `json:"latency_ms" bson:"latency_ms"`
+	Clicks     []Click            `json:"clicks" bson:"clicks"`
+	CreatedAt  time.Time          `json:"created_at" bson:"created_at"`
+}
+
+// Click is a result opened from a search. Position is its 1-based rank in the results, or 0 when unknown.
+type Click struct {
+	ItemID    primitive.ObjectID `json:"item_id" bson:"item_id"`
+	Position  int                `json:"position,omitempty" bson:"position,omitempty"`
+	ClickedAt time.Time          `json:"clicked_at" bson:"clicked_at"`
+}
+
+// QueryReport summarises the searches for one query over a date range
+type QueryReport struct {
+	Query            string    `json:"query" bson:"_id"`
+	Searches         int64     `json:"searches" bson:"searches"`
+	AverageResults   float64   `json:"average_results" bson:"average_results"`
+	ClickThroughRate float64   `json:"click_through_rate" bson:"click_through_rate"`
+	AverageLatencyMs float64   `json:"average_latency_ms" bson:"average_latency_ms"`
+	LastSearchedAt   time.Time `json:"last_searched_at" bson:"last_searched_at"`
+}
+
+// DateRange is the days reported on, from the start of From to the end of To (UTC)
+type DateRange struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+}
+
+type searchEvent struct {
+	log   *SearchLog
+	click *clickEvent
+}
+
+type clickEvent struct {
+	searchID  primitive.ObjectID
+	userID    primitive.ObjectID
+	visitorID string
+	click     Click
+}
@@ -0,0 +1,151 @@
+package searchlog
+
+import (
+	"log"
+	"time"
+
+	"github.com/ayo-ajayi/ecommerce/internal/constants"
+	"github.com/ayo-ajayi/ecommerce/internal/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type SearchLogService struct {
+	searchLogRepo SearchLogRepository
+	eventChan     chan searchEvent
+}
+
+type SearchLogRepository interface {
+	CreateSearchLog(searchLog *SearchLog) error
+	UpdateSearchLog(filter interface{}, update interface{}) error
+	Aggregate(pipeline interface{}, result interface{}) error
+}
+
+// Report is a kind of query report
+type Report string
+
+const (
+	TopQueries             Report = "top-queries"
+	ZeroResultQueries      Report = "zero-result-queries"
+	LowClickThroughQueries Report = "low-click-through-queries"
+)
+
+func NewSearchLogService(searchLogRepo SearchLogRepository) *SearchLogService {
+	ss := &SearchLogService{
+		searchLogRepo: searchLogRepo,
+		eventChan:     make(chan searchEvent, 1000),
+	}
+	go ss.processEvents()
+	return ss
+}
+
+// LogSearch queues a search to be logged. It never blocks the request: searches are dropped when the queue is full.
+func (ss *SearchLogService) LogSearch(searchLog *SearchLog) {
+	searchLog.CreatedAt = time.Now()
+	searchLog.Clicks = []Click{}
+	ss.queue(searchEvent{log: searchLog})
+}
+
+// RecordClick queues a result opened from a search. Only the user or visitor who searched can
+// record clicks on it. Clicks are queued behind the searches, so a click is never saved before its search.
+func (ss *SearchLogService) RecordClick(searchId, itemId string, position int, userId primitive.ObjectID, visitorId string) *errors.AppError {
+	searchID, err := primitive.ObjectIDFromHex(searchId)
+	if err != nil {
+		return errors.NewError("invalid search id", 400)
+	}
+	itemID, err := primitive.ObjectIDFromHex(itemId)
+	if err != nil {
+		return errors.NewError("invalid item id", 400)
+	}
+	if position < 0 {
+		return errors.NewError("invalid position", 400)
+	}
+	if userId.IsZero() && visitorId == "" {
+		return errors.NewError("invalid user", 400)
+	}
+	ss.queue(searchEvent{click: &clickEvent{
+		searchID:  searchID,
+		userID:    userId,
+		visitorID: visitorId,
+		click:     Click{ItemID: itemID, Position: position, ClickedAt: time.Now()},
+	}})
+	return nil
+}
+
+func (ss *SearchLogService) queue(event searchEvent) {
+	select {
+	case ss.eventChan <- event:
+	default:
+		log.Println("search log queue is full, dropping event")
+	}
+}
+
+func (ss *SearchLogService) processEvents() {
+	for v := range ss.eventChan {
+		if err := ss.saveEvent(v); err != nil {
+			log.Println("failed to log search: " + err.Error())
+		}
+	}
+}
+
+func (ss *SearchLogService) saveEvent(v searchEvent) error {
+	if v.log != nil {
+		return ss.searchLogRepo.CreateSearchLog(v.log)
+	}
+	filter := bson.M{"_id": v.click.searchID}
+	if !v.click.userID.IsZero() {
+		filter["user_id"] = v.click.userID
+	} else {
+		filter["visitor_id"] = v.click.visitorID
+	}
+	return ss.searchLogRepo.UpdateSearchLog(filter, bson.M{"$push": bson.M{"clicks": v.click.click}})
+}
+
+// GetReport summarises the searches in the date range by query, most searched first.
+// Top queries covers every query, zero-result queries those that found nothing, and
+// low click-through queries those that found results that were rarely opened.
+func (ss *SearchLogService) GetReport(report Report, dates *DateRange, limit int) ([]*QueryReport, *errors.AppError) {
+	if limit < 1 || limit > constants.SearchReportLimit {
+		return nil, errors.NewError("invalid limit", 400)
+	}
+	if dates.To.Before(dates.From) {
+		return nil, errors.NewError("invalid date range", 400)
+	}
+	match := bson.M{"created_at": bson.M{"$gte": dates.From, "$lt": dates.To.AddDate(0, 0, 1)}}
+	var having bson.M
+	switch report {
+	case TopQueries:
+	case ZeroResultQueries:
+		match["results"] = 0
+	case LowClickThroughQueries:
+		match["results"] = bson.M{"$gt": 0}
+		having = bson.M{"searches": bson.M{"$gte": constants.MinSearchesForClickThrough}, "click_through_rate": bson.M{"$lt": constants.LowClickThroughRate}}
+	default:
+		return nil, errors.NewError("invalid report", 400)
+	}
+
+	pipeline := []bson.M{
+		{"$match": match},
+		{"$group": bson.M{
+			"_id":                "$query",
+			"searches":           bson.M{"$sum": 1},
+			"clicked":            bson.M{"$sum": bson.M{"$cond": bson.A{bson.M{"$gt": bson.A{bson.M{"$size": bson.M{"$ifNull": bson.A{"$clicks", bson.A{}}}}, 0}}, 1, 0}}},
+			"average_results":    bson.M{"$avg": "$results"},
+			"average_latency_ms": bson.M{"$avg": "$latency_ms"},
+			"last_searched_at":   bson.M{"$max": "$created_at"},
+		}},
+		{"$addFields": bson.M{"click_through_rate": bson.M{"$divide": bson.A{"$clicked", "$searches"}}}},
+	}
+	if having != nil {
+		pipeline = append(pipeline, bson.M{"$match": having})
+	}
+	pipeline = append(pipeline,
+		bson.M{"$sort": bson.D{{Key: "searches", Value: -1}, {Key: "_id", Value: 1}}},
+		bson.M{"$limit": limit},
+	)
+	reports := []*QueryReport{}
+	if err := ss.searchLogRepo.Aggregate(pipeline, &reports); err != nil {
+		return nil, errors.ErrInternalServer
+	}
+	return reports, nil
+}
@@ -0,0 +1,29 @@
+package suggest
+
+import (
+	"github.com/ayo-ajayi/ecommerce/internal/errors"
+	"github.com/gin-gonic/gin"
+)
+
+type SuggestController struct {
+	suggestServices SuggestServices
+}
+
+type SuggestServices interface {
+	Suggest(prefix string) (*Suggestions, *errors.AppError)
+}
+
+func NewSuggestController(suggestServices SuggestServices) *SuggestController {
+	return &SuggestController{
+		suggestServices: suggestServices,
+	}
+}
+
+func (sc *SuggestController) Suggest(c *gin.Context) {
+	suggestions, err := sc.suggestServices.Suggest(c.Query("prefix"))
+	if err != nil {
+		c.JSON(err.StatusCode, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	c.JSON(200, gin.H{"data": suggestions})
+}
@@ -0,0 +1,320 @@
+package suggest
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/ayo-ajayi/ecommerce/internal/app/category"
+	"github.com/ayo-ajayi/ecommerce/internal/app/item"
+	"github.com/ayo-ajayi/ecommerce/internal/constants"
+	"github.com/ayo-ajayi/ecommerce/internal/database"
+	"github.com/ayo-ajayi/ecommerce/internal/errors"
+	"github.com/redis/go-redis/v9"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// The prefix index keeps one redis sorted set per kind and prefix, scored by popularity.
+// Items and categories are stored as "<id>:<name>" and queries as the query itself.
+const (
+	itemKind     = "item"
+	categoryKind = "category"
+	queryKind    = "query"
+)
+
+// rebuildKeyPrefix is where RebuildIndex builds the new index before it replaces the live one
+const rebuildKeyPrefix = "suggest-rebuild:"
+
+type SuggestService struct {
+	redisClient  *redis.Client
+	itemRepo     ItemRepository
+	categoryRepo CategoryRepository
+}
+
+type ItemRepository interface {
+	GetItems(filter interface{}, opts ...*options.FindOptions) ([]*item.Item, error)
+}
+
+type CategoryRepository interface {
+	GetCategories(filter interface{}, opts ...*options.FindOptions) ([]*category.Category, error)
+}
+
+// Suggestion is an item or category whose name matches the prefix
+type Suggestion struct {
+	ID   primitive.ObjectID `json:"id"`
+	Name string             `json:"name"`
+}
+
+type Suggestions struct {
+	Items      []Suggestion `json:"items"`
+	Categories []Suggestion `json:"categories"`
+	Queries    []string     `json:"queries"`
+}
+
+func NewSuggestService(redisClient *redis.Client, itemRepo ItemRepository, categoryRepo CategoryRepository) *SuggestService {
+	return &SuggestService{
+		redisClient:  redisClient,
+		itemRepo:     itemRepo,
+		categoryRepo: categoryRepo,
+	}
+}
+
+func key(kind, prefix string) string {
+	return "suggest:" + kind + ":" + prefix
+}
+
+func rebuildKey(kind, prefix string) string {
+	return rebuildKeyPrefix + kind + ":" + prefix
+}
+
+// recordedKey holds the queries a client recorded in the current window
+func recordedKey(client string) string {
+	return "suggest-recorded:" + client
+}
+
+func member(id primitive.ObjectID, name string) string {
+	return id.Hex() + ":" + name
+}
+
+// normalize lowercases text and reduces it to words separated by single spaces
+func normalize(text string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}), " ")
+}
+
+// prefixes returns the prefixes of text up to the maximum prefix length
+func prefixes(text string) []string {
+	runes := []rune(text)
+	if len(runes) > constants.MaxSuggestPrefixLength {
+		runes = runes[:constants.MaxSuggestPrefixLength]
+	}
+	result := make([]string, 0, len(runes))
+	for i := 1; i <= len(runes); i++ {
+		if runes[i-1] != ' ' {
+			result = append(result, string(runes[:i]))
+		}
+	}
+	return result
+}
+
+// namePrefixes returns the prefixes a name is found by: those of the whole name and of each of its words
+func namePrefixes(name string) []string {
+	normalized := normalize(name)
+	seen := make(map[string]bool)
+	var result []string
+	for _, text := range append([]string{normalized}, strings.Fields(normalized)...) {
+		for _, v := range prefixes(text) {
+			if !seen[v] {
+				seen[v] = true
+				result = append(result, v)
+			}
+		}
+	}
+	return result
+}
+
+func index(ctx context.Context, pipe redis.Pipeliner, key func(kind, prefix string) string, kind string, id primitive.ObjectID, name string, score float64) {
+	for _, v := range namePrefixes(name) {
+		pipe.ZAdd(ctx, key(kind, v), redis.Z{Score: score, Member: member(id, name)})
+	}
+}
+
+func unindex(ctx context.Context, pipe redis.Pipeliner, kind string, id primitive.ObjectID, name string) {
+	for _, v := range namePrefixes(name) {
+		pipe.ZRem(ctx, key(kind, v), member(id, name))
+	}
+}
+
+func exec(ctx context.Context, pipe redis.Pipeliner) {
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Println("failed to update suggestions: " + err.Error())
+	}
+}
+
+// ItemChanged keeps the item's name in the prefix index while it is published, ranked by its views
+func (ss *SuggestService) ItemChanged(old, it *item.Item) {
+	ctx, cancel := database.DBReqContext(5)
+	defer cancel()
+	pipe := ss.redisClient.TxPipeline()
+	views := 0
+	if old != nil {
+		unindex(ctx, pipe, itemKind, old.ID, old.Name)
+		views = old.ViewCount
+	}
+	if it != nil && it.IsPublished() {
+		if it.ViewCount > views {
+			views = it.ViewCount
+		}
+		index(ctx, pipe, key, itemKind, it.ID, it.Name, float64(views))
+	}
+	exec(ctx, pipe)
+}
+
+func (ss *SuggestService) CategoryChanged(old, c *category.Category) {
+	ctx, cancel := database.DBReqContext(5)
+	defer cancel()
+	pipe := ss.redisClient.TxPipeline()
+	if old != nil {
+		unindex(ctx, pipe, categoryKind, old.ID, old.Name)
+	}
+	if c != nil {
+		index(ctx, pipe, key, categoryKind, c.ID, c.Name, 0)
+	}
+	exec(ctx, pipe)
+}
+
+// RecordQuery counts a search that found results, so popular queries are suggested first.
+// Only the most popular queries are kept for each prefix. A client, the signed in user or else
+// the client's address, only counts each query once and only so many queries in each window.
+func (ss *SuggestService) RecordQuery(client, query string) {
+	query = normalize(query)
+	if query == "" {
+		return
+	}
+	ctx, cancel := database.DBReqContext(5)
+	defer cancel()
+	recorded := ss.redisClient.TxPipeline()
+	added := recorded.SAdd(ctx, recordedKey(client), query)
+	count := recorded.SCard(ctx, recordedKey(client))
+	if _, err := recorded.Exec(ctx); err != nil {
+		log.Println("failed to update suggestions: " + err.Error())
+		return
+	}
+	if count.Val() == 1 {
+		ss.redisClient.Expire(ctx, recordedKey(client), time.Duration(constants.RecordedQueriesWindowInMins)*time.Minute)
+	}
+	if added.Val() == 0 || count.Val() > constants.MaxRecordedQueriesPerClient {
+		return
+	}
+	pipe := ss.redisClient.Pipeline()
+	for _, v := range prefixes(query) {
+		pipe.ZIncrBy(ctx, key(queryKind, v), 1, query)
+		pipe.ZRemRangeByRank(ctx, key(queryKind, v), 0, -constants.MaxSuggestQueriesPerPrefix-1)
+	}
+	exec(ctx, pipe)
+}
+
+// RebuildIndex indexes every published item and every category. It is run on startup to pick
+// up changes made while the index was not being updated. The new index is built next to the
+// live one and then renamed over it, and prefixes no name has any more are deleted.
+func (ss *SuggestService) RebuildIndex() error {
+	items, err := ss.itemRepo.GetItems(bson.M{"status": bson.M{"$ne": item.Draft}}, options.Find().SetProjection(bson.M{"name": 1, "view_count": 1}))
+	if err != nil {
+		return err
+	}
+	categories, err := ss.categoryRepo.GetCategories(bson.M{}, options.Find().SetProjection(bson.M{"name": 1}))
+	if err != nil {
+		return err
+	}
+	ctx, cancel := database.DBReqContext(60)
+	defer cancel()
+	// left over from a rebuild that did not finish
+	if err := ss.deleteKeys(ctx, rebuildKeyPrefix+"*"); err != nil {
+		return err
+	}
+
+	built := make(map[string]string)
+	pipe := ss.redisClient.Pipeline()
+	for _, v := range items {
+		index(ctx, pipe, rebuildKey, itemKind, v.ID, v.Name, float64(v.ViewCount))
+		for _, prefix := range namePrefixes(v.Name) {
+			built[rebuildKey(itemKind, prefix)] = key(itemKind, prefix)
+		}
+	}
+	for _, v := range categories {
+		index(ctx, pipe, rebuildKey, categoryKind, v.ID, v.Name, 0)
+		for _, prefix := range namePrefixes(v.Name) {
+			built[rebuildKey(categoryKind, prefix)] = key(categoryKind, prefix)
+		}
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return err
+	}
+
+	live := make(map[string]bool, len(built))
+	for _, v := range built {
+		live[v] = true
+	}
+	pipe = ss.redisClient.Pipeline()
+	for _, kind := range []string{itemKind, categoryKind} {
+		iter := ss.redisClient.Scan(ctx, 0, key(kind, "*"), 1000).Iterator()
+		for iter.Next(ctx) {
+			if !live[iter.Val()] {
+				pipe.Del(ctx, iter.Val())
+			}
+		}
+		if err := iter.Err(); err != nil {
+			return err
+		}
+	}
+	for from, to := range built {
+		pipe.Rename(ctx, from, to)
+	}
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// deleteKeys deletes every key matching the pattern
+func (ss *SuggestService) deleteKeys(ctx context.Context, pattern string) error {
+	iter := ss.redisClient.Scan(ctx, 0, pattern, 1000).Iterator()
+	pipe := ss.redisClient.Pipeline()
+	for iter.Next(ctx) {
+		pipe.Del(ctx, iter.Val())
+	}
+	if err := iter.Err(); err != nil {
+		return err
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// Suggest returns the most popular item names, category names and past queries starting with
+// the prefix, or with a word starting with it
+func (ss *SuggestService) Suggest(prefix string) (*Suggestions, *errors.AppError) {
+	prefix = normalize(prefix)
+	if prefix == "" {
+		return nil, errors.NewError("invalid prefix", 400)
+	}
+	if runes := []rune(prefix); len(runes) > constants.MaxSuggestPrefixLength {
+		prefix = string(runes[:constants.MaxSuggestPrefixLength])
+	}
+	ctx, cancel := database.DBReqContext(5)
+	defer cancel()
+	pipe := ss.redisClient.Pipeline()
+	items := pipe.ZRevRange(ctx, key(itemKind, prefix), 0, constants.SuggestLimit-1)
+	categories := pipe.ZRevRange(ctx, key(categoryKind, prefix), 0, constants.SuggestLimit-1)
+	queries := pipe.ZRevRange(ctx, key(queryKind, prefix), 0, constants.SuggestLimit-1)
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, errors.ErrInternalServer
+	}
+	suggestions := &Suggestions{
+		Items:      parseMembers(items.Val()),
+		Categories: parseMembers(categories.Val()),
+		Queries:    queries.Val(),
+	}
+	if suggestions.Queries == nil {
+		suggestions.Queries = []string{}
+	}
+	return suggestions, nil
+}
+
+func parseMembers(members []string) []Suggestion {
+	suggestions := make([]Suggestion, 0, len(members))
+	for _, v := range members {
+		hex, name, ok := strings.Cut(v, ":")
+		if !ok {
+			continue
+		}
+		id, err := primitive.ObjectIDFromHex(hex)
+		if err != nil {
+			continue
+		}
+		suggestions = append(suggestions, Suggestion{ID: id, Name: name})
+	}
+	return suggestions
+}
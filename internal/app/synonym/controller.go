@@ -0,0 +1,91 @@
+package synonym
+
+import (
+	"net/http"
+
+	"github.com/ayo-ajayi/ecommerce/internal/errors"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type SynonymController struct {
+	synonymServices SynonymServices
+}
+
+type SynonymServices interface {
+	CreateSynonym(synonym *Synonym) *errors.AppError
+	UpdateSynonym(synonym *Synonym) *errors.AppError
+	DeleteSynonym(id string) *errors.AppError
+	GetSynonyms() ([]*Synonym, *errors.AppError)
+}
+
+func NewSynonymController(synonymServices SynonymServices) *SynonymController {
+	return &SynonymController{
+		synonymServices: synonymServices,
+	}
+}
+
+type synonymRequest struct {
+	Term     string   `json:"term" binding:"required"`
+	Synonyms []string `json:"synonyms" binding:"required"`
+}
+
+func (sc *SynonymController) CreateSynonym(c *gin.Context) {
+	userid := c.MustGet("userId").(primitive.ObjectID)
+	if userid.IsZero() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": "invalid user"}})
+		return
+	}
+	req := synonymRequest{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	synonym := &Synonym{Term: req.Term, Synonyms: req.Synonyms, CreatedBy: userid, UpdatedBy: userid}
+	if err := sc.synonymServices.CreateSynonym(synonym); err != nil {
+		c.JSON(err.StatusCode, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	c.JSON(201, gin.H{"message": "synonym created successfully", "data": gin.H{"synonym": synonym}})
+}
+
+func (sc *SynonymController) UpdateSynonym(c *gin.Context) {
+	synonymID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": "invalid synonym id"}})
+		return
+	}
+	userid := c.MustGet("userId").(primitive.ObjectID)
+	if userid.IsZero() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": "invalid user"}})
+		return
+	}
+	req := synonymRequest{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	synonym := &Synonym{ID: synonymID, Term: req.Term, Synonyms: req.Synonyms, UpdatedBy: userid}
+	if err := sc.synonymServices.UpdateSynonym(synonym); err != nil {
+		c.JSON(err.StatusCode, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	c.JSON(200, gin.H{"message": "synonym updated successfully", "data": gin.H{"synonym": synonym}})
+}
+
+func (sc *SynonymController) DeleteSynonym(c *gin.Context) {
+	if err := sc.synonymServices.DeleteSynonym(c.Param("id")); err != nil {
+		c.JSON(err.StatusCode, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	c.JSON(200, gin.H{"message": "synonym deleted successfully"})
+}
+
+func (sc *SynonymController) GetSynonyms(c *gin.Context) {
+	synonyms, err := sc.synonymServices.GetSynonyms()
+	if err != nil {
+		c.JSON(err.StatusCode, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	c.JSON(200, gin.H{"data": gin.H{"synonyms": synonyms}})
+}
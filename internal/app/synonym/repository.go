@@ -0,0 +1,70 @@
+package synonym
+
+import (
+	"github.com/ayo-ajayi/ecommerce/internal/database"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type SynonymRepo struct {
+	Collection *mongo.Collection
+}
+
+func NewSynonymRepo(collection *mongo.Collection) *SynonymRepo {
+	return &SynonymRepo{
+		Collection: collection,
+	}
+}
+
+// InitSynonymIndex makes terms unique
+func InitSynonymIndex(collection *mongo.Collection) error {
+	ctx, cancel := database.DBReqContext(5)
+	defer cancel()
+	_, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "term", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	return err
+}
+
+func (sr *SynonymRepo) CreateSynonym(synonym *Synonym) error {
+	ctx, cancel := database.DBReqContext(5)
+	defer cancel()
+	_, err := sr.Collection.InsertOne(ctx, synonym)
+	return err
+}
+
+func (sr *SynonymRepo) UpdateSynonym(filter interface{}, update interface{}, opts ...*options.UpdateOptions) (bool, error) {
+	ctx, cancel := database.DBReqContext(5)
+	defer cancel()
+	result, err := sr.Collection.UpdateOne(ctx, filter, update, opts...)
+	if err != nil {
+		return false, err
+	}
+	return result.MatchedCount > 0, nil
+}
+
+func (sr *SynonymRepo) GetSynonyms(filter interface{}, opts ...*options.FindOptions) ([]*Synonym, error) {
+	ctx, cancel := database.DBReqContext(5)
+	defer cancel()
+	var synonyms []*Synonym
+	cursor, err := sr.Collection.Find(ctx, filter, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if err := cursor.All(ctx, &synonyms); err != nil {
+		return nil, err
+	}
+	return synonyms, nil
+}
+
+func (sr *SynonymRepo) DeleteSynonym(filter interface{}, opts ...*options.DeleteOptions) (bool, error) {
+	ctx, cancel := database.DBReqContext(5)
+	defer cancel()
+	result, err := sr.Collection.DeleteOne(ctx, filter, opts...)
+	if err != nil {
+		return false, err
+	}
+	return result.DeletedCount > 0, nil
+}
@@ -0,0 +1,175 @@
+package synonym
+
+import (
+	"encoding/json"
+	"log"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/ayo-ajayi/ecommerce/internal/constants"
+	"github.com/ayo-ajayi/ecommerce/internal/database"
+	"github.com/ayo-ajayi/ecommerce/internal/errors"
+	"github.com/redis/go-redis/v9"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const synonymsCacheKey = "synonyms:all"
+
+type SynonymService struct {
+	synonymRepo SynonymRepository
+	redisClient *redis.Client
+}
+
+type SynonymRepository interface {
+	CreateSynonym(synonym *Synonym) error
+	UpdateSynonym(filter interface{}, update interface{}, opts ...*options.UpdateOptions) (bool, error)
+	GetSynonyms(filter interface{}, opts ...*options.FindOptions) ([]*Synonym, error)
+	DeleteSynonym(filter interface{}, opts ...*options.DeleteOptions) (bool, error)
+}
+
+func NewSynonymService(synonymRepo SynonymRepository, redisClient *redis.Client) *SynonymService {
+	return &SynonymService{
+		synonymRepo: synonymRepo,
+		redisClient: redisClient,
+	}
+}
+
+// normalize lowercases text and reduces it to words separated by single spaces
+func normalize(text string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}), " ")
+}
+
+func validateSynonym(synonym *Synonym) *errors.AppError {
+	synonym.Term = normalize(synonym.Term)
+	if synonym.Term == "" {
+		return errors.NewError("invalid term", 400)
+	}
+	synonyms := make([]string, 0, len(synonym.Synonyms))
+	seen := map[string]bool{synonym.Term: true}
+	for _, v := range synonym.Synonyms {
+		if v = normalize(v); v != "" && !seen[v] {
+			seen[v] = true
+			synonyms = append(synonyms, v)
+		}
+	}
+	if len(synonyms) == 0 {
+		return errors.NewError("a term needs at least one synonym", 400)
+	}
+	synonym.Synonyms = synonyms
+	return nil
+}
+
+func (ss *SynonymService) CreateSynonym(synonym *Synonym) *errors.AppError {
+	if err := validateSynonym(synonym); err != nil {
+		return err
+	}
+	synonym.CreatedAt = time.Now()
+	synonym.UpdatedAt = time.Now()
+	if err := ss.synonymRepo.CreateSynonym(synonym); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return errors.NewError("synonyms for this term already exist", 409)
+		}
+		return errors.NewError("internal error: "+err.Error(), 500)
+	}
+	ss.invalidateCache()
+	return nil
+}
+
+func (ss *SynonymService) UpdateSynonym(synonym *Synonym) *errors.AppError {
+	if err := validateSynonym(synonym); err != nil {
+		return err
+	}
+	synonym.UpdatedAt = time.Now()
+	matched, err := ss.synonymRepo.UpdateSynonym(bson.M{"_id": synonym.ID}, bson.M{"$set": bson.M{
+		"term":       synonym.Term,
+		"synonyms":   synonym.Synonyms,
+		"updated_by": synonym.UpdatedBy,
+		"updated_at": synonym.UpdatedAt,
+	}})
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return errors.NewError("synonyms for this term already exist", 409)
+		}
+		return errors.NewError("internal error: "+err.Error(), 500)
+	}
+	if !matched {
+		err := errors.ErrNotFound
+		return errors.NewError("synonym not found: "+err.Error(), err.StatusCode)
+	}
+	ss.invalidateCache()
+	return nil
+}
+
+func (ss *SynonymService) DeleteSynonym(id string) *errors.AppError {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return errors.ErrInvalidObjectID
+	}
+	deleted, err := ss.synonymRepo.DeleteSynonym(bson.M{"_id": objectID})
+	if err != nil {
+		return errors.NewError("internal error: "+err.Error(), 500)
+	}
+	if !deleted {
+		err := errors.ErrNotFound
+		return errors.NewError("synonym not found: "+err.Error(), err.StatusCode)
+	}
+	ss.invalidateCache()
+	return nil
+}
+
+func (ss *SynonymService) GetSynonyms() ([]*Synonym, *errors.AppError) {
+	ctx, cancel := database.DBReqContext(5)
+	defer cancel()
+	if cached, err := ss.redisClient.Get(ctx, synonymsCacheKey).Result(); err == nil {
+		var synonyms []*Synonym
+		if err := json.Unmarshal([]byte(cached), &synonyms); err == nil {
+			return synonyms, nil
+		}
+	} else if err != redis.Nil {
+		log.Println("failed to read synonyms cache: " + err.Error())
+	}
+	synonyms, err := ss.synonymRepo.GetSynonyms(bson.M{}, options.Find().SetSort(bson.D{{Key: "term", Value: 1}}))
+	if err != nil {
+		return nil, errors.ErrInternalServer
+	}
+	if synonyms == nil {
+		synonyms = []*Synonym{}
+	}
+	if data, err := json.Marshal(synonyms); err == nil {
+		if err := ss.redisClient.Set(ctx, synonymsCacheKey, data, time.Minute*time.Duration(constants.SynonymCacheValidityInMins)).Err(); err != nil {
+			log.Println("failed to cache synonyms: " + err.Error())
+		}
+	}
+	return synonyms, nil
+}
+
+func (ss *SynonymService) invalidateCache() {
+	ctx, cancel := database.DBReqContext(5)
+	defer cancel()
+	if err := ss.redisClient.Del(ctx, synonymsCacheKey).Err(); err != nil {
+		log.Println("failed to invalidate synonyms cache: " + err.Error())
+	}
+}
+
+// Expand returns the synonyms of every term found in the query. Terms of several words
+// match when the query contains them as a phrase.
+func (ss *SynonymService) Expand(query string) ([]string, *errors.AppError) {
+	synonyms, err := ss.GetSynonyms()
+	if err != nil {
+		return nil, err
+	}
+	query = " " + normalize(query) + " "
+	var expanded []string
+	for _, v := range synonyms {
+		if strings.Contains(query, " "+v.Term+" ") {
+			expanded = append(expanded, v.Synonyms...)
+		}
+	}
+	return expanded, nil
+}
@@ -0,0 +1,19 @@
+package synonym
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Synonym makes searches for Term also find Synonyms, e.g. "tee" also finds "t-shirt".
+// It works one way: searching a synonym does not find the term.
+type Synonym struct {
+	ID        primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Term      string             `json:"term" bson:"term"`
+	Synonyms  []string           `json:"synonyms" bson:"synonyms"`
+	CreatedBy primitive.ObjectID `json:"created_by" bson:"created_by,omitempty"`
+	UpdatedBy primitive.ObjectID `json:"updated_by" bson:"updated_by,omitempty"`
+	CreatedAt time.Time          `json:"created_at" bson:"created_at"`
+	UpdatedAt time.Time          `json:"updated_at" bson:"updated_at"`
+}
@@ -0,0 +1,77 @@
+package view
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/ayo-ajayi/ecommerce/internal/app/item"
+	"github.com/ayo-ajayi/ecommerce/internal/constants"
+	"github.com/ayo-ajayi/ecommerce/internal/errors"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type ViewController struct {
+	viewServices ViewServices
+}
+
+type ViewServices interface {
+	GetRecentlyViewed(userId primitive.ObjectID, visitorId string) ([]*item.Item, *errors.AppError)
+	GetVendorItemViews(vendorId primitive.ObjectID, days int) ([]*ItemViews, *errors.AppError)
+	GetTrendingItems(days, limit int) ([]*TrendingItem, *errors.AppError)
+}
+
+func NewViewController(viewServices ViewServices) *ViewController {
+	return &ViewController{
+		viewServices: viewServices,
+	}
+}
+
+func (vc *ViewController) GetRecentlyViewed(c *gin.Context) {
+	userid, _ := c.Get("userId")
+	userId, _ := userid.(primitive.ObjectID)
+	items, err := vc.viewServices.GetRecentlyViewed(userId, c.GetString("visitorId"))
+	if err != nil {
+		c.JSON(err.StatusCode, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	c.JSON(200, gin.H{"data": gin.H{"items": items}})
+}
+
+func (vc *ViewController) GetVendorItemViews(c *gin.Context) {
+	userid := c.MustGet("userId").(primitive.ObjectID)
+	if userid.IsZero() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": "invalid user"}})
+		return
+	}
+	days, err := strconv.Atoi(c.DefaultQuery("days", "30"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": "invalid number of days"}})
+		return
+	}
+	views, appErr := vc.viewServices.GetVendorItemViews(userid, days)
+	if appErr != nil {
+		c.JSON(appErr.StatusCode, gin.H{"error": gin.H{"message": appErr.Error()}})
+		return
+	}
+	c.JSON(200, gin.H{"data": gin.H{"items": views}})
+}
+
+func (vc *ViewController) GetTrendingItems(c *gin.Context) {
+	days, err := strconv.Atoi(c.DefaultQuery("days", strconv.Itoa(constants.TrendingItemsDefaultDays)))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": "invalid number of days"}})
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(constants.TrendingItemsLimit)))
+	if err != nil || limit > constants.TrendingItemsLimit {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": "invalid limit"}})
+		return
+	}
+	items, appErr := vc.viewServices.GetTrendingItems(days, limit)
+	if appErr != nil {
+		c.JSON(appErr.StatusCode, gin.H{"error": gin.H{"message": appErr.Error()}})
+		return
+	}
+	c.JSON(200, gin.H{"data": gin.H{"items": items}})
+}
@@ -0,0 +1,64 @@
+package view
+
+import (
+	"errors"
+
+	"github.com/ayo-ajayi/ecommerce/internal/database"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type ViewStatRepo struct {
+	Collection *mongo.Collection
+}
+
+func NewViewStatRepo(collection *mongo.Collection) *ViewStatRepo {
+	return &ViewStatRepo{
+		Collection: collection,
+	}
+}
+
+func InitViewStatIndex(collection *mongo.Collection) error {
+	ctx, cancel := database.DBReqContext(5)
+	defer cancel()
+	_, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "item_id", Value: 1}, {Key: "date", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return errors.New("Error creating unique index for view stat collection:" + err.Error())
+	}
+	return nil
+}
+
+func (vr *ViewStatRepo) UpdateViewStat(filter interface{}, update interface{}, opts ...*options.UpdateOptions) error {
+	ctx, cancel := database.DBReqContext(5)
+	defer cancel()
+	_, err := vr.Collection.UpdateOne(ctx, filter, update, opts...)
+	return err
+}
+
+func (vr *ViewStatRepo) GetViewStats(filter interface{}, opts ...*options.FindOptions) ([]*ViewStat, error) {
+	ctx, cancel := database.DBReqContext(5)
+	defer cancel()
+	var stats []*ViewStat
+	cursor, err := vr.Collection.Find(ctx, filter, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if err := cursor.All(ctx, &stats); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+func (vr *ViewStatRepo) Aggregate(pipeline interface{}, result interface{}) error {
+	ctx, cancel := database.DBReqContext(5)
+	defer cancel()
+	cursor, err := vr.Collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return err
+	}
+	return cursor.All(ctx, result)
+}
@@ -0,0 +1,232 @@
+package view
+
+import (
+	"log"
+	"time"
+
+	"github.com/ayo-ajayi/ecommerce/internal/app/item"
+	"github.com/ayo-ajayi/ecommerce/internal/constants"
+	"github.com/ayo-ajayi/ecommerce/internal/database"
+	"github.com/ayo-ajayi/ecommerce/internal/errors"
+	"github.com/redis/go-redis/v9"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type ViewService struct {
+	viewStatRepo ViewStatRepository
+	itemRepo     ItemRepository
+	itemPreparer ItemPreparer
+	redisClient  *redis.Client
+	viewChan     chan viewEvent
+}
+
+type ViewStatRepository interface {
+	UpdateViewStat(filter interface{}, update interface{}, opts ...*options.UpdateOptions) error
+	GetViewStats(filter interface{}, opts ...*options.FindOptions) ([]*ViewStat, error)
+	Aggregate(pipeline interface{}, result interface{}) error
+}
+
+type ItemRepository interface {
+	GetItems(filter interface{}, opts ...*options.FindOptions) ([]*item.Item, error)
+	UpdateItem(filter interface{}, update interface{}, opts ...*options.UpdateOptions) error
+}
+
+// ItemPreparer fills in an item's effective price and computed stock
+type ItemPreparer interface {
+	PrepareItems(items ...*item.Item) *errors.AppError
+}
+
+func NewViewService(viewStatRepo ViewStatRepository, itemRepo ItemRepository, itemPreparer ItemPreparer, redisClient *redis.Client) *ViewService {
+	vs := &ViewService{
+		viewStatRepo: viewStatRepo,
+		itemRepo:     itemRepo,
+		itemPreparer: itemPreparer,
+		redisClient:  redisClient,
+		viewChan:     make(chan viewEvent, 1000),
+	}
+	go vs.processViews()
+	return vs
+}
+
+// RecordView queues a view of the item by a signed in user or, failing that, an anonymous
+// visitor. It never blocks the request: views are dropped when the queue is full.
+func (vs *ViewService) RecordView(it *item.Item, userId primitive.ObjectID, visitorId string) {
+	if !userId.IsZero() && userId == it.VendorID {
+		return
+	}
+	viewerKey := recentlyViewedKey(userId, visitorId)
+	select {
+	case vs.viewChan <- viewEvent{itemID: it.ID, viewerKey: viewerKey}:
+	default:
+		log.Println("view queue is full, dropping view of item " + it.ID.Hex())
+	}
+}
+
+func (vs *ViewService) processViews() {
+	for v := range vs.viewChan {
+		if err := vs.saveView(v); err != nil {
+			log.Println("failed to record view: " + err.Error())
+		}
+	}
+}
+
+func (vs *ViewService) saveView(v viewEvent) error {
+	if err := vs.itemRepo.UpdateItem(bson.M{"_id": v.itemID}, bson.M{"$inc": bson.M{"view_count": 1}}); err != nil {
+		return err
+	}
+	date := time.Now().UTC().Format("2006-01-02")
+	if err := vs.viewStatRepo.UpdateViewStat(bson.M{"item_id": v.itemID, "date": date}, bson.M{"$inc": bson.M{"views": 1}}, options.Update().SetUpsert(true)); err != nil {
+		return err
+	}
+	if v.viewerKey == "" {
+		return nil
+	}
+	// most recent first, each item once, capped and expiring with inactivity
+	ctx, cancel := database.DBReqContext(5)
+	defer cancel()
+	pipe := vs.redisClient.TxPipeline()
+	pipe.LRem(ctx, v.viewerKey, 0, v.itemID.Hex())
+	pipe.LPush(ctx, v.viewerKey, v.itemID.Hex())
+	pipe.LTrim(ctx, v.viewerKey, 0, constants.RecentlyViewedLimit-1)
+	pipe.Expire(ctx, v.viewerKey, time.Hour*24*time.Duration(constants.RecentlyViewedValidityInDays))
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func recentlyViewedKey(userId primitive.ObjectID, visitorId string) string {
+	if !userId.IsZero() {
+		return "recently_viewed:user:" + userId.Hex()
+	}
+	if visitorId != "" {
+		return "recently_viewed:visitor:" + visitorId
+	}
+	return ""
+}
+
+// GetRecentlyViewed returns the items last viewed by the user or visitor, most recent first.
+// Items that have since been deleted or made drafts are left out.
+func (vs *ViewService) GetRecentlyViewed(userId primitive.ObjectID, visitorId string) ([]*item.Item, *errors.AppError) {
+	key := recentlyViewedKey(userId, visitorId)
+	if key == "" {
+		return []*item.Item{}, nil
+	}
+	ctx, cancel := database.DBReqContext(5)
+	defer cancel()
+	hexIDs, err := vs.redisClient.LRange(ctx, key, 0, constants.RecentlyViewedLimit-1).Result()
+	if err != nil {
+		return nil, errors.ErrInternalServer
+	}
+	itemIDs := make([]primitive.ObjectID, 0, len(hexIDs))
+	for _, v := range hexIDs {
+		if id, err := primitive.ObjectIDFromHex(v); err == nil {
+			itemIDs = append(itemIDs, id)
+		}
+	}
+	return vs.getItemsInOrder(itemIDs)
+}
+
+// getItemsInOrder fetches the published items with the given ids, keeping the order of ids
+func (vs *ViewService) getItemsInOrder(itemIDs []primitive.ObjectID) ([]*item.Item, *errors.AppError) {
+	ordered := []*item.Item{}
+	if len(itemIDs) == 0 {
+		return ordered, nil
+	}
+	items, err := vs.itemRepo.GetItems(bson.M{"_id": bson.M{"$in": itemIDs}, "status": bson.M{"$ne": item.Draft}})
+	if err != nil {
+		return nil, errors.ErrInternalServer
+	}
+	if err := vs.itemPreparer.PrepareItems(items...); err != nil {
+		return nil, err
+	}
+	itemsByID := make(map[primitive.ObjectID]*item.Item, len(items))
+	for _, v := range items {
+		itemsByID[v.ID] = v
+	}
+	for _, id := range itemIDs {
+		if it, ok := itemsByID[id]; ok {
+			ordered = append(ordered, it)
+		}
+	}
+	return ordered, nil
+}
+
+// GetVendorItemViews returns the total views of each of the vendor's items and their daily views over the last days
+func (vs *ViewService) GetVendorItemViews(vendorId primitive.ObjectID, days int) ([]*ItemViews, *errors.AppError) {
+	if days < 1 {
+		return nil, errors.NewError("invalid number of days", 400)
+	}
+	items, err := vs.itemRepo.GetItems(bson.M{"vendor_id": vendorId}, options.Find().SetProjection(bson.M{"name": 1, "view_count": 1}))
+	if err != nil {
+		return nil, errors.ErrInternalServer
+	}
+	views := make([]*ItemViews, 0, len(items))
+	if len(items) == 0 {
+		return views, nil
+	}
+	itemIDs := make([]primitive.ObjectID, 0, len(items))
+	viewsByID := make(map[primitive.ObjectID]*ItemViews, len(items))
+	for _, v := range items {
+		itemIDs = append(itemIDs, v.ID)
+		iv := &ItemViews{ItemID: v.ID, Name: v.Name, ViewCount: v.ViewCount, Daily: []ViewStat{}}
+		viewsByID[v.ID] = iv
+		views = append(views, iv)
+	}
+	stats, err := vs.viewStatRepo.GetViewStats(bson.M{
+		"item_id": bson.M{"$in": itemIDs},
+		"date":    bson.M{"$gte": since(days)},
+	}, options.Find().SetSort(bson.D{{Key: "date", Value: 1}}))
+	if err != nil {
+		return nil, errors.ErrInternalServer
+	}
+	for _, v := range stats {
+		if iv, ok := viewsByID[v.ItemID]; ok {
+			iv.Daily = append(iv.Daily, *v)
+		}
+	}
+	return views, nil
+}
+
+// GetTrendingItems returns the most viewed published, in-stock items over the last days
+func (vs *ViewService) GetTrendingItems(days, limit int) ([]*TrendingItem, *errors.AppError) {
+	if days < 1 || limit < 1 {
+		return nil, errors.NewError("invalid number of days or limit", 400)
+	}
+	var totals []struct {
+		ItemID primitive.ObjectID `bson:"_id"`
+		Views  int                `bson:"views"`
+	}
+	// over-fetch so there are still enough once drafts and out-of-stock items are dropped
+	pipeline := []bson.M{
+		{"$match": bson.M{"date": bson.M{"$gte": since(days)}}},
+		{"$group": bson.M{"_id": "$item_id", "views": bson.M{"$sum": "$views"}}},
+		{"$sort": bson.D{{Key: "views", Value: -1}, {Key: "_id", Value: 1}}},
+		{"$limit": limit * 2},
+	}
+	if err := vs.viewStatRepo.Aggregate(pipeline, &totals); err != nil {
+		return nil, errors.ErrInternalServer
+	}
+	itemIDs := make([]primitive.ObjectID, 0, len(totals))
+	recentViews := make(map[primitive.ObjectID]int, len(totals))
+	for _, v := range totals {
+		itemIDs = append(itemIDs, v.ItemID)
+		recentViews[v.ItemID] = v.Views
+	}
+	items, appErr := vs.getItemsInOrder(itemIDs)
+	if appErr != nil {
+		return nil, appErr
+	}
+	trending := []*TrendingItem{}
+	for _, v := range items {
+		if v.InStock() && len(trending) < limit {
+			trending = append(trending, &TrendingItem{Item: v, RecentViews: recentViews[v.ID]})
+		}
+	}
+	return trending, nil
+}
+
+// since is the first date, in view stat format, of a window of days ending today
+func since(days int) string {
+	return time.Now().UTC().AddDate(0, 0, 1-days).Format("2006-01-02")
+}
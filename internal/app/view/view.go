@@ -0,0 +1,31 @@
+package view
+
+import (
+	"github.com/ayo-ajayi/ecommerce/internal/app/item"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ViewStat is the number of views an item had on one day (UTC, formatted 2006-01-02)
+type ViewStat struct {
+	ID     primitive.ObjectID `json:"-" bson:"_id,omitempty"`
+	ItemID primitive.ObjectID `json:"item_id" bson:"item_id"`
+	Date   string             `json:"date" bson:"date"`
+	Views  int                `json:"views" bson:"views"`
+}
+
+type ItemViews struct {
+	ItemID    primitive.ObjectID `json:"item_id"`
+	Name      string             `json:"name"`
+	ViewCount int                `json:"view_count"`
+	Daily     []ViewStat         `json:"daily"`
+}
+
+type TrendingItem struct {
+	*item.Item
+	RecentViews int `json:"recent_views"`
+}
+
+type viewEvent struct {
+	itemID    primitive.ObjectID
+	viewerKey string
+}
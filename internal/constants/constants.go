@@ -6,3 +6,50 @@ const SignUpOtpValidityInSecs = uint(300)
 const ForgotPasswordOtpValidityInSecs = uint(300)
 const RedisDBValue = 1
 const ServerPort = "8080"
+const DownloadLinkValidityInHours = int64(24)
+const DownloadFileURLValidityInMins = int64(5)
+const DefaultMaxDownloads = 5
+const CoPurchaseJobIntervalInHours = int64(6)
+const MaxCoPurchasesPerItem = 20
+const RelatedItemsLimit = 8
+const RelatedItemsCacheValidityInMins = int64(30)
+const VisitorIDValidityInDays = int64(365)
+const RecentlyViewedLimit = 20
+const RecentlyViewedValidityInDays = int64(30)
+const TrendingItemsDefaultDays = 7
+const TrendingItemsLimit = 20
+const MaxQuestionLength = 1000
+const AnswersPerQuestionPreview = 3
+const MaxSlugAttempts = 5
+const MaxImageSaveAttempts = 5
+const CategoryCacheValidityInMins = int64(60)
+const MaxCategoryDepth = 5
+const DefaultCategoryName = "Uncategorized"
+const SearchNameWeight = 10
+const SearchTagsWeight = 5
+const SearchDescriptionWeight = 1
+const SearchCategoriesLimit = int64(5)
+const MaxSearchQueryLength = 200
+const SearchFacetLimit = 10
+const MaxSearchCandidates = 1000
+const SuggestLimit = 5
+const MaxSuggestPrefixLength = 20
+const MaxSuggestQueriesPerPrefix = 50
+const MaxRecordedQueriesPerClient = 30
+const RecordedQueriesWindowInMins = int64(60)
+const SynonymCacheValidityInMins = int64(60)
+const SearchVocabularyRefreshInMins = int64(30)
+const SearchIndexRebuildInMins = int64(30)
+const MongoSearchBackend = "mongo"
+const MemorySearchBackend = "memory"
+const SearchLogValidityInDays = 90
+const SearchReportDefaultDays = 30
+const SearchReportLimit = 50
+const MinSearchesForClickThrough = 5
+const LowClickThroughRate = 0.1
+const ReviewHoldAccountAgeInDays = 7
+const ReviewReportHoldThreshold = 3
+const MaxReviewReportDetailsLength = 500
+const MaxReviewReplyLength = 1000
+const MaxImagesPerUpload = 5
+const MaxImageSizeInMB = int64(5)
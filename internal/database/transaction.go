@@ -0,0 +1,34 @@
+package database
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Transactor runs functions in MongoDB transactions, which need a replica set or sharded cluster
+type Transactor struct {
+	client *mongo.Client
+}
+
+func NewTransactor(client *mongo.Client) *Transactor {
+	return &Transactor{
+		client: client,
+	}
+}
+
+// WithTransaction runs fn in a transaction, retrying it on transient errors. Repository methods
+// that take a context are part of the transaction when given the context fn is called with.
+func (t *Transactor) WithTransaction(fn func(ctx context.Context) error) error {
+	ctx, cancel := DBReqContext(10)
+	defer cancel()
+	session, err := t.client.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sc)
+	})
+	return err
+}
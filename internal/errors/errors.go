@@ -24,6 +24,7 @@ var (
 	ErrInvalidObjectID        = NewError("invalid object id", 400)
 	ErrCategoryAlreadyExists  = NewError("category already exists", 400)
 	ErrUserAlreadyVerified    = NewError("user already verified", 409)
+	ErrVersionConflict        = NewError("version conflict: it was changed by someone else, reload it and try again", 409)
 )
 
 func (e *AppError) Error() string {
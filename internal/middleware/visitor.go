@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"github.com/ayo-ajayi/ecommerce/internal/constants"
+	"github.com/ayo-ajayi/ecommerce/internal/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// OptionalAuthentication sets userId like Authentication when a valid access token is sent,
+// and lets the request through anonymously otherwise
+func (m *Middleware) OptionalAuthentication() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := extractToken(c.Request)
+		if token == "" {
+			c.Next()
+			return
+		}
+		jwtToken, err := utils.ValidateToken(token, m.accessTokenSecretKey)
+		if err != nil {
+			c.Next()
+			return
+		}
+		td, err := utils.ExtractTokenDetails(jwtToken)
+		if err != nil {
+			c.Next()
+			return
+		}
+		if userId, err := m.middlewareTokenRepo.FindToken(td.AccessUuid); err == nil && userId == td.UserId.Hex() {
+			c.Set("userId", td.UserId)
+			c.Set("accessUuid", td.AccessUuid)
+		}
+		c.Next()
+	}
+}
+
+// Visitor identifies anonymous browsers. The id is read from the X-Visitor-ID header or the
+// visitor_id cookie, and a new one is issued in both when neither holds a valid id.
+func (m *Middleware) Visitor() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		visitorId := c.GetHeader("X-Visitor-ID")
+		if visitorId == "" {
+			visitorId, _ = c.Cookie("visitor_id")
+		}
+		if _, err := uuid.Parse(visitorId); err != nil {
+			visitorId = uuid.New().String()
+			c.SetCookie("visitor_id", visitorId, int(constants.VisitorIDValidityInDays*24*60*60), "/", "", false, true)
+		}
+		c.Header("X-Visitor-ID", visitorId)
+		c.Set("visitorId", visitorId)
+		c.Next()
+	}
+}
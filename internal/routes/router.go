@@ -3,15 +3,28 @@ package router
 import (
 	"log"
 	"sync"
+	"time"
 
 	"os"
+	"strconv"
+	"strings"
 
 	"github.com/ayo-ajayi/ecommerce/internal/app/cart"
 	"github.com/ayo-ajayi/ecommerce/internal/app/category"
+	"github.com/ayo-ajayi/ecommerce/internal/app/collection"
+	"github.com/ayo-ajayi/ecommerce/internal/app/delivery"
 	"github.com/ayo-ajayi/ecommerce/internal/app/item"
+	"github.com/ayo-ajayi/ecommerce/internal/app/order"
+	"github.com/ayo-ajayi/ecommerce/internal/app/question"
+	"github.com/ayo-ajayi/ecommerce/internal/app/recommendation"
 	"github.com/ayo-ajayi/ecommerce/internal/app/review"
+	"github.com/ayo-ajayi/ecommerce/internal/app/sale"
 	"github.com/ayo-ajayi/ecommerce/internal/app/search"
+	"github.com/ayo-ajayi/ecommerce/internal/app/searchlog"
+	"github.com/ayo-ajayi/ecommerce/internal/app/suggest"
+	"github.com/ayo-ajayi/ecommerce/internal/app/synonym"
 	"github.com/ayo-ajayi/ecommerce/internal/app/user"
+	"github.com/ayo-ajayi/ecommerce/internal/app/view"
 	"github.com/ayo-ajayi/ecommerce/internal/constants"
 	"github.com/ayo-ajayi/ecommerce/internal/database"
 	mw "github.com/ayo-ajayi/ecommerce/internal/middleware"
@@ -32,6 +45,8 @@ func NewRouter() *gin.Engine {
 	accessTokenSecretKey := os.Getenv("ACCESS_TOKEN_SECRET_KEY")
 	refreshTokenSecretKey := os.Getenv("REFRESH_TOKEN_SECRET_KEY")
 	cloudinaryURI := os.Getenv("CLOUDINARY_URI")
+	downloadURLSecretKey := os.Getenv("DOWNLOAD_URL_SECRET_KEY")
+	apiBaseURL := os.Getenv("API_BASE_URL")
 
 	if redisUri == "" ||
 		mongoDBUri == "" ||
@@ -41,7 +56,8 @@ func NewRouter() *gin.Engine {
 		emailApiKey == "" ||
 		emailSenderName == "" ||
 		accessTokenSecretKey == "" ||
-		refreshTokenSecretKey == "" || cloudinaryURI == "" {
+		refreshTokenSecretKey == "" || cloudinaryURI == "" ||
+		downloadURLSecretKey == "" || apiBaseURL == "" {
 		log.Fatal("environment variables not set")
 	}
 
@@ -50,6 +66,42 @@ func NewRouter() *gin.Engine {
 	signUpOtpValidityInSecs := constants.SignUpOtpValidityInSecs
 	forgotPasswordOtpValidityInSecs := constants.ForgotPasswordOtpValidityInSecs
 	redisDBValue := constants.RedisDBValue
+	maxCategoryDepth := constants.MaxCategoryDepth
+	if v := os.Getenv("MAX_CATEGORY_DEPTH"); v != "" {
+		depth, err := strconv.Atoi(v)
+		if err != nil || depth < 1 {
+			log.Fatal("invalid MAX_CATEGORY_DEPTH")
+		}
+		maxCategoryDepth = depth
+	}
+	reviewModerationRules := &review.ModerationRules{
+		MinAccountAgeDays: constants.ReviewHoldAccountAgeInDays,
+		ReportThreshold:   constants.ReviewReportHoldThreshold,
+	}
+	if v := os.Getenv("REVIEW_BANNED_WORDS"); v != "" {
+		reviewModerationRules.BannedWords = strings.Split(v, ",")
+	}
+	if v := os.Getenv("REVIEW_HOLD_ACCOUNT_AGE_DAYS"); v != "" {
+		days, err := strconv.Atoi(v)
+		if err != nil || days < 0 {
+			log.Fatal("invalid REVIEW_HOLD_ACCOUNT_AGE_DAYS")
+		}
+		reviewModerationRules.MinAccountAgeDays = days
+	}
+	if v := os.Getenv("REVIEW_REPORT_HOLD_THRESHOLD"); v != "" {
+		threshold, err := strconv.Atoi(v)
+		if err != nil || threshold < 0 {
+			log.Fatal("invalid REVIEW_REPORT_HOLD_THRESHOLD")
+		}
+		reviewModerationRules.ReportThreshold = threshold
+	}
+	searchBackend := os.Getenv("SEARCH_BACKEND")
+	if searchBackend == "" {
+		searchBackend = constants.MongoSearchBackend
+	}
+	if searchBackend != constants.MongoSearchBackend && searchBackend != constants.MemorySearchBackend {
+		log.Fatal("invalid SEARCH_BACKEND")
+	}
 
 	client, err := database.NewMongoDBClient(mongoDBUri)
 	if err != nil {
@@ -58,9 +110,24 @@ func NewRouter() *gin.Engine {
 	userCollection := database.NewMongoDBCollection(client, mongoDBName, "users")
 	otpCollection := database.NewMongoDBCollection(client, mongoDBName, "otps")
 	categoryCollection := database.NewMongoDBCollection(client, mongoDBName, "categories")
+	deletedCategoryCollection := database.NewMongoDBCollection(client, mongoDBName, "deleted_categories")
 	itemCollection := database.NewMongoDBCollection(client, mongoDBName, "items")
 	reviewCollection := database.NewMongoDBCollection(client, mongoDBName, "reviews")
+	reviewReportCollection := database.NewMongoDBCollection(client, mongoDBName, "review_reports")
+	reviewModerationLogCollection := database.NewMongoDBCollection(client, mongoDBName, "review_moderation_logs")
+	reviewVoteCollection := database.NewMongoDBCollection(client, mongoDBName, "review_votes")
 	cartCollection := database.NewMongoDBCollection(client, mongoDBName, "carts")
+	saleCollection := database.NewMongoDBCollection(client, mongoDBName, "sales")
+	orderCollection := database.NewMongoDBCollection(client, mongoDBName, "orders")
+	licenseKeyCollection := database.NewMongoDBCollection(client, mongoDBName, "license_keys")
+	coPurchaseCollection := database.NewMongoDBCollection(client, mongoDBName, "co_purchases")
+	viewStatCollection := database.NewMongoDBCollection(client, mongoDBName, "view_stats")
+	questionCollection := database.NewMongoDBCollection(client, mongoDBName, "questions")
+	answerCollection := database.NewMongoDBCollection(client, mongoDBName, "answers")
+	answerVoteCollection := database.NewMongoDBCollection(client, mongoDBName, "answer_votes")
+	collectionCollection := database.NewMongoDBCollection(client, mongoDBName, "collections")
+	synonymCollection := database.NewMongoDBCollection(client, mongoDBName, "synonyms")
+	searchLogCollection := database.NewMongoDBCollection(client, mongoDBName, "search_logs")
 
 	otpManager := utils.NewOTPManager(otpCollection, otpIssuer, signUpOtpValidityInSecs, forgotPasswordOtpValidityInSecs)
 
@@ -77,24 +144,79 @@ func NewRouter() *gin.Engine {
 	userService := user.NewUserService(userRepo, otpManager, emailManager, tokenManager)
 	userController := user.NewUserController(userService)
 
+	itemRepo := item.NewItemRepo(itemCollection)
+
 	categoryRepo := category.NewCategoryRepo(categoryCollection)
-	categoryService := category.NewCategoryService(categoryRepo)
+	deletedCategoryRepo := category.NewDeletedCategoryRepo(deletedCategoryCollection)
+	transactor := database.NewTransactor(client)
+	categoryService := category.NewCategoryService(categoryRepo, deletedCategoryRepo, itemRepo, transactor, redisClient, maxCategoryDepth)
 	categoryController := category.NewCategoryController(categoryService, mediaCloudManager)
 
-	itemRepo := item.NewItemRepo(itemCollection)
-	itemService := item.NewItemService(itemRepo, categoryRepo, mediaCloudManager)
-	itemController := item.NewItemController(itemService)
+	saleRepo := sale.NewSaleRepo(saleCollection)
+	saleService := sale.NewSaleService(saleRepo)
+	saleController := sale.NewSaleController(saleService)
+
+	itemService := item.NewItemService(itemRepo, categoryRepo, mediaCloudManager, saleService, categoryService)
+	viewStatRepo := view.NewViewStatRepo(viewStatCollection)
+	viewService := view.NewViewService(viewStatRepo, itemRepo, itemService, redisClient)
+	viewController := view.NewViewController(viewService)
+	itemController := item.NewItemController(itemService, viewService)
 
 	cartRepo := cart.NewCartRepo(cartCollection)
-	cartService := cart.NewCartService(cartRepo, itemRepo)
+	cartService := cart.NewCartService(cartRepo, itemRepo, saleService, transactor)
 	cartController := cart.NewCartController(cartService)
 
+	orderRepo := order.NewOrderRepo(orderCollection)
+	licenseKeyRepo := delivery.NewLicenseKeyRepo(licenseKeyCollection)
+	urlSigner := utils.NewURLSigner(downloadURLSecretKey)
+	deliveryService := delivery.NewDeliveryService(licenseKeyRepo, itemRepo, orderRepo, userRepo, emailManager, urlSigner, mediaCloudManager, apiBaseURL)
+	deliveryController := delivery.NewDeliveryController(deliveryService)
+	orderService := order.NewOrderService(orderRepo, cartRepo, itemRepo, userRepo, saleService, deliveryService, licenseKeyRepo, transactor)
+	orderController := order.NewOrderController(orderService)
+
+	coPurchaseRepo := recommendation.NewCoPurchaseRepo(coPurchaseCollection)
+	recommendationService := recommendation.NewRecommendationService(coPurchaseRepo, orderRepo, itemRepo, itemService, redisClient)
+	recommendationController := recommendation.NewRecommendationController(recommendationService)
+
 	reviewRepo := review.NewReviewRepo(reviewCollection)
-	reviewService := review.NewReviewService(reviewRepo, userRepo)
+	reviewReportRepo := review.NewReportRepo(reviewReportCollection)
+	reviewModerationLogRepo := review.NewModerationLogRepo(reviewModerationLogCollection)
+	reviewVoteRepo := review.NewVoteRepo(reviewVoteCollection)
+	reviewService := review.NewReviewService(reviewRepo, userRepo, itemRepo, orderRepo, reviewReportRepo, reviewModerationLogRepo, reviewVoteRepo, mediaCloudManager, emailManager, transactor, reviewModerationRules)
 	reviewController := review.NewReviewController(reviewService)
 
+	questionRepo := question.NewQuestionRepo(questionCollection)
+	answerRepo := question.NewAnswerRepo(answerCollection)
+	answerVoteRepo := question.NewAnswerVoteRepo(answerVoteCollection)
+	questionService := question.NewQuestionService(questionRepo, answerRepo, answerVoteRepo, itemRepo, orderRepo, userRepo, transactor)
+	questionController := question.NewQuestionController(questionService)
+
+	collectionRepo := collection.NewCollectionRepo(collectionCollection)
+	collectionService := collection.NewCollectionService(collectionRepo, itemRepo, categoryRepo, categoryService, itemService, mediaCloudManager)
+	collectionController := collection.NewCollectionController(collectionService)
+
 	middleware := mw.NewMiddleware(accessTokenSecretKey, tokenManager, userRepo)
-	searchController := search.NewSearchController(itemRepo, categoryRepo)
+	suggestService := suggest.NewSuggestService(redisClient, itemRepo, categoryRepo)
+	itemService.AddHook(suggestService)
+	categoryService.AddHook(suggestService)
+	suggestController := suggest.NewSuggestController(suggestService)
+	synonymRepo := synonym.NewSynonymRepo(synonymCollection)
+	synonymService := synonym.NewSynonymService(synonymRepo, redisClient)
+	synonymController := synonym.NewSynonymController(synonymService)
+	vocabulary := search.NewVocabulary(itemRepo, categoryRepo)
+	var searchEngine search.SearchEngine = search.NewMongoEngine(itemRepo, categoryRepo)
+	var memoryEngine *search.MemoryEngine
+	if searchBackend == constants.MemorySearchBackend {
+		memoryEngine = search.NewMemoryEngine(itemRepo, categoryRepo)
+		searchEngine = memoryEngine
+	}
+	searchIndexHook := search.NewIndexHook(searchEngine)
+	itemService.AddHook(searchIndexHook)
+	categoryService.AddHook(searchIndexHook)
+	searchLogRepo := searchlog.NewSearchLogRepo(searchLogCollection)
+	searchLogService := searchlog.NewSearchLogService(searchLogRepo)
+	searchLogController := searchlog.NewSearchLogController(searchLogService)
+	searchController := search.NewSearchController(searchEngine, categoryRepo, userRepo, categoryService, itemService, suggestService, synonymService, vocabulary, searchLogService)
 
 	ctx, cancel := database.DBReqContext(10)
 	defer cancel()
@@ -119,19 +241,64 @@ func NewRouter() *gin.Engine {
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		if err := search.InitSearchIndex(itemCollection, categoryCollection); err != nil {
+		if searchBackend == constants.MongoSearchBackend {
+			if err := search.InitSearchIndex(itemCollection, categoryCollection); err != nil {
+				log.Fatal(err.Error())
+			}
+		}
+		if err := utils.InitSlugIndex(itemCollection); err != nil {
+			log.Fatal(err.Error())
+		}
+		if err := utils.InitSlugIndex(categoryCollection); err != nil {
+			log.Fatal(err.Error())
+		}
+		if err := categoryService.SeedDefaultCategory(); err != nil {
 			log.Fatal(err.Error())
 		}
 		if err := utils.InitOtpExpiryIndex(otpCollection); err != nil {
 			log.Fatal(err.Error())
 		}
+		if err := delivery.InitLicenseKeyIndex(licenseKeyCollection); err != nil {
+			log.Fatal(err.Error())
+		}
+		if err := view.InitViewStatIndex(viewStatCollection); err != nil {
+			log.Fatal(err.Error())
+		}
+		if err := question.InitAnswerVoteIndex(answerVoteCollection); err != nil {
+			log.Fatal(err.Error())
+		}
+		if err := synonym.InitSynonymIndex(synonymCollection); err != nil {
+			log.Fatal(err.Error())
+		}
+		if err := searchlog.InitSearchLogIndex(searchLogCollection); err != nil {
+			log.Fatal(err.Error())
+		}
+		if err := review.InitReviewIndex(reviewCollection); err != nil {
+			log.Fatal(err.Error())
+		}
+		if err := review.InitReportIndex(reviewReportCollection); err != nil {
+			log.Fatal(err.Error())
+		}
+		if err := review.InitVoteIndex(reviewVoteCollection); err != nil {
+			log.Fatal(err.Error())
+		}
 	}()
 	wg.Wait()
+	go recommendationService.RunCoPurchaseJob(time.Hour * time.Duration(constants.CoPurchaseJobIntervalInHours))
+	go vocabulary.RunVocabularyJob(time.Minute * time.Duration(constants.SearchVocabularyRefreshInMins))
+	go func() {
+		if err := suggestService.RebuildIndex(); err != nil {
+			log.Println("failed to rebuild suggestions: " + err.Error())
+		}
+	}()
+	if memoryEngine != nil {
+		go memoryEngine.RunRebuildJob(time.Minute * time.Duration(constants.SearchIndexRebuildInMins))
+	}
 	router := gin.Default()
 	router.Use(middleware.JsonMiddleware(), cors.New(cors.Options{
 		AllowedOrigins:   []string{"*"},
 		AllowCredentials: true,
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
 		AllowedHeaders:   []string{"*"},
 	}))
 	router.GET("/favicon.ico", func(ctx *gin.Context) { ctx.File("./favicon.ico") })
@@ -148,7 +315,10 @@ func NewRouter() *gin.Engine {
 		api.POST("/reset-password", userController.ResetPassword)
 		api.POST("/refresh-token", userController.RefreshToken)
 		api.POST("/resend-verification-otp", userController.ResendEmailVerificationOTP)
-		api.GET("/search", searchController.Search)
+		api.GET("/search", middleware.OptionalAuthentication(), middleware.Visitor(), searchController.Search)
+		api.POST("/search/click", middleware.OptionalAuthentication(), middleware.Visitor(), searchLogController.RecordClick)
+		api.GET("/search/suggest", suggestController.Suggest)
+		api.GET("/download", deliveryController.Download)
 
 	}
 	all := api.Group("")
@@ -156,11 +326,24 @@ func NewRouter() *gin.Engine {
 		all.GET("/category/:id", categoryController.GetCategoryByID)
 		all.GET("/category/slug/:slug", categoryController.GetCategoryBySlug)
 		all.GET("/categories", categoryController.GetCategories)
-		all.GET("/item/:id", itemController.GetItemByID)
+		all.GET("/categories/tree", categoryController.GetCategoryTree)
+		all.GET("/category/:id/children", categoryController.GetChildren)
+		all.GET("/category/:id/breadcrumbs", categoryController.GetBreadcrumbs)
+		all.GET("/item/:id", middleware.OptionalAuthentication(), middleware.Visitor(), itemController.GetItemByID)
+		all.GET("/item/:id/related", recommendationController.GetRelatedItems)
 		all.GET("/items", itemController.GetItems)
+		all.GET("/items/trending", viewController.GetTrendingItems)
+		all.GET("/recently-viewed", middleware.OptionalAuthentication(), middleware.Visitor(), viewController.GetRecentlyViewed)
 		all.GET("/reviews", reviewController.GetReviews)
 		all.GET("/review/:id", reviewController.GetReview)
-		all.GET("/item/slug/:slug", itemController.GetItemBySlug)
+		all.GET("/item/slug/:slug", middleware.OptionalAuthentication(), middleware.Visitor(), itemController.GetItemBySlug)
+		all.GET("/item/:id/questions", questionController.GetQuestions)
+		all.GET("/question/:id/answers", questionController.GetAnswers)
+		all.GET("/sales", saleController.GetActiveSales)
+		all.GET("/sale/:id", saleController.GetSale)
+		all.GET("/collections", collectionController.GetLiveCollections)
+		all.GET("/collection/:id", collectionController.GetCollection)
+		all.GET("/collection/:id/items", collectionController.GetCollectionItems)
 
 		authenticated := all.Group("", middleware.Authentication())
 		{
@@ -171,26 +354,73 @@ func NewRouter() *gin.Engine {
 			authenticated.GET("/address/:id", userController.GetAddress)
 			authenticated.PUT("/update-address/:id", userController.UpdateAddress)
 			authenticated.DELETE("/remove-address/:id", userController.RemoveAddress)
+			authenticated.POST("/item/:id/ask-question", questionController.AskQuestion)
+			authenticated.POST("/question/:id/answer", questionController.AnswerQuestion)
+			authenticated.POST("/answer/:id/upvote", questionController.UpvoteAnswer)
+			authenticated.POST("/review/:id/report", reviewController.ReportReview)
+			authenticated.POST("/review/:id/vote", reviewController.VoteReview)
 			customer := authenticated.Group("/customer", middleware.Authorization([]user.Role{user.Customer}))
 			{
 				customer.POST("/post-review", reviewController.PostReview)
+				customer.DELETE("/delete-review/:id", reviewController.DeleteReview)
 				customer.PUT("/update-cart", cartController.UpdateCart)
 				customer.GET("/cart", cartController.GetCart)
+				customer.POST("/checkout", orderController.Checkout)
+				customer.GET("/orders", orderController.GetOrders)
+				customer.GET("/order/:id", orderController.GetOrder)
+				customer.GET("/order/:id/download/:item_id", deliveryController.GetDownloadURL)
 			}
 			vendor := authenticated.Group("/vendor", middleware.Authorization([]user.Role{user.Vendor}))
 			{
 				vendor.POST("/create-item", itemController.CreateItem)
 				vendor.PUT("/update-item/:id", itemController.UpdateItem)
+				vendor.PATCH("/item/:id", itemController.PatchItem)
 				vendor.DELETE("/delete-item/:id", itemController.DeleteItem)
 				vendor.GET("/items", itemController.GetVendorItems)
+				vendor.GET("/item-views", viewController.GetVendorItemViews)
+				vendor.POST("/item/:id/add-images", itemController.AddImages)
+				vendor.DELETE("/item/:id/delete-image", itemController.DeleteImage)
+				vendor.PUT("/item/:id/reorder-images", itemController.ReorderImages)
+				vendor.PUT("/item/:id/primary-image", itemController.SetPrimaryImage)
+				vendor.PUT("/item/:id/image-alt", itemController.UpdateImageAlt)
+				vendor.POST("/item/:id/add-license-keys", deliveryController.AddLicenseKeys)
+				vendor.POST("/review/:id/reply", reviewController.ReplyToReview)
 
 			}
 			admin := authenticated.Group("/admin", middleware.Authorization([]user.Role{user.Admin}))
 			{
 				admin.POST("/create-category", categoryController.CreateCategory)
 				admin.PUT("/update-category/:id", categoryController.UpdateCategory)
+				admin.PATCH("/category/:id", categoryController.PatchCategory)
 				admin.DELETE("/delete-category/:id", categoryController.DeleteCategory)
+				admin.GET("/audit-categories", categoryController.AuditCategories)
 				admin.GET("/users", userController.GetUsers)
+				admin.POST("/create-sale", saleController.CreateSale)
+				admin.PUT("/update-sale/:id", saleController.UpdateSale)
+				admin.DELETE("/delete-sale/:id", saleController.DeleteSale)
+				admin.GET("/sales", saleController.GetSales)
+				admin.GET("/orders", orderController.GetAllOrders)
+				admin.POST("/confirm-payment/:id", orderController.ConfirmPayment)
+				admin.PUT("/update-order-status/:id", orderController.UpdateOrderStatus)
+				admin.GET("/questions", questionController.GetAllQuestions)
+				admin.PUT("/question/:id/moderate", questionController.ModerateQuestion)
+				admin.PUT("/answer/:id/moderate", questionController.ModerateAnswer)
+				admin.POST("/create-collection", collectionController.CreateCollection)
+				admin.PUT("/update-collection/:id", collectionController.UpdateCollection)
+				admin.DELETE("/delete-collection/:id", collectionController.DeleteCollection)
+				admin.GET("/collections", collectionController.GetCollections)
+				admin.POST("/create-synonym", synonymController.CreateSynonym)
+				admin.PUT("/update-synonym/:id", synonymController.UpdateSynonym)
+				admin.DELETE("/delete-synonym/:id", synonymController.DeleteSynonym)
+				admin.GET("/synonyms", synonymController.GetSynonyms)
+				admin.GET("/search-reports/top-queries", searchLogController.GetTopQueries)
+				admin.GET("/search-reports/zero-result-queries", searchLogController.GetZeroResultQueries)
+				admin.GET("/search-reports/low-click-through-queries", searchLogController.GetLowClickThroughQueries)
+				admin.POST("/recompute-ratings", reviewController.RecomputeRatings)
+				admin.GET("/reviews", reviewController.GetModerationQueue)
+				admin.PUT("/review/:id/moderate", reviewController.ModerateReview)
+				admin.GET("/review/:id/reports", reviewController.GetReports)
+				admin.GET("/review/:id/moderation-log", reviewController.GetModerationLog)
 			}
 		}
 	}
@@ -0,0 +1,48 @@
+package types
+
+import (
+	"errors"
+	"strconv"
+
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const DefaultPageLimit = 10
+const MaxPageLimit = 50
+
+// Pagination is a 1-based page of a listing. Total is filled in once the listing is counted.
+type Pagination struct {
+	Page  int64 `json:"page"`
+	Limit int64 `json:"limit"`
+	Total int64 `json:"total"`
+}
+
+// NewPagination parses page and limit query values. Empty values fall back to the first page
+// and the default limit.
+func NewPagination(page, limit string) (*Pagination, error) {
+	p := &Pagination{Page: 1, Limit: DefaultPageLimit}
+	if page != "" {
+		n, err := strconv.ParseInt(page, 10, 64)
+		if err != nil || n < 1 {
+			return nil, errors.New("invalid page")
+		}
+		p.Page = n
+	}
+	if limit != "" {
+		n, err := strconv.ParseInt(limit, 10, 64)
+		if err != nil || n < 1 || n > MaxPageLimit {
+			return nil, errors.New("invalid limit")
+		}
+		p.Limit = n
+	}
+	return p, nil
+}
+
+func (p *Pagination) Skip() int64 {
+	return (p.Page - 1) * p.Limit
+}
+
+// FindOptions returns find options selecting the page
+func (p *Pagination) FindOptions() *options.FindOptions {
+	return options.Find().SetSkip(p.Skip()).SetLimit(p.Limit)
+}
@@ -12,6 +12,7 @@ import (
 	"path/filepath"
 	"strings"
 	"sync"
+	"time"
 )
 
 type MediaCloudManager struct {
@@ -65,6 +66,48 @@ func (mcm *MediaCloudManager) UploadImage(ctx context.Context, files []*multipar
 
 }
 
+// UploadFile uploads a non-image file such as an e-book or installer as a private raw resource and
+// returns its public id. Private files cannot be fetched by url; they are handed out with PrivateDownloadURL.
+func (mcm *MediaCloudManager) UploadFile(ctx context.Context, fileHeader *multipart.FileHeader, collection string) (string, *mediaErrors.AppError) {
+	file, err := fileHeader.Open()
+	if err != nil {
+		return "", mediaErrors.NewError("failed to open file: "+fileHeader.Filename+" "+err.Error(), 400)
+	}
+	defer file.Close()
+	res, err := mcm.cld.Upload.Upload(ctx, file, uploader.UploadParams{Folder: mcm.folder + "/" + collection, UniqueFilename: api.Bool(true), ResourceType: "raw", Type: api.Private})
+	if err != nil {
+		return "", mediaErrors.NewError("failed to upload file: "+fileHeader.Filename+" "+err.Error(), 400)
+	}
+	return res.PublicID, nil
+}
+
+// PrivateDownloadURL signs a url that downloads a file uploaded with UploadFile until expiresAt
+func (mcm *MediaCloudManager) PrivateDownloadURL(publicID string, expiresAt time.Time) (string, *mediaErrors.AppError) {
+	downloadURL, err := mcm.cld.Upload.PrivateDownloadURL(uploader.PrivateDownloadURLParams{
+		PublicID:     publicID,
+		DeliveryType: api.Private,
+		Attachment:   "true",
+		ExpiresAt:    &expiresAt,
+		ResourceType: api.File,
+	})
+	if err != nil {
+		return "", mediaErrors.NewError("failed to sign download url: "+err.Error(), 500)
+	}
+	return downloadURL, nil
+}
+
+// DeleteFile deletes a private file uploaded with UploadFile
+func (mcm *MediaCloudManager) DeleteFile(ctx context.Context, publicID string) *mediaErrors.AppError {
+	if publicID == "" {
+		return mediaErrors.NewError("invalid public id", 400)
+	}
+	_, err := mcm.cld.Upload.Destroy(ctx, uploader.DestroyParams{PublicID: publicID, ResourceType: "raw", Type: api.Private})
+	if err != nil {
+		return mediaErrors.NewError("failed to delete file: "+err.Error(), 400)
+	}
+	return nil
+}
+
 func (mcm *MediaCloudManager) DeleteImageBySecureURL(ctx context.Context, secureUrl string) *mediaErrors.AppError {
 	publicID, err := fetchPublicIdFromSecureUrl(secureUrl)
 	if err != nil {
@@ -21,10 +21,33 @@ func NewEmailManager(senderEmail, senderName, apiKey string) *EmailManager {
 		ApiKey:      apiKey,
 	}
 }
+
+type emailContent struct {
+	Title     string
+	H1        string
+	Firstname string
+	P         string
+	Label     string
+	Code      string
+	Link      string
+	LinkText  string
+}
+
 func (eu *EmailManager) sendEmail(subject, email, firstname, otp, title, h1, p string) error {
+	return eu.send(subject, email, emailContent{
+		Title:     title,
+		H1:        h1,
+		Firstname: firstname,
+		P:         p,
+		Label:     "Your OTP",
+		Code:      otp,
+	})
+}
+
+func (eu *EmailManager) send(subject, email string, content emailContent) error {
 	from := mail.NewEmail(eu.SenderName, eu.SenderEmail)
-	to := mail.NewEmail(firstname, email)
-	htmlContent, err := eu.emailHTML(otp, firstname, title, h1, p)
+	to := mail.NewEmail(content.Firstname, email)
+	htmlContent, err := eu.emailHTML(content)
 	if err != nil {
 		return err
 	}
@@ -34,7 +57,7 @@ func (eu *EmailManager) sendEmail(subject, email, firstname, otp, title, h1, p s
 	return err
 }
 
-func (eu *EmailManager) emailHTML(otp, firstname, title, h1, p string) (string, error) {
+func (eu *EmailManager) emailHTML(content emailContent) (string, error) {
 	tmpl := template.Must(template.New("email").Parse(`
 		<!DOCTYPE html>
 		<html lang="en">
@@ -89,7 +112,8 @@ func (eu *EmailManager) emailHTML(otp, firstname, title, h1, p string) (string,
 				<h1>{{.H1}}</h1>
 				<p>Dear <span class="firstname">{{.Firstname}}</span>,</p>
 				<p>{{.P}}</p>
-				<p class="otp">Your OTP: {{.Otp}}</p>
+				{{if .Code}}<p class="otp">{{.Label}}: {{.Code}}</p>{{end}}
+				{{if .Link}}<p><a href="{{.Link}}">{{.LinkText}}</a></p>{{end}}
 				<p class="footer">This email was sent by {{.Sendername}}</p>
 			</div>
 		</body>
@@ -98,19 +122,11 @@ func (eu *EmailManager) emailHTML(otp, firstname, title, h1, p string) (string,
 
 	var buf bytes.Buffer
 	data := struct {
-		Title      string
-		H1         string
-		Firstname  string
-		P          string
-		Otp        string
+		emailContent
 		Sendername string
 	}{
-		Title:      title,
-		H1:         h1,
-		Firstname:  firstname,
-		P:          p,
-		Otp:        otp,
-		Sendername: eu.SenderName,
+		emailContent: content,
+		Sendername:   eu.SenderName,
 	}
 
 	if err := tmpl.Execute(&buf, data); err != nil {
@@ -134,3 +150,34 @@ func (eu *EmailManager) SendResetPasswordEmail(email, firstname, otp string) err
 	p := "Hiii! Please enter the OTP to reset your password."
 	return eu.sendEmail(subject, email, firstname, otp, title, h1, p)
 }
+
+func (eu *EmailManager) SendLicenseKeyEmail(email, firstname, itemName, licenseKey string) error {
+	return eu.send("Your licence key for "+itemName, email, emailContent{
+		Title:     "Licence Key",
+		H1:        "Thank you for your purchase!",
+		Firstname: firstname,
+		P:         "Here is your licence key for " + itemName + ". Keep it somewhere safe.",
+		Label:     "Licence key",
+		Code:      licenseKey,
+	})
+}
+
+func (eu *EmailManager) SendDownloadEmail(email, firstname, itemName, downloadURL string) error {
+	return eu.send("Your download for "+itemName, email, emailContent{
+		Title:     "Download",
+		H1:        "Thank you for your purchase!",
+		Firstname: firstname,
+		P:         itemName + " is ready. The link below expires, but you can request a new one from your order.",
+		Link:      downloadURL,
+		LinkText:  "Download " + itemName,
+	})
+}
+
+func (eu *EmailManager) SendReviewReplyEmail(email, firstname, itemName, reply string) error {
+	return eu.send("The seller replied to your review of "+itemName, email, emailContent{
+		Title:     "Review Reply",
+		H1:        "The seller replied to your review",
+		Firstname: firstname,
+		P:         "The seller of " + itemName + " replied to your review: \"" + reply + "\"",
+	})
+}
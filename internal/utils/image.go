@@ -0,0 +1,38 @@
+package utils
+
+import (
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+
+	"github.com/ayo-ajayi/ecommerce/internal/constants"
+	"github.com/ayo-ajayi/ecommerce/internal/errors"
+)
+
+// imageContentTypes are the formats images can be uploaded in
+var imageContentTypes = map[string]bool{"image/jpeg": true, "image/png": true, "image/gif": true, "image/webp": true}
+
+// CheckImages rejects too many images, images that are too large and files that are not images,
+// judged by their content rather than their name, so it is called before anything is uploaded
+func CheckImages(files []*multipart.FileHeader) *errors.AppError {
+	if len(files) > constants.MaxImagesPerUpload {
+		return errors.NewError("at most "+strconv.Itoa(constants.MaxImagesPerUpload)+" images can be uploaded at once", 400)
+	}
+	for _, v := range files {
+		if v.Size > constants.MaxImageSizeInMB<<20 {
+			return errors.NewError("images must be at most "+strconv.FormatInt(constants.MaxImageSizeInMB, 10)+"MB: "+v.Filename, 400)
+		}
+		file, err := v.Open()
+		if err != nil {
+			return errors.NewError("invalid image: "+v.Filename, 400)
+		}
+		head := make([]byte, 512)
+		n, _ := io.ReadFull(file, head)
+		file.Close()
+		if !imageContentTypes[http.DetectContentType(head[:n])] {
+			return errors.NewError("images must be jpeg, png, gif or webp: "+v.Filename, 400)
+		}
+	}
+	return nil
+}
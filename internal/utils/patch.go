@@ -0,0 +1,81 @@
+package utils
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/ayo-ajayi/ecommerce/internal/errors"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// ReadMergePatch reads a JSON merge patch (RFC 7396) body and the version it was made against,
+// taken from the If-Match header or else the patch's "version" field. fromHeader tells the
+// caller to answer a version conflict with 412 rather than 409.
+func ReadMergePatch(c *gin.Context) (patch map[string]json.RawMessage, version int64, fromHeader bool, appErr *errors.AppError) {
+	if err := json.NewDecoder(c.Request.Body).Decode(&patch); err != nil || patch == nil {
+		return nil, 0, false, errors.NewError("invalid patch: the body must be a JSON object", 400)
+	}
+	if version, ok, err := ifMatchVersion(c); err != nil {
+		return nil, 0, false, err
+	} else if ok {
+		return patch, version, true, nil
+	}
+	raw, ok := patch["version"]
+	if !ok {
+		return nil, 0, false, errors.NewError("a version is required in the If-Match header or the patch", http.StatusPreconditionRequired)
+	}
+	if err := json.Unmarshal(raw, &version); err != nil {
+		return nil, 0, false, errors.NewError("invalid version", 400)
+	}
+	return patch, version, false, nil
+}
+
+// ReadVersion reads the version a full update was made against from the If-Match header or
+// else the form's "version" field. fromHeader tells the caller to answer a version conflict
+// with 412 rather than 409.
+func ReadVersion(c *gin.Context) (version int64, fromHeader bool, appErr *errors.AppError) {
+	if version, ok, err := ifMatchVersion(c); err != nil {
+		return 0, false, err
+	} else if ok {
+		return version, true, nil
+	}
+	raw := c.PostForm("version")
+	if raw == "" {
+		return 0, false, errors.NewError("a version is required in the If-Match header or the form", http.StatusPreconditionRequired)
+	}
+	version, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil {
+		return 0, false, errors.NewError("invalid version", 400)
+	}
+	return version, false, nil
+}
+
+func ifMatchVersion(c *gin.Context) (int64, bool, *errors.AppError) {
+	ifMatch := c.GetHeader("If-Match")
+	if ifMatch == "" {
+		return 0, false, nil
+	}
+	version, err := strconv.ParseInt(strings.Trim(strings.TrimPrefix(ifMatch, "W/"), `"`), 10, 64)
+	if err != nil {
+		return 0, false, errors.NewError("invalid If-Match header", 400)
+	}
+	return version, true, nil
+}
+
+// IsNull reports whether a merge patch value is null, which removes the field
+func IsNull(raw json.RawMessage) bool {
+	return strings.TrimSpace(string(raw)) == "null"
+}
+
+// WithVersion adds the version to filter. Documents saved before versioning count as version 0.
+func WithVersion(filter bson.M, version int64) bson.M {
+	if version == 0 {
+		filter["$or"] = []bson.M{{"version": 0}, {"version": bson.M{"$exists": false}}}
+	} else {
+		filter["version"] = version
+	}
+	return filter
+}
@@ -0,0 +1,64 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// URLSigner issues tamper-proof, time-limited tokens for links such as digital downloads
+type URLSigner struct {
+	secretKey []byte
+}
+
+func NewURLSigner(secretKey string) *URLSigner {
+	return &URLSigner{
+		secretKey: []byte(secretKey),
+	}
+}
+
+func (us *URLSigner) Sign(payload string, expiresAt time.Time) string {
+	data := payload + "|" + strconv.FormatInt(expiresAt.Unix(), 10)
+	return base64.RawURLEncoding.EncodeToString([]byte(data)) + "." + base64.RawURLEncoding.EncodeToString(us.mac(data))
+}
+
+// Verify returns the payload of a token if its signature is valid and it has not expired
+func (us *URLSigner) Verify(token string) (string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 {
+		return "", errors.New("malformed token")
+	}
+	data, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return "", errors.New("malformed token")
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", errors.New("malformed token")
+	}
+	if !hmac.Equal(signature, us.mac(string(data))) {
+		return "", errors.New("invalid token signature")
+	}
+	i := strings.LastIndex(string(data), "|")
+	if i < 0 {
+		return "", errors.New("malformed token")
+	}
+	expiresAt, err := strconv.ParseInt(string(data[i+1:]), 10, 64)
+	if err != nil {
+		return "", errors.New("malformed token")
+	}
+	if time.Now().Unix() > expiresAt {
+		return "", errors.New("token expired")
+	}
+	return string(data[:i]), nil
+}
+
+func (us *URLSigner) mac(data string) []byte {
+	mac := hmac.New(sha256.New, us.secretKey)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
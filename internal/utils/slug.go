@@ -0,0 +1,145 @@
+package utils
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/ayo-ajayi/ecommerce/internal/constants"
+	"github.com/ayo-ajayi/ecommerce/internal/database"
+	"github.com/google/uuid"
+	gosimpleslug "github.com/gosimple/slug"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// InitSlugIndex makes slugs unique in the collection and indexes the slugs entities had before.
+// Databases from before slugs were unique are migrated first: duplicate slugs are renamed,
+// except on the oldest entity using them, and entities without a slug get one from their name.
+// Only non-empty slugs are indexed, so a missed entity cannot stop the index from being built.
+func InitSlugIndex(collection *mongo.Collection) error {
+	if err := dedupeSlugs(collection); err != nil {
+		return errors.New("Error deduplicating slugs for " + collection.Name() + " collection:" + err.Error())
+	}
+	ctx, cancel := database.DBReqContext(5)
+	defer cancel()
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "slug", Value: 1}},
+			Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{"slug": bson.M{"$gt": ""}}),
+		},
+		{
+			Keys: bson.D{{Key: "slug_history", Value: 1}},
+		},
+	})
+	if err != nil {
+		return errors.New("Error creating slug index for " + collection.Name() + " collection:" + err.Error())
+	}
+	if err := backfillSlugs(collection); err != nil {
+		return errors.New("Error backfilling slugs for " + collection.Name() + " collection:" + err.Error())
+	}
+	return nil
+}
+
+// dedupeSlugs gives every entity but the oldest one sharing a slug a new unique slug
+func dedupeSlugs(collection *mongo.Collection) error {
+	ctx, cancel := database.DBReqContext(60)
+	defer cancel()
+	cursor, err := collection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"slug": bson.M{"$gt": ""}}}},
+		{{Key: "$sort", Value: bson.M{"_id": 1}}},
+		{{Key: "$group", Value: bson.M{"_id": "$slug", "ids": bson.M{"$push": "$_id"}, "count": bson.M{"$sum": 1}}}},
+		{{Key: "$match", Value: bson.M{"count": bson.M{"$gt": 1}}}},
+	}, options.Aggregate().SetAllowDiskUse(true))
+	if err != nil {
+		return err
+	}
+	var duplicates []struct {
+		Slug string        `bson:"_id"`
+		IDs  []interface{} `bson:"ids"`
+	}
+	if err := cursor.All(ctx, &duplicates); err != nil {
+		return err
+	}
+	for _, v := range duplicates {
+		for _, id := range v.IDs[1:] {
+			if _, err := collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"slug": v.Slug + "-" + uuid.New().String()}}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// backfillSlugs gives entities saved without a slug one made from their name
+func backfillSlugs(collection *mongo.Collection) error {
+	ctx, cancel := database.DBReqContext(60)
+	defer cancel()
+	cursor, err := collection.Find(ctx, bson.M{"$or": []bson.M{{"slug": bson.M{"$exists": false}}, {"slug": ""}, {"slug": nil}}}, options.Find().SetProjection(bson.M{"name": 1}))
+	if err != nil {
+		return err
+	}
+	var missing []struct {
+		ID   interface{} `bson:"_id"`
+		Name string      `bson:"name"`
+	}
+	if err := cursor.All(ctx, &missing); err != nil {
+		return err
+	}
+	for _, v := range missing {
+		base := gosimpleslug.Make(v.Name)
+		if base == "" {
+			base = uuid.New().String()
+		}
+		if _, err := SaveWithUniqueSlug(base, func(slug string) error {
+			_, err := collection.UpdateOne(ctx, bson.M{"_id": v.ID}, bson.M{"$set": bson.M{"slug": slug}})
+			return err
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SaveWithUniqueSlug calls save with base and, while the unique slug index rejects it,
+// with numbered and finally random suffixes. It returns the slug that was saved.
+func SaveWithUniqueSlug(base string, save func(slug string) error) (string, error) {
+	var err error
+	for attempt := 0; attempt < constants.MaxSlugAttempts; attempt++ {
+		slug := base
+		if attempt == constants.MaxSlugAttempts-1 {
+			slug = base + "-" + uuid.New().String()
+		} else if attempt > 0 {
+			slug = base + "-" + strconv.Itoa(attempt+1)
+		}
+		if err = save(slug); err == nil {
+			return slug, nil
+		}
+		if !mongo.IsDuplicateKeyError(err) {
+			return "", err
+		}
+	}
+	return "", err
+}
+
+// SlugHistory returns history with previous added and current removed, so an entity
+// that gets an old slug back does not redirect to itself
+func SlugHistory(history []string, previous, current string) []string {
+	updated := make([]string, 0, len(history)+1)
+	for _, v := range append(history, previous) {
+		if v == current || v == "" || containsString(updated, v) {
+			continue
+		}
+		updated = append(updated, v)
+	}
+	return updated
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}